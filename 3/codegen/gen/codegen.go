@@ -1,10 +1,14 @@
 // go build gen/* && ./codegen.exe pack/unpack.go  pack/marshaller.go
-// go run pack/*
+// go run ./pack
+// go test -fuzz FuzzUserUnpack ./pack
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
 	"go/token"
 	"log"
@@ -15,59 +19,171 @@ import (
 )
 
 type tpl struct {
+	TypeName  string
 	FieldName string
 }
 
+type headerTpl struct {
+	Package string
+	MaxLen  uint
+}
+
+type fuzzTpl struct {
+	TypeName string
+	Seed     []byte
+}
+
 var (
+	// общие для всех структур типы и переменные, генерируются один раз на файл
+	headerCodeTpl = template.Must(template.New("headerCodeTpl").Parse(`// Code generated by codegen; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// UnpackMaxLen ограничивает длину строки, которую готов прочитать Unpack,
+// чтобы битый или злонамеренный пакет не заставил нас аллоцировать гигабайты
+var UnpackMaxLen uint32 = {{.MaxLen}}
+
+// ErrUnpackTooLong - длина поля в пакете больше UnpackMaxLen
+var ErrUnpackTooLong = errors.New("length exceeds UnpackMaxLen")
+
+// UnpackError - ошибка разбора конкретного поля, Offset - смещение начала поля в пакете
+type UnpackError struct {
+	Type   string
+	Field  string
+	Offset int
+	Err    error
+}
+
+func (e *UnpackError) Error() string {
+	return fmt.Sprintf("unpack %s.%s at offset %d: %v", e.Type, e.Field, e.Offset, e.Err)
+}
+
+func (e *UnpackError) Unwrap() error {
+	return e.Err
+}
+
+// unpackReadLen читает длину поля и проверяет её до того, как мы под неё что-то аллоцируем
+func unpackReadLen(r *bytes.Reader) (int, error) {
+	var lenRaw uint32
+	if err := binary.Read(r, binary.LittleEndian, &lenRaw); err != nil {
+		return 0, err
+	}
+	if lenRaw > UnpackMaxLen {
+		return 0, fmt.Errorf("%w: %d > %d", ErrUnpackTooLong, lenRaw, UnpackMaxLen)
+	}
+	if int(lenRaw) > r.Len() {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int(lenRaw), nil
+}
+
+`))
+
 	intTpl = template.Must(template.New("intTpl").Parse(`
 	// {{.FieldName}}
+	{{.FieldName}}Off := len(data) - r.Len()
 	var {{.FieldName}}Raw uint32
-	binary.Read(r, binary.LittleEndian, &{{.FieldName}}Raw)
+	if err := binary.Read(r, binary.LittleEndian, &{{.FieldName}}Raw); err != nil {
+		return &UnpackError{Type: "{{.TypeName}}", Field: "{{.FieldName}}", Offset: {{.FieldName}}Off, Err: err}
+	}
 	in.{{.FieldName}} = int({{.FieldName}}Raw)
 `))
 
 	strTpl = template.Must(template.New("strTpl").Parse(`
 	// {{.FieldName}}
-	var {{.FieldName}}LenRaw uint32
-	binary.Read(r, binary.LittleEndian, &{{.FieldName}}LenRaw)
+	{{.FieldName}}Off := len(data) - r.Len()
+	{{.FieldName}}LenRaw, err := unpackReadLen(r)
+	if err != nil {
+		return &UnpackError{Type: "{{.TypeName}}", Field: "{{.FieldName}}", Offset: {{.FieldName}}Off, Err: err}
+	}
 	{{.FieldName}}Raw := make([]byte, {{.FieldName}}LenRaw)
-	binary.Read(r, binary.LittleEndian, &{{.FieldName}}Raw)
+	if err := binary.Read(r, binary.LittleEndian, {{.FieldName}}Raw); err != nil {
+		return &UnpackError{Type: "{{.TypeName}}", Field: "{{.FieldName}}", Offset: {{.FieldName}}Off, Err: err}
+	}
 	in.{{.FieldName}} = string({{.FieldName}}Raw)
+`))
+
+	fuzzHeaderTpl = template.Must(template.New("fuzzHeaderTpl").Parse(`// Code generated by codegen; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"errors"
+	"testing"
+)
+`))
+
+	// на любых входных данных Unpack не должен паниковать,
+	// а любая ошибка должна быть *UnpackError с адекватным смещением
+	fuzzTestTpl = template.Must(template.New("fuzzTestTpl").Parse(`
+func Fuzz{{.TypeName}}Unpack(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{ {{- range $i, $b := .Seed}}{{if $i}}, {{end}}{{$b}}{{end -}} })
+	f.Add([]byte{255, 255, 255, 255, 255, 255, 255, 255})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		in := &{{.TypeName}}{}
+		err := in.Unpack(data)
+		if err == nil {
+			return
+		}
+		uerr := &UnpackError{}
+		if !errors.As(err, &uerr) {
+			t.Fatalf("expected *UnpackError, got %T: %v", err, err)
+		}
+		if uerr.Offset < 0 || uerr.Offset > len(data) {
+			t.Fatalf("offset %d out of range [0, %d]", uerr.Offset, len(data))
+		}
+	})
+}
 `))
 )
 
 func main() {
+	maxLen := flag.Uint("maxlen", 1<<20, "max length of string field accepted by generated Unpack")
+	flag.Parse()
+	if flag.NArg() != 2 {
+		log.Fatalln("usage: codegen [-maxlen N] <in.go> <out.go>")
+	}
+	inFile, outFile := flag.Arg(0), flag.Arg(1)
+	testFile := strings.TrimSuffix(outFile, ".go") + "_test.go"
+
 	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, os.Args[1], nil, parser.ParseComments)
+	node, err := parser.ParseFile(fset, inFile, nil, parser.ParseComments)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	out, _ := os.Create(os.Args[2])
+	out := &bytes.Buffer{}
+	fuzz := &bytes.Buffer{}
 
-	fmt.Fprintln(out, `package `+node.Name.Name)
-	fmt.Fprintln(out) // empty line
-	fmt.Fprintln(out, `import "encoding/binary"`)
-	fmt.Fprintln(out, `import "bytes"`)
-	fmt.Fprintln(out) // empty line
+	headerCodeTpl.Execute(out, headerTpl{node.Name.Name, *maxLen})
+	fuzzHeaderTpl.Execute(fuzz, headerTpl{Package: node.Name.Name})
 
 	for _, f := range node.Decls {
 		g, ok := f.(*ast.GenDecl)
 		if !ok {
-			fmt.Printf("SKIP %#T is not *ast.GenDecl\n", f)
+			fmt.Printf("SKIP %T is not *ast.GenDecl\n", f)
 			continue
 		}
 	SPECS_LOOP:
 		for _, spec := range g.Specs {
 			currType, ok := spec.(*ast.TypeSpec)
 			if !ok {
-				fmt.Printf("SKIP %#T is not ast.TypeSpec\n", spec)
+				fmt.Printf("SKIP %T is not ast.TypeSpec\n", spec)
 				continue
 			}
 
 			currStruct, ok := currType.Type.(*ast.StructType)
 			if !ok {
-				fmt.Printf("SKIP %#T is not ast.StructType\n", currStruct)
+				fmt.Printf("SKIP %T is not ast.StructType\n", currStruct)
 				continue
 			}
 
@@ -85,12 +201,16 @@ func main() {
 				continue SPECS_LOOP
 			}
 
-			fmt.Printf("process struct %s\n", currType.Name.Name)
+			typeName := currType.Name.Name
+			fmt.Printf("process struct %s\n", typeName)
 			fmt.Printf("\tgenerating Unpack method\n")
 
-			fmt.Fprintln(out, "func (in *"+currType.Name.Name+") Unpack(data []byte) error {")
+			fmt.Fprintln(out, "func (in *"+typeName+") Unpack(data []byte) error {")
 			fmt.Fprintln(out, "	r := bytes.NewReader(data)")
 
+			// валидный пакет из нулевых значений - стартовая точка для фаззера
+			seed := []byte{}
+
 		FIELDS_LOOP:
 			for _, field := range currStruct.Fields.List {
 
@@ -104,25 +224,39 @@ func main() {
 				fieldName := field.Names[0].Name
 				fileType := field.Type.(*ast.Ident).Name
 
-				fmt.Printf("\tgenerating code for field %s.%s\n", currType.Name.Name, fieldName)
+				fmt.Printf("\tgenerating code for field %s.%s\n", typeName, fieldName)
 
 				switch fileType {
 				case "int":
-					intTpl.Execute(out, tpl{fieldName})
+					intTpl.Execute(out, tpl{typeName, fieldName})
 				case "string":
-					strTpl.Execute(out, tpl{fieldName})
+					strTpl.Execute(out, tpl{typeName, fieldName})
 				default:
 					log.Fatalln("unsupported", fileType)
 				}
+				seed = append(seed, 0, 0, 0, 0)
 			}
 
 			fmt.Fprintln(out, "	return nil")
 			fmt.Fprintln(out, "}") // end of Unpack func
 			fmt.Fprintln(out)      // empty line
 
+			fmt.Printf("\tgenerating Fuzz%sUnpack test\n", typeName)
+			fuzzTestTpl.Execute(fuzz, fuzzTpl{typeName, seed})
 		}
 	}
+
+	writeSource(outFile, out.Bytes())
+	writeSource(testFile, fuzz.Bytes())
 }
 
-// go build gen/* && ./codegen.exe pack/unpack.go  pack/marshaller.go
-// go run pack/*
+// writeSource прогоняет сгенерированный код через gofmt
+func writeSource(fileName string, src []byte) {
+	formatted, err := format.Source(src)
+	if err != nil {
+		log.Fatalf("gofmt %s: %v", fileName, err)
+	}
+	if err := os.WriteFile(fileName, formatted, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
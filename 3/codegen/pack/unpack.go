@@ -34,6 +34,14 @@ func main() {
 	}
 
 	u := User{}
-	u.Unpack(data)
-	fmt.Printf("Unpacked user %#v", u)
+	if err := u.Unpack(data); err != nil {
+		fmt.Println("unpack error:", err)
+		return
+	}
+	fmt.Printf("Unpacked user %#v\n", u)
+
+	// обрезанный пакет: вместо мусора с nil получаем ошибку с полем и смещением
+	broken := User{}
+	err := broken.Unpack(data[:10])
+	fmt.Println("truncated:", err)
 }
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
@@ -17,6 +19,47 @@ var (
 	client  = &http.Client{Timeout: time.Second}
 )
 
+// ошибки FindUsers, проверяются через errors.Is/errors.As. Тексты те же, что были до них
+var (
+	// ErrUnauthorized - сервер не принял AccessToken
+	ErrUnauthorized = errors.New("Bad AccessToken")
+	// ErrServer - сервер ответил 5xx
+	ErrServer = errors.New("SearchServer fatal error")
+)
+
+// BadOrderFieldError - сервер не умеет сортировать по Field
+type BadOrderFieldError struct {
+	Field string
+}
+
+func (e *BadOrderFieldError) Error() string {
+	return fmt.Sprintf("OrderFeld %s invalid", e.Field)
+}
+
+// TimeoutError - запрос не уложился в таймаут http-клиента или в дедлайн контекста
+type TimeoutError struct {
+	// Params - параметры запроса, который не успел
+	Params string
+	Err    error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timeout for %s", e.Params)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout - чтобы TimeoutError оставалась net.Error, как ошибка, из которой она получилась
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *TimeoutError) Temporary() bool {
+	return true
+}
+
 type User struct {
 	Id     int
 	Name   string
@@ -50,23 +93,49 @@ type SearchRequest struct {
 	OrderBy    int
 }
 
+const (
+	// maxPageSize - больше за один запрос сервер не отдаёт
+	maxPageSize = 25
+
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultMaxRetryBackoff = 2 * time.Second
+)
+
 type SearchClient struct {
 	// токен, по которому происходит авторизация на внешней системе, уходит туда через хедер
 	AccessToken string
 	// урл внешней системы, куда идти
 	URL string
+
+	// HTTPClient - через что ходить во внешнюю систему, свой транспорт задаётся в HTTPClient.Transport.
+	// Если nil - клиент с таймаутом в секунду
+	HTTPClient *http.Client
+	// MaxAttempts - сколько раз всего пробуем запрос, если он упал по таймауту или с 5xx.
+	// 0 и 1 - без повторов
+	MaxAttempts int
+	// RetryBackoff - пауза перед первым повтором, дальше удваивается до MaxRetryBackoff.
+	// К паузе добавляется случайный разброс, чтобы клиенты не приходили повторять все разом
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// Prefetch - Iter запрашивает следующую страницу, пока читается текущая
+	Prefetch bool
 }
 
 // FindUsers отправляет запрос во внешнюю систему, которая непосредственно ищет пользоваталей
 func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
+	return srv.FindUsersCtx(context.Background(), req)
+}
+
+// FindUsersCtx - FindUsers с контекстом: отмена контекста прерывает и запрос, и ожидание перед повтором
+func (srv *SearchClient) FindUsersCtx(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
 
 	searcherParams := url.Values{}
 
 	if req.Limit < 0 {
 		return nil, fmt.Errorf("limit must be > 0")
 	}
-	if req.Limit > 25 {
-		req.Limit = 25
+	if req.Limit > maxPageSize {
+		req.Limit = maxPageSize
 	}
 	if req.Offset < 0 {
 		return nil, fmt.Errorf("offset must be > 0")
@@ -81,32 +150,29 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 	searcherParams.Add("order_field", req.OrderField)
 	searcherParams.Add("order_by", strconv.Itoa(req.OrderBy))
 
-	searcherReq, err := http.NewRequest("GET", srv.URL+"?"+searcherParams.Encode(), nil)
-	searcherReq.Header.Add("AccessToken", srv.AccessToken)
-
-	resp, err := client.Do(searcherReq)
+	resp, body, err := srv.do(ctx, searcherParams)
 	if err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
-			return nil, fmt.Errorf("timeout for %s", searcherParams.Encode())
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil, &TimeoutError{Params: searcherParams.Encode(), Err: err}
 		}
-		return nil, fmt.Errorf("unknown error %s", err)
+		return nil, fmt.Errorf("unknown error %w", err)
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
 
+	// 5xx могли уже повторяться в do, для вызывающего это одна и та же ErrServer
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, ErrServer
+	}
 	switch resp.StatusCode {
 	case http.StatusUnauthorized:
-		return nil, fmt.Errorf("Bad AccessToken")
-	case http.StatusInternalServerError:
-		return nil, fmt.Errorf("SearchServer fatal error")
+		return nil, ErrUnauthorized
 	case http.StatusBadRequest:
 		errResp := SearchErrorResponse{}
 		err = json.Unmarshal(body, &errResp)
 		if err != nil {
-			return nil, fmt.Errorf("cant unpack error json: %s", err)
+			return nil, fmt.Errorf("cant unpack error json: %w", err)
 		}
 		if errResp.Error == "ErrorBadOrderField" {
-			return nil, fmt.Errorf("OrderFeld %s invalid", req.OrderField)
+			return nil, &BadOrderFieldError{Field: req.OrderField}
 		}
 		return nil, fmt.Errorf("unknown bad request error: %s", errResp.Error)
 	}
@@ -114,7 +180,7 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 	data := []User{}
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		return nil, fmt.Errorf("cant unpack result json: %s", err)
+		return nil, fmt.Errorf("cant unpack result json: %w", err)
 	}
 
 	result := SearchResponse{}
@@ -127,3 +193,79 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 
 	return &result, err
 }
+
+// do выполняет запрос, повторяя его при таймаутах и 5xx. Поиск ничего не меняет на сервере,
+// так что повторять его безопасно. Возвращает ответ последней попытки с уже прочитанным телом
+func (srv *SearchClient) do(ctx context.Context, params url.Values) (*http.Response, []byte, error) {
+	attempts := srv.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := srv.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	maxBackoff := srv.MaxRetryBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxRetryBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, body, err := srv.roundTrip(ctx, params)
+		if attempt == attempts || !retryable(ctx, resp, err) {
+			return resp, body, err
+		}
+
+		// equal jitter: ждём случайное время от половины паузы до полной
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			// ошибку последней попытки отдаём как есть, чтобы таймаут остался таймаутом
+			return resp, body, err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (srv *SearchClient) roundTrip(ctx context.Context, params url.Values) (*http.Response, []byte, error) {
+	searcherReq, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	searcherReq.Header.Add("AccessToken", srv.AccessToken)
+
+	httpClient := srv.HTTPClient
+	if httpClient == nil {
+		httpClient = client
+	}
+	resp, err := httpClient.Do(searcherReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+// retryable - повторяем только то, что может пройти со второго раза: таймауты и 5xx.
+// Если истёк или отменён сам ctx, повторять бессмысленно
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		netErr, ok := err.(net.Error)
+		return ok && netErr.Timeout()
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
@@ -1,18 +1,20 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"encoding/xml"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"reflect"
-	"sort"
-	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"hw4/searchserver"
 )
 
 const AccessToken = "token"
@@ -23,113 +25,18 @@ type TestCase struct {
 	IsError     bool
 	AccessToken string
 }
-type UserXML struct {
-	Id        int    `xml:"id"`
-	FirstName string `xml:"first_name"`
-	LastName  string `xml:"last_name"`
-	Age       int    `xml:"age"`
-	About     string `xml:"about"`
-	Gender    string `xml:"gender"`
-}
-
-type RootXML struct {
-	Version string    `xml:"version,attr"`
-	List    []UserXML `xml:"row"`
-}
-
-func JoinAndFilter(list []UserXML, query string) []User {
-	var res []User
-	for _, user := range list {
-		name := user.FirstName + " " + user.LastName
-		if query == "" || strings.Contains(name, query) || strings.Contains(user.About, query) {
-			res = append(res, User{
-				Id:     user.Id,
-				Name:   name,
-				Age:    user.Age,
-				About:  user.About,
-				Gender: user.Gender,
-			})
-		}
-	}
-	return res
-}
-
-func Sort(users *[]User, orderField string, orderBy int) {
-	if orderBy != 0 {
-		sort.Slice(*users, func(i, j int) bool {
-
-			ui := (*users)[i]
-			uj := (*users)[j]
-
-			switch orderField {
-			case "Name":
-				if orderBy > 0 {
-					return ui.Name > uj.Name
-				}
-				return ui.Name < uj.Name
-			case "About":
-				if orderBy > 0 {
-					return ui.About > uj.About
-				}
-				return ui.About < uj.About
-			case "Id":
-				if orderBy > 0 {
-					return ui.Id > uj.Id
-				}
-				return ui.Id < uj.Id
-			default:
-				return false
-			}
-		})
-	}
-}
-
-func SearchServer(w http.ResponseWriter, r *http.Request) {
-
-	rAccessToken := r.Header.Get("AccessToken")
-	if rAccessToken != AccessToken {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
-	query := r.URL.Query().Get("query")
-	orderField := r.URL.Query().Get("order_field")
-	orderBy, _ := strconv.Atoi(r.URL.Query().Get("order_by"))
-
-	switch orderField {
-	case "Id", "Age", "Name":
-	default:
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, `{"Error": "ErrorBadOrderField"}`)
-		return
-	}
 
-	f, err := os.Open("dataset.xml")
-	if err != nil {
-		panic(err)
-	}
-	rt := new(RootXML)
-	data, _ := io.ReadAll(f)
-	err = xml.Unmarshal(data, &rt)
-	if err != nil {
-		panic(err)
-	}
-	users := JoinAndFilter(rt.List, query)
-	Sort(&users, orderField, orderBy)
-	if len(users) > offset+limit {
-		users = users[offset : offset+limit]
-	} else if offset < len(users) {
-		users = users[offset:]
-	} else {
-		users = []User{}
-	}
-	res, err := json.Marshal(users)
+// searchServer - настоящий SearchServer из пакета searchserver поверх dataset.xml
+var searchServer = func() *searchserver.Server {
+	s, err := searchserver.New("dataset.xml", AccessToken)
 	if err != nil {
 		panic(err)
 	}
-	w.Write(res)
+	return s
+}()
+
+func SearchServer(w http.ResponseWriter, r *http.Request) {
+	searchServer.ServeHTTP(w, r)
 }
 
 func TestClientFindUsers(t *testing.T) {
@@ -351,3 +258,273 @@ func TestUnpackJSONError(t *testing.T) {
 		t.Errorf("expected unpack json error, got %v", err)
 	}
 }
+
+// flakyServer отвечает ошибкой на первые fails запросов, дальше - как SearchServer
+func flakyServer(fails int32, fail http.HandlerFunc) (*httptest.Server, *int32) {
+	calls := new(int32)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= fails {
+			fail(w, r)
+			return
+		}
+		SearchServer(w, r)
+	}))
+	return ts, calls
+}
+
+func serverError(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+func TestRetry(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Fails       int32
+		Fail        http.HandlerFunc
+		MaxAttempts int
+		Calls       int32
+		Error       string
+	}{
+		{"500 then ok", 2, serverError, 3, 3, ""},
+		{"500 exhausted", 5, serverError, 3, 3, "SearchServer fatal error"},
+		{"no retries by default", 1, serverError, 0, 1, "SearchServer fatal error"},
+		{"503 then ok", 1, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}, 2, 2, ""},
+		{"502 exhausted", 5, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}, 2, 2, "SearchServer fatal error"},
+		{"504 exhausted", 5, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusGatewayTimeout)
+		}, 3, 3, "SearchServer fatal error"},
+		{"400 is not retried", 5, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"Error": "ErrorBadOrderField"}`)
+		}, 3, 1, "OrderFeld Id invalid"},
+		{"401 is not retried", 5, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}, 3, 1, "Bad AccessToken"},
+	}
+
+	for _, item := range cases {
+		ts, calls := flakyServer(item.Fails, item.Fail)
+		c := &SearchClient{
+			URL:             ts.URL,
+			AccessToken:     AccessToken,
+			MaxAttempts:     item.MaxAttempts,
+			RetryBackoff:    time.Millisecond,
+			MaxRetryBackoff: 2 * time.Millisecond,
+		}
+		res, err := c.FindUsers(SearchRequest{Limit: 1, OrderField: "Id"})
+		ts.Close()
+
+		if item.Error == "" && (err != nil || len(res.Users) != 1) {
+			t.Errorf("[%s] expected one user, got %v, %v", item.Name, res, err)
+		}
+		if item.Error != "" && (err == nil || err.Error() != item.Error) {
+			t.Errorf("[%s] expected error %q, got %v", item.Name, item.Error, err)
+		}
+		if got := atomic.LoadInt32(calls); got != item.Calls {
+			t.Errorf("[%s] expected %d calls, got %d", item.Name, item.Calls, got)
+		}
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	ts, calls := flakyServer(1, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	defer ts.Close()
+
+	c := &SearchClient{
+		URL:          ts.URL,
+		AccessToken:  AccessToken,
+		HTTPClient:   &http.Client{Timeout: 50 * time.Millisecond},
+		MaxAttempts:  2,
+		RetryBackoff: time.Millisecond,
+	}
+	res, err := c.FindUsers(SearchRequest{Limit: 1, OrderField: "Id"})
+	if err != nil || len(res.Users) != 1 {
+		t.Errorf("expected one user after retry, got %v, %v", res, err)
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("expected 2 calls, got %d", got)
+	}
+}
+
+func TestContextStopsRetries(t *testing.T) {
+	ts, calls := flakyServer(100, serverError)
+	defer ts.Close()
+
+	c := &SearchClient{
+		URL:          ts.URL,
+		AccessToken:  AccessToken,
+		MaxAttempts:  10,
+		RetryBackoff: time.Second,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.FindUsersCtx(ctx, SearchRequest{Limit: 1, OrderField: "Id"})
+	if err == nil {
+		t.Errorf("expected error")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("backoff ignored context, took %s", elapsed)
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("expected 1 call, got %d", got)
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	c := &SearchClient{
+		URL:         ts.URL,
+		AccessToken: AccessToken,
+		MaxAttempts: 3,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.FindUsersCtx(ctx, SearchRequest{Limit: 1, OrderField: "Id"})
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded inside, got %#v", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestTransport(t *testing.T) {
+	var token string
+	c := &SearchClient{
+		URL:         "http://search.local/",
+		AccessToken: AccessToken,
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			token = r.Header.Get("AccessToken")
+			rec := httptest.NewRecorder()
+			SearchServer(rec, r)
+			return rec.Result(), nil
+		})},
+	}
+	res, err := c.FindUsers(SearchRequest{Limit: 2, OrderField: "Id", OrderBy: OrderByAsc})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if token != AccessToken {
+		t.Errorf("expected AccessToken header %q, got %q", AccessToken, token)
+	}
+	if len(res.Users) != 2 || res.Users[0].Id != 0 || !res.NextPage {
+		t.Errorf("wrong result %#v", res)
+	}
+}
+
+func TestBadURL(t *testing.T) {
+	c := &SearchClient{
+		URL:         "http://search.local/\x7f",
+		AccessToken: AccessToken,
+	}
+	_, err := c.FindUsers(SearchRequest{Limit: 1, OrderField: "Id"})
+	if err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("expected unknown error, got %v", err)
+	}
+}
+
+func TestBrokenBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// обещаем больше, чем отдаём - тело обрывается на середине
+		w.Header().Set("Content-Length", "100")
+		io.WriteString(w, "[")
+	}))
+	defer ts.Close()
+
+	c := &SearchClient{
+		URL:         ts.URL,
+		AccessToken: AccessToken,
+	}
+	_, err := c.FindUsers(SearchRequest{Limit: 1, OrderField: "Id"})
+	if err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("expected unknown error, got %v", err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+	fatal := httptest.NewServer(http.HandlerFunc(serverError))
+	defer fatal.Close()
+	search := httptest.NewServer(http.HandlerFunc(SearchServer))
+	defer search.Close()
+
+	cases := []struct {
+		Name    string
+		URL     string
+		Token   string
+		Field   string
+		Check   func(error) bool
+		Message string
+	}{
+		{"unauthorized", search.URL, "wrong-token", "Id", func(err error) bool {
+			return errors.Is(err, ErrUnauthorized)
+		}, "Bad AccessToken"},
+		{"server", fatal.URL, AccessToken, "Id", func(err error) bool {
+			return errors.Is(err, ErrServer)
+		}, "SearchServer fatal error"},
+		{"bad order field", search.URL, AccessToken, "About", func(err error) bool {
+			var e *BadOrderFieldError
+			return errors.As(err, &e) && e.Field == "About"
+		}, "OrderFeld About invalid"},
+		{"timeout", slow.URL, AccessToken, "Id", func(err error) bool {
+			var e *TimeoutError
+			var netErr net.Error
+			return errors.As(err, &e) && e.Err != nil &&
+				errors.As(err, &netErr) && netErr.Timeout() && netErr.Temporary()
+		}, "timeout for limit=2&offset=0&order_by=0&order_field=Id&query="},
+	}
+
+	for _, item := range cases {
+		c := &SearchClient{
+			URL:         item.URL,
+			AccessToken: item.Token,
+			HTTPClient:  &http.Client{Timeout: 50 * time.Millisecond},
+		}
+		_, err := c.FindUsers(SearchRequest{Limit: 1, OrderField: item.Field})
+		if err == nil || !item.Check(err) {
+			t.Errorf("[%s] wrong error type %#v", item.Name, err)
+			continue
+		}
+		if err.Error() != item.Message {
+			t.Errorf("[%s] expected message %q, got %q", item.Name, item.Message, err.Error())
+		}
+	}
+}
+
+func TestWrappedErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`json`))
+	}))
+	defer ts.Close()
+
+	c := &SearchClient{
+		URL:         ts.URL,
+		AccessToken: AccessToken,
+	}
+	_, err := c.FindUsers(SearchRequest{Limit: 1, OrderField: "Id"})
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("expected wrapped *json.SyntaxError, got %#v", err)
+	}
+}
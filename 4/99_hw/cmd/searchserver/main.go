@@ -0,0 +1,41 @@
+// searchserver - SearchServer отдельным процессом:
+//
+//	go run ./cmd/searchserver -data dataset.xml -token secret
+//
+// Файл .jsonl читается как jsonl, остальные - как xml
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"hw4/searchserver"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	data := flag.String("data", "dataset.xml", "path to dataset.xml or users.jsonl")
+	token := flag.String("token", "", "AccessToken, empty - no auth")
+	reload := flag.Duration("reload", time.Second, "how often to check dataset for changes, 0 - never")
+	flag.Parse()
+
+	open := searchserver.NewXMLSource
+	if strings.HasSuffix(*data, ".jsonl") {
+		open = searchserver.NewJSONLSource
+	}
+	src, err := open(*data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *reload > 0 {
+		go src.Watch(context.Background(), *reload)
+	}
+	s := searchserver.NewServer(src, *token)
+
+	log.Printf("searching %s on %s", *data, *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
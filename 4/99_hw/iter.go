@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// UserIterator - обход всех найденных пользователей без ручного цикла по Offset и NextPage.
+// Страницы запрашиваются по мере чтения:
+//
+//	it := srv.Iter(ctx, SearchRequest{Query: "Boyd", OrderField: "Id"})
+//	defer it.Close()
+//	for it.Next() {
+//		user := it.User()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type UserIterator struct {
+	srv    *SearchClient
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	req SearchRequest
+	// want - сколько пользователей ещё запросить, -1 - без ограничения
+	want int
+	done bool
+
+	page []User
+	pos  int
+	user User
+	err  error
+
+	// pending - страница, которую уже запросили заранее
+	pending chan pageResult
+}
+
+type pageResult struct {
+	res *SearchResponse
+	err error
+}
+
+// Iter обходит результаты поиска начиная с req.Offset. req.Limit здесь - сколько пользователей
+// вернуть всего, а не размер страницы, 0 - все. Страницы запрашиваются по maxPageSize
+func (srv *SearchClient) Iter(ctx context.Context, req SearchRequest) *UserIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	it := &UserIterator{
+		srv:    srv,
+		ctx:    ctx,
+		cancel: cancel,
+		req:    req,
+		want:   req.Limit,
+	}
+	switch {
+	case req.Limit < 0:
+		it.err = fmt.Errorf("limit must be > 0")
+	case req.Limit == 0:
+		it.want = -1
+	}
+	return it
+}
+
+// Next переходит к следующему пользователю, false - пользователи кончились или случилась ошибка
+func (it *UserIterator) Next() bool {
+	for it.err == nil {
+		if it.pos < len(it.page) {
+			it.user = it.page[it.pos]
+			it.pos++
+			return true
+		}
+		if it.done {
+			it.cancel()
+			return false
+		}
+
+		res, err := it.fetch()
+		if err != nil {
+			it.err = err
+			it.cancel()
+			return false
+		}
+		it.page, it.pos = res.Users, 0
+		it.req.Offset += len(res.Users)
+		if it.want > 0 {
+			it.want -= len(res.Users)
+		}
+		it.done = !res.NextPage || len(res.Users) == 0 || it.want == 0
+
+		if it.srv.Prefetch && !it.done {
+			it.prefetch()
+		}
+	}
+	return false
+}
+
+// User - текущий пользователь, валиден после Next, вернувшего true
+func (it *UserIterator) User() User {
+	return it.user
+}
+
+// Err - ошибка, на которой остановился обход
+func (it *UserIterator) Err() error {
+	return it.err
+}
+
+// Close прерывает обход и запрос страницы, если он ещё идёт. После полного обхода вызывать не обязательно
+func (it *UserIterator) Close() {
+	it.done = true
+	it.page = nil
+	it.cancel()
+}
+
+func (it *UserIterator) fetch() (*SearchResponse, error) {
+	if it.pending != nil {
+		r := <-it.pending
+		it.pending = nil
+		return r.res, r.err
+	}
+	return it.srv.FindUsersCtx(it.ctx, it.pageRequest())
+}
+
+func (it *UserIterator) prefetch() {
+	// канал с буфером: если обход закроют раньше, горутина не повиснет на записи
+	it.pending = make(chan pageResult, 1)
+	go func(req SearchRequest, pending chan<- pageResult) {
+		res, err := it.srv.FindUsersCtx(it.ctx, req)
+		pending <- pageResult{res, err}
+	}(it.pageRequest(), it.pending)
+}
+
+func (it *UserIterator) pageRequest() SearchRequest {
+	req := it.req
+	req.Limit = maxPageSize
+	if it.want > 0 && it.want < maxPageSize {
+		req.Limit = it.want
+	}
+	return req
+}
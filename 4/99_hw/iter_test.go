@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// countingServer - SearchServer, который считает запросы и может сломаться на запросе fail
+func countingServer(fail int32) (*httptest.Server, *int32) {
+	calls := new(int32)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) == fail {
+			serverError(w, r)
+			return
+		}
+		SearchServer(w, r)
+	}))
+	return ts, calls
+}
+
+func collect(it *UserIterator) []int {
+	ids := []int{}
+	for it.Next() {
+		ids = append(ids, it.User().Id)
+	}
+	return ids
+}
+
+func idRange(from, to int) []int {
+	ids := []int{}
+	for i := from; i < to; i++ {
+		ids = append(ids, i)
+	}
+	return ids
+}
+
+func TestIter(t *testing.T) {
+	cases := []struct {
+		Limit  int
+		Offset int
+		IDs    []int
+		Calls  int32
+	}{
+		{0, 0, idRange(0, 35), 2},
+		{30, 0, idRange(0, 30), 2},
+		{25, 0, idRange(0, 25), 1},
+		{10, 30, idRange(30, 35), 1},
+		{0, 10, idRange(10, 35), 1},
+		{0, 40, []int{}, 1},
+	}
+
+	for _, prefetch := range []bool{false, true} {
+		for i, item := range cases {
+			ts, calls := countingServer(0)
+			c := &SearchClient{
+				URL:         ts.URL,
+				AccessToken: AccessToken,
+				Prefetch:    prefetch,
+			}
+			it := c.Iter(context.Background(), SearchRequest{
+				Limit:      item.Limit,
+				Offset:     item.Offset,
+				OrderField: "Id",
+				OrderBy:    OrderByAsc,
+			})
+			ids := collect(it)
+			ts.Close()
+
+			name := strconv.Itoa(i)
+			if prefetch {
+				name += " prefetch"
+			}
+			if err := it.Err(); err != nil {
+				t.Errorf("[%s] unexpected error %v", name, err)
+			}
+			if !equalIDs(ids, item.IDs) {
+				t.Errorf("[%s] expected ids %v, got %v", name, item.IDs, ids)
+			}
+			if got := atomic.LoadInt32(calls); got != item.Calls {
+				t.Errorf("[%s] expected %d calls, got %d", name, item.Calls, got)
+			}
+		}
+	}
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIterError(t *testing.T) {
+	for _, prefetch := range []bool{false, true} {
+		ts, _ := countingServer(2)
+		c := &SearchClient{
+			URL:         ts.URL,
+			AccessToken: AccessToken,
+			Prefetch:    prefetch,
+		}
+		it := c.Iter(context.Background(), SearchRequest{OrderField: "Id", OrderBy: OrderByAsc})
+		ids := collect(it)
+		ts.Close()
+
+		// первая страница успевает прочитаться, на второй - ошибка
+		if !equalIDs(ids, idRange(0, 25)) {
+			t.Errorf("[prefetch=%v] expected first page, got %v", prefetch, ids)
+		}
+		if !errors.Is(it.Err(), ErrServer) {
+			t.Errorf("[prefetch=%v] expected ErrServer, got %v", prefetch, it.Err())
+		}
+		if it.Next() {
+			t.Errorf("[prefetch=%v] Next after error must be false", prefetch)
+		}
+	}
+}
+
+func TestIterBadLimit(t *testing.T) {
+	c := &SearchClient{URL: "http://search.local/", AccessToken: AccessToken}
+	it := c.Iter(context.Background(), SearchRequest{Limit: -1, OrderField: "Id"})
+	if it.Next() || it.Err() == nil {
+		t.Errorf("expected limit error, got %v", it.Err())
+	}
+}
+
+func TestIterClose(t *testing.T) {
+	ts, calls := countingServer(0)
+	defer ts.Close()
+	c := &SearchClient{
+		URL:         ts.URL,
+		AccessToken: AccessToken,
+		Prefetch:    true,
+	}
+	it := c.Iter(context.Background(), SearchRequest{OrderField: "Id", OrderBy: OrderByAsc})
+	if !it.Next() || it.User().Id != 0 {
+		t.Fatalf("expected first user, got %v, %v", it.User(), it.Err())
+	}
+	it.Close()
+	if it.Next() {
+		t.Errorf("Next after Close must be false, got %v", it.User())
+	}
+	if got := atomic.LoadInt32(calls); got > 2 {
+		t.Errorf("expected at most 2 calls, got %d", got)
+	}
+}
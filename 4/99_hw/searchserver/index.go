@@ -0,0 +1,161 @@
+package searchserver
+
+import (
+	"sort"
+	"strings"
+)
+
+// index - пользователи и всё, что нужно, чтобы искать по ним без перебора и сортировки на каждый запрос:
+// триграммы из Name и About и заранее отсортированные порядки по каждому полю
+type index struct {
+	users []User
+	// trigrams - триграмма -> номера пользователей, у которых она есть в Name или About, по возрастанию
+	trigrams map[string][]int
+	// orders - поле и направление -> номера пользователей в этом порядке
+	orders map[orderKey][]int
+}
+
+type orderKey struct {
+	field string
+	by    int
+}
+
+// compare - поля, по которым можно сортировать
+var compare = map[string]func(a, b *User) int{
+	"Id":   func(a, b *User) int { return a.Id - b.Id },
+	"Age":  func(a, b *User) int { return a.Age - b.Age },
+	"Name": func(a, b *User) int { return strings.Compare(a.Name, b.Name) },
+}
+
+func newIndex(users []User) *index {
+	idx := &index{
+		users:    users,
+		trigrams: map[string][]int{},
+		orders:   map[orderKey][]int{},
+	}
+
+	for i := range users {
+		seen := map[string]bool{}
+		for _, s := range []string{users[i].Name, users[i].About} {
+			for j := 0; j+3 <= len(s); j++ {
+				tri := s[j : j+3]
+				if !seen[tri] {
+					seen[tri] = true
+					idx.trigrams[tri] = append(idx.trigrams[tri], i)
+				}
+			}
+		}
+	}
+
+	for field, cmp := range compare {
+		for _, by := range []int{OrderByAsc, OrderByDesc} {
+			idx.orders[orderKey{field, by}] = sortedOrder(users, cmp, by)
+		}
+	}
+	return idx
+}
+
+// sortedOrder - номера пользователей по полю, при равенстве - по Id по возрастанию,
+// чтобы порядок не зависел от порядка записей в файле
+func sortedOrder(users []User, cmp func(a, b *User) int, by int) []int {
+	order := make([]int, len(users))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := &users[order[i]], &users[order[j]]
+		c := cmp(a, b)
+		if by == OrderByDesc {
+			c = -c
+		}
+		if c == 0 {
+			return a.Id < b.Id
+		}
+		return c < 0
+	})
+	return order
+}
+
+// candidates - номера пользователей, у которых могут быть все триграммы запроса.
+// nil - запрос короче триграммы, подходит кто угодно
+func (idx *index) candidates(query string) []bool {
+	if len(query) < 3 {
+		return nil
+	}
+	res := make([]bool, len(idx.users))
+	var lists [][]int
+	for j := 0; j+3 <= len(query); j++ {
+		list, ok := idx.trigrams[query[j:j+3]]
+		if !ok {
+			// такой триграммы нет ни у кого - пустой результат
+			return res
+		}
+		lists = append(lists, list)
+	}
+	// пересекаем, начиная с самого короткого списка: результат не длиннее него и дальше только сжимается
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	common := lists[0]
+	for _, list := range lists[1:] {
+		if len(common) == 0 {
+			break
+		}
+		common = intersect(common, list)
+	}
+	for _, i := range common {
+		res[i] = true
+	}
+	return res
+}
+
+// intersect - общие номера двух возрастающих списков, тоже по возрастанию
+func intersect(a, b []int) []int {
+	res := make([]int, 0, len(a))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			res = append(res, a[i])
+			i++
+			j++
+		}
+	}
+	return res
+}
+
+func (idx *index) match(i int, query string) bool {
+	u := &idx.users[i]
+	return strings.Contains(u.Name, query) || strings.Contains(u.About, query)
+}
+
+func (idx *index) search(q Query) []User {
+	var order []int
+	if q.OrderBy != OrderByAsIs {
+		order = idx.orders[orderKey{q.OrderField, q.OrderBy}]
+	}
+	candidates := idx.candidates(q.Query)
+
+	res := []User{}
+	skip := q.Offset
+	for n := 0; n < len(idx.users) && len(res) < q.Limit; n++ {
+		i := n
+		if order != nil {
+			i = order[n]
+		}
+		if candidates != nil && !candidates[i] {
+			continue
+		}
+		// триграммы есть все, но могут стоять не подряд или быть в разных полях - проверяем честно
+		if q.Query != "" && !idx.match(i, q.Query) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		res = append(res, idx.users[i])
+	}
+	return res
+}
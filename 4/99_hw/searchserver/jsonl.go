@@ -0,0 +1,32 @@
+package searchserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// readJSONL - по объекту User на строку, пустые строки пропускаются
+func readJSONL(r io.Reader) ([]User, error) {
+	scanner := bufio.NewScanner(r)
+	// about бывает длинным, стандартных 64К на строку может не хватить
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	users := []User{}
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		u := User{}
+		if err := json.Unmarshal(data, &u); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		users = append(users, u)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
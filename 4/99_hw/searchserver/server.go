@@ -0,0 +1,165 @@
+// Package searchserver - внешняя система для SearchClient: ищет пользователей в dataset.xml
+// или в другом UserSource - jsonl-файле, sql-таблице.
+//
+// Файлы читаются один раз и индексируются, запросы идут по индексу в памяти.
+// Контракт тот же, что ждёт клиент: GET-параметры query, order_field, order_by, limit, offset,
+// токен в хедере AccessToken, ответ - json-массив пользователей или {"Error": "..."} с 400
+package searchserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	OrderByAsc  = -1
+	OrderByAsIs = 0
+	OrderByDesc = 1
+)
+
+// коды ошибок в ответе 400, ErrorBadOrderField клиент узнаёт и отдаёт как BadOrderFieldError
+const (
+	ErrorBadOrderField = "ErrorBadOrderField"
+	ErrorBadOrderBy    = "ErrorBadOrderBy"
+	ErrorBadLimit      = "ErrorBadLimit"
+	ErrorBadOffset     = "ErrorBadOffset"
+)
+
+type User struct {
+	Id     int
+	Name   string
+	Age    int
+	About  string
+	Gender string
+}
+
+// Query - параметры поиска. Query ищется подстрокой в Name и About, пустой подходит всем.
+// OrderField - Id, Age или Name, пустой - Name
+type Query struct {
+	Query      string
+	OrderField string
+	OrderBy    int
+	Limit      int
+	Offset     int
+}
+
+// QueryError - параметр запроса с неверным значением, Code уходит клиенту в поле Error
+type QueryError struct {
+	Code string
+}
+
+func (e *QueryError) Error() string {
+	return e.Code
+}
+
+type Server struct {
+	// AccessToken - с каким токеном пускать, пустой - пускать всех
+	AccessToken string
+	Source      UserSource
+	// ErrorLog - куда писать ошибки источника, по умолчанию log.Printf
+	ErrorLog func(format string, args ...interface{})
+}
+
+// New - сервер поверх dataset.xml из path
+func New(path, accessToken string) (*Server, error) {
+	src, err := NewXMLSource(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(src, accessToken), nil
+}
+
+func NewServer(src UserSource, accessToken string) *Server {
+	return &Server{
+		AccessToken: accessToken,
+		Source:      src,
+	}
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// Search проверяет параметры и ищет в Source
+func (s *Server) Search(ctx context.Context, q Query) ([]User, error) {
+	if q.OrderField == "" {
+		q.OrderField = "Name"
+	}
+	if _, ok := compare[q.OrderField]; !ok {
+		return nil, &QueryError{ErrorBadOrderField}
+	}
+	switch q.OrderBy {
+	case OrderByAsc, OrderByAsIs, OrderByDesc:
+	default:
+		return nil, &QueryError{ErrorBadOrderBy}
+	}
+	if q.Limit < 0 {
+		return nil, &QueryError{ErrorBadLimit}
+	}
+	if q.Offset < 0 {
+		return nil, &QueryError{ErrorBadOffset}
+	}
+
+	return s.Source.Search(ctx, q)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.AccessToken != "" && r.Header.Get("AccessToken") != s.AccessToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	params := r.URL.Query()
+	q := Query{
+		Query:      params.Get("query"),
+		OrderField: params.Get("order_field"),
+	}
+	var err error
+	if q.OrderBy, err = intParam(params.Get("order_by"), ErrorBadOrderBy); err == nil {
+		if q.Limit, err = intParam(params.Get("limit"), ErrorBadLimit); err == nil {
+			q.Offset, err = intParam(params.Get("offset"), ErrorBadOffset)
+		}
+	}
+
+	var users []User
+	if err == nil {
+		users, err = s.Search(r.Context(), q)
+	}
+	if err != nil {
+		qe := &QueryError{}
+		if errors.As(err, &qe) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"Error": qe.Code})
+			return
+		}
+		s.logf("searchserver: search %s: %v", r.URL.RawQuery, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+// intParam - пустой параметр это 0, как если бы его не передали
+func intParam(value, code string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &QueryError{code}
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
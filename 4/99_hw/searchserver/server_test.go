@@ -0,0 +1,213 @@
+package searchserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const dataset = "../dataset.xml"
+
+// naiveSearch - то же самое перебором, с ним сверяется индекс
+func naiveSearch(users []User, q Query) []User {
+	res := []User{}
+	for _, u := range users {
+		if strings.Contains(u.Name, q.Query) || strings.Contains(u.About, q.Query) {
+			res = append(res, u)
+		}
+	}
+	if q.OrderBy != OrderByAsIs {
+		field := q.OrderField
+		if field == "" {
+			field = "Name"
+		}
+		sort.SliceStable(res, func(i, j int) bool {
+			c := compare[field](&res[i], &res[j])
+			if q.OrderBy == OrderByDesc {
+				c = -c
+			}
+			if c == 0 {
+				return res[i].Id < res[j].Id
+			}
+			return c < 0
+		})
+	}
+	if q.Offset >= len(res) {
+		return []User{}
+	}
+	res = res[q.Offset:]
+	if len(res) > q.Limit {
+		res = res[:q.Limit]
+	}
+	return res
+}
+
+func TestSearch(t *testing.T) {
+	s, err := New(dataset, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	users, err := readXML(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queries := []string{"", "a", "Bo", "Boyd", "Wolf", "Boyd Wolf", "nulla", "Nulla cillum", "quis", "zzz", "d W"}
+	fields := []string{"", "Id", "Age", "Name"}
+	orders := []int{OrderByAsc, OrderByAsIs, OrderByDesc}
+	pages := [][2]int{{0, 0}, {5, 0}, {26, 0}, {10, 3}, {100, 30}}
+
+	for _, query := range queries {
+		for _, field := range fields {
+			for _, by := range orders {
+				for _, page := range pages {
+					q := Query{Query: query, OrderField: field, OrderBy: by, Limit: page[0], Offset: page[1]}
+					got, err := s.Search(context.Background(), q)
+					if err != nil {
+						t.Fatalf("%+v: %v", q, err)
+					}
+					if expected := naiveSearch(users, q); !reflect.DeepEqual(got, expected) {
+						t.Errorf("%+v: expected %v, got %v", q, ids(expected), ids(got))
+					}
+				}
+			}
+		}
+	}
+}
+
+func ids(users []User) []int {
+	res := []int{}
+	for _, u := range users {
+		res = append(res, u.Id)
+	}
+	return res
+}
+
+func TestIntersect(t *testing.T) {
+	cases := []struct {
+		A, B, Expected []int
+	}{
+		{[]int{1, 3, 5, 7}, []int{2, 3, 4, 7, 9}, []int{3, 7}},
+		{[]int{1, 2}, []int{3, 4}, []int{}},
+		{[]int{}, []int{1}, []int{}},
+		{[]int{0, 1, 2}, []int{0, 1, 2}, []int{0, 1, 2}},
+	}
+	for _, item := range cases {
+		if got := intersect(item.A, item.B); !reflect.DeepEqual(got, item.Expected) {
+			t.Errorf("intersect(%v, %v): expected %v, got %v", item.A, item.B, item.Expected, got)
+		}
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	s, err := New(dataset, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		Query Query
+		Code  string
+	}{
+		{Query{OrderField: "About"}, ErrorBadOrderField},
+		{Query{OrderBy: 2}, ErrorBadOrderBy},
+		{Query{Limit: -1}, ErrorBadLimit},
+		{Query{Offset: -1}, ErrorBadOffset},
+	}
+	for _, item := range cases {
+		_, err := s.Search(context.Background(), item.Query)
+		qe := &QueryError{}
+		if !errors.As(err, &qe) || qe.Code != item.Code {
+			t.Errorf("%+v: expected %s, got %v", item.Query, item.Code, err)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	s, err := New(dataset, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	cases := []struct {
+		Query  string
+		Token  string
+		Status int
+		Body   string
+		IDs    []int
+	}{
+		{"limit=3&order_field=Id&order_by=1", "token", http.StatusOK, "", []int{34, 33, 32}},
+		{"limit=2&offset=1&order_field=Age&order_by=-1&query=Boyd", "token", http.StatusOK, "", []int{}},
+		{"limit=2&query=Boyd", "token", http.StatusOK, "", []int{0}},
+		{"limit=2", "wrong", http.StatusUnauthorized, "", nil},
+		{"limit=2&order_field=About", "token", http.StatusBadRequest, `{"Error":"ErrorBadOrderField"}`, nil},
+		{"limit=x", "token", http.StatusBadRequest, `{"Error":"ErrorBadLimit"}`, nil},
+		{"offset=x", "token", http.StatusBadRequest, `{"Error":"ErrorBadOffset"}`, nil},
+		{"order_by=x", "token", http.StatusBadRequest, `{"Error":"ErrorBadOrderBy"}`, nil},
+	}
+	for _, item := range cases {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"?"+item.Query, nil)
+		req.Header.Set("AccessToken", item.Token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != item.Status {
+			t.Errorf("[%s] expected status %d, got %d", item.Query, item.Status, resp.StatusCode)
+			continue
+		}
+		if item.Body != "" && strings.TrimSpace(string(body)) != item.Body {
+			t.Errorf("[%s] expected body %s, got %s", item.Query, item.Body, body)
+		}
+		if item.IDs == nil {
+			continue
+		}
+		users := []User{}
+		if err := json.Unmarshal(body, &users); err != nil {
+			t.Fatalf("[%s] %v", item.Query, err)
+		}
+		if got := ids(users); !reflect.DeepEqual(got, item.IDs) {
+			t.Errorf("[%s] expected ids %v, got %v", item.Query, item.IDs, got)
+		}
+	}
+}
+
+type failingSource struct{}
+
+func (failingSource) Search(ctx context.Context, q Query) ([]User, error) {
+	return nil, errors.New("db is down")
+}
+
+func TestServeHTTPSourceError(t *testing.T) {
+	var logged string
+	s := NewServer(failingSource{}, "")
+	s.ErrorLog = func(format string, args ...interface{}) {
+		logged = fmt.Sprintf(format, args...)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?limit=1", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", rec.Code)
+	}
+	if !strings.Contains(logged, "db is down") {
+		t.Errorf("source error was not logged: %q", logged)
+	}
+}
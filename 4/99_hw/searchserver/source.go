@@ -0,0 +1,121 @@
+package searchserver
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// UserSource - откуда сервер берёт пользователей. Query приходит уже проверенный:
+// OrderField - одно из Id, Age, Name, OrderBy - одна из констант OrderBy*, Limit и Offset не отрицательные.
+// Все реализации должны отвечать одинаково, это проверяет source_test.go
+type UserSource interface {
+	Search(ctx context.Context, q Query) ([]User, error)
+}
+
+// FileSource - пользователи из файла, который читается целиком и индексируется в памяти.
+// Формат задаёт parse: NewXMLSource, NewJSONLSource
+type FileSource struct {
+	// ErrorLog - куда писать ошибки перечитывания файла в Watch, по умолчанию log.Printf
+	ErrorLog func(format string, args ...interface{})
+
+	path  string
+	parse func(io.Reader) ([]User, error)
+
+	mu      sync.RWMutex
+	idx     *index
+	modTime time.Time
+	size    int64
+}
+
+func newFileSource(path string, parse func(io.Reader) ([]User, error)) (*FileSource, error) {
+	s := &FileSource{
+		path:  path,
+		parse: parse,
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewXMLSource читает dataset.xml: записи <row>, Name собирается из first_name и last_name
+func NewXMLSource(path string) (*FileSource, error) {
+	return newFileSource(path, readXML)
+}
+
+// NewJSONLSource читает по одному json-объекту User на строку
+func NewJSONLSource(path string) (*FileSource, error) {
+	return newFileSource(path, readJSONL)
+}
+
+// Reload перечитывает файл. Если он битый, остаются старые данные
+func (s *FileSource) Reload() error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	users, err := s.parse(f)
+	if err != nil {
+		return err
+	}
+	idx := newIndex(users)
+
+	s.mu.Lock()
+	s.idx, s.modTime, s.size = idx, info.ModTime(), info.Size()
+	s.mu.Unlock()
+	return nil
+}
+
+// Watch раз в interval проверяет, не поменялся ли файл, и перечитывает его. Работает до отмены ctx
+func (s *FileSource) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !s.changed() {
+			continue
+		}
+		if err := s.Reload(); err != nil {
+			s.logf("searchserver: reload %s: %v", s.path, err)
+		}
+	}
+}
+
+func (s *FileSource) changed() bool {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		s.logf("searchserver: stat %s: %v", s.path, err)
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !info.ModTime().Equal(s.modTime) || info.Size() != s.size
+}
+
+func (s *FileSource) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+func (s *FileSource) Search(ctx context.Context, q Query) ([]User, error) {
+	s.mu.RLock()
+	idx := s.idx
+	s.mu.RUnlock()
+	return idx.search(q), nil
+}
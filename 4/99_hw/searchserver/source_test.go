@@ -0,0 +1,257 @@
+package searchserver
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// fixture - одинаковые возраст и имена, чтобы проверить порядок при равенстве,
+// и подстроки, которые встречаются и в Name, и в About
+var fixture = []User{
+	{Id: 4, Name: "Boyd Wolf", Age: 22, About: "Nulla cillum enim", Gender: "male"},
+	{Id: 1, Name: "Hilda Mayer", Age: 21, About: "Sit commodo consectetur Wolf", Gender: "female"},
+	{Id: 7, Name: "Brooks Aguilar", Age: 25, About: "Velit ullamco est", Gender: "male"},
+	{Id: 2, Name: "Boyd Wolf", Age: 30, About: "amet commodo", Gender: "male"},
+	{Id: 9, Name: "Owen Lynn", Age: 22, About: "Elit anim elit commodo", Gender: "male"},
+	{Id: 3, Name: "Beulah Stark", Age: 30, About: "nulla dolore", Gender: "female"},
+	{Id: 5, Name: "Annie Osborn", Age: 25, About: "Consequat fugiat veniam", Gender: "female"},
+	{Id: 8, Name: "Glenn Jordan", Age: 29, About: "Duis reprehenderit Nulla", Gender: "male"},
+	{Id: 6, Name: "Jennings Mays", Age: 39, About: "", Gender: "male"},
+	{Id: 10, Name: "Cohen Hines", Age: 21, About: "Deserunt sint wolf", Gender: "male"},
+}
+
+func writeXMLFixture(t *testing.T, dir string, users []User) string {
+	type row struct {
+		Id        int    `xml:"id"`
+		FirstName string `xml:"first_name"`
+		LastName  string `xml:"last_name"`
+		Age       int    `xml:"age"`
+		About     string `xml:"about"`
+		Gender    string `xml:"gender"`
+	}
+	root := struct {
+		XMLName xml.Name `xml:"root"`
+		Rows    []row    `xml:"row"`
+	}{}
+	for _, u := range users {
+		parts := strings.SplitN(u.Name, " ", 2)
+		root.Rows = append(root.Rows, row{u.Id, parts[0], parts[1], u.Age, u.About, u.Gender})
+	}
+	data, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "dataset.xml")
+	if err := ioutil.WriteFile(path, append([]byte(xml.Header), data...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writeJSONLFixture(t *testing.T, dir string, users []User) string {
+	b := &strings.Builder{}
+	for _, u := range users {
+		data, _ := json.Marshal(u)
+		b.Write(data)
+		b.WriteString("\n\n")
+	}
+	path := filepath.Join(dir, "users.jsonl")
+	if err := ioutil.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func openSQLFixture(t *testing.T, users []User) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// у каждого соединения :memory: своя база
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE users (
+		id     INTEGER PRIMARY KEY,
+		pos    INTEGER NOT NULL,
+		name   TEXT NOT NULL,
+		age    INTEGER NOT NULL,
+		about  TEXT NOT NULL,
+		gender TEXT NOT NULL
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, u := range users {
+		_, err := db.Exec("INSERT INTO users (id, pos, name, age, about, gender) VALUES (?, ?, ?, ?, ?, ?)",
+			u.Id, i, u.Name, u.Age, u.About, u.Gender)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestSourceConformance(t *testing.T) {
+	dir := t.TempDir()
+	xmlSource, err := NewXMLSource(writeXMLFixture(t, dir, fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonlSource, err := NewJSONLSource(writeJSONLFixture(t, dir, fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources := []struct {
+		Name   string
+		Source UserSource
+	}{
+		{"xml", xmlSource},
+		{"jsonl", jsonlSource},
+		{"sql", NewSQLSource(openSQLFixture(t, fixture), "users")},
+	}
+
+	queries := []string{"", "o", "Boyd", "Wolf", "wolf", "commodo", "Nulla", "d W", "zzz", "'; DROP TABLE users; --"}
+	fields := []string{"Id", "Age", "Name"}
+	orders := []int{OrderByAsc, OrderByAsIs, OrderByDesc}
+	pages := [][2]int{{0, 0}, {3, 0}, {3, 2}, {25, 0}, {5, 8}, {5, 20}}
+
+	for _, src := range sources {
+		for _, query := range queries {
+			for _, field := range fields {
+				for _, by := range orders {
+					for _, page := range pages {
+						q := Query{Query: query, OrderField: field, OrderBy: by, Limit: page[0], Offset: page[1]}
+						got, err := src.Source.Search(context.Background(), q)
+						if err != nil {
+							t.Fatalf("[%s] %+v: %v", src.Name, q, err)
+						}
+						if expected := naiveSearch(fixture, q); !reflect.DeepEqual(got, expected) {
+							t.Errorf("[%s] %+v: expected %v, got %v", src.Name, q, ids(expected), ids(got))
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.jsonl")
+	if err := ioutil.WriteFile(broken, []byte("{\"Id\": 1}\n{\"Id\": \"x\"}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewJSONLSource(broken); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected error on line 2, got %v", err)
+	}
+	if _, err := NewXMLSource(filepath.Join(dir, "missing.xml")); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+
+	db := openSQLFixture(t, fixture)
+	src := NewSQLSource(db, "missing")
+	if _, err := src.Search(context.Background(), Query{OrderField: "Id", Limit: 1}); err == nil {
+		t.Errorf("expected error for missing table")
+	}
+	// колонка не того типа - ошибка Scan
+	if _, err := db.Exec("CREATE TABLE bad (id TEXT, name TEXT, age TEXT, about TEXT, gender TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO bad VALUES ('x', 'a', 'b', 'c', 'd')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSQLSource(db, "bad").Search(context.Background(), Query{OrderField: "Id", Limit: 1}); err == nil {
+		t.Errorf("expected scan error")
+	}
+}
+
+const smallDataset = `<?xml version="1.0" encoding="UTF-8" ?>
+<root>
+  <row>
+    <id>7</id>
+    <age>30</age>
+    <first_name>Only</first_name>
+    <last_name>One</last_name>
+    <gender>male</gender>
+    <about>reloaded</about>
+  </row>
+</root>
+`
+
+func TestReload(t *testing.T) {
+	data, err := ioutil.ReadFile(dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "dataset.xml")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewXMLSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logged := make(chan string, 10)
+	s.ErrorLog = func(format string, args ...interface{}) {
+		select {
+		case logged <- format:
+		default:
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Watch(ctx, 10*time.Millisecond)
+
+	all := Query{OrderField: "Id", Limit: 100}
+	// битый файл - ошибка в лог, данные остаются старые
+	if err := ioutil.WriteFile(path, []byte("<root><row>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-logged:
+	case <-time.After(2 * time.Second):
+		t.Fatal("broken file was not reported")
+	}
+	if res, _ := s.Search(ctx, all); len(res) != 35 {
+		t.Fatalf("expected old 35 users after broken reload, got %d", len(res))
+	}
+
+	if err := ioutil.WriteFile(path, []byte(smallDataset), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		res, _ := s.Search(ctx, all)
+		if len(res) == 1 && res[0].Name == "Only One" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("file was not reloaded, got %d users", len(res))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err == nil {
+		t.Errorf("expected error for removed file")
+	}
+	if _, err := New(path, ""); err == nil {
+		t.Errorf("expected error for removed file")
+	}
+}
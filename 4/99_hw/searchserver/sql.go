@@ -0,0 +1,84 @@
+package searchserver
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// sqlColumns - поля Query.OrderField в колонки таблицы. Имя колонки в запрос попадает только отсюда,
+// всё, что пришло от клиента, уходит плейсхолдерами
+var sqlColumns = map[string]string{
+	"Id":   "id",
+	"Age":  "age",
+	"Name": "name",
+}
+
+// SQLSource - пользователи из таблицы вида
+//
+//	CREATE TABLE users (
+//		id     INTEGER PRIMARY KEY,
+//		pos    INTEGER NOT NULL,
+//		name   TEXT NOT NULL,
+//		age    INTEGER NOT NULL,
+//		about  TEXT NOT NULL,
+//		gender TEXT NOT NULL
+//	)
+//
+// Запрос переводится в один SELECT с плейсхолдерами ?, который понимают и SQLite, и MySQL.
+// Подстрока ищется через instr, так что в MySQL для поиска с учётом регистра, как у остальных
+// источников, колонкам name и about нужна бинарная collation (utf8mb4_bin).
+// pos - порядковый номер записи, как в исходном файле: у таблицы своего порядка нет,
+// а OrderByAsIs у всех источников - порядок записей в исходных данных
+type SQLSource struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLSource - table подставляется в запрос как есть, это имя из конфига, а не от клиента
+func NewSQLSource(db *sql.DB, table string) *SQLSource {
+	return &SQLSource{db: db, table: table}
+}
+
+func (s *SQLSource) Search(ctx context.Context, q Query) ([]User, error) {
+	query, args := s.buildQuery(q)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		u := User{}
+		if err := rows.Scan(&u.Id, &u.Name, &u.Age, &u.About, &u.Gender); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLSource) buildQuery(q Query) (string, []interface{}) {
+	b := &strings.Builder{}
+	args := []interface{}{}
+
+	b.WriteString("SELECT id, name, age, about, gender FROM " + s.table)
+	if q.Query != "" {
+		b.WriteString(" WHERE instr(name, ?) > 0 OR instr(about, ?) > 0")
+		args = append(args, q.Query, q.Query)
+	}
+
+	switch q.OrderBy {
+	case OrderByAsc:
+		b.WriteString(" ORDER BY " + sqlColumns[q.OrderField] + " ASC, id ASC")
+	case OrderByDesc:
+		b.WriteString(" ORDER BY " + sqlColumns[q.OrderField] + " DESC, id ASC")
+	default:
+		b.WriteString(" ORDER BY pos, id")
+	}
+
+	b.WriteString(" LIMIT ? OFFSET ?")
+	args = append(args, q.Limit, q.Offset)
+	return b.String(), args
+}
@@ -0,0 +1,46 @@
+package searchserver
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+type userXML struct {
+	Id        int    `xml:"id"`
+	FirstName string `xml:"first_name"`
+	LastName  string `xml:"last_name"`
+	Age       int    `xml:"age"`
+	About     string `xml:"about"`
+	Gender    string `xml:"gender"`
+}
+
+// readXML читает dataset.xml потоково, по одной записи <row>, не держа в памяти весь документ
+func readXML(r io.Reader) ([]User, error) {
+	decoder := xml.NewDecoder(r)
+	users := []User{}
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			return users, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		row := userXML{}
+		if err := decoder.DecodeElement(&row, &start); err != nil {
+			return nil, err
+		}
+		// Name - это first_name + last_name, отдельно в xml его нет
+		users = append(users, User{
+			Id:     row.Id,
+			Name:   row.FirstName + " " + row.LastName,
+			Age:    row.Age,
+			About:  row.About,
+			Gender: row.Gender,
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 )
 
@@ -26,7 +27,22 @@ const (
 	statusAdmin     = 20
 )
 
+// tokenAuth - аутентификатор по умолчанию: фиксированный токен в заголовке
+type tokenAuth struct {
+	header string
+	token  string
+}
+
+func (a tokenAuth) Authenticate(r *http.Request) (interface{}, error) {
+	if r.Header.Get(a.header) != a.token {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	return a.token, nil
+}
+
+// apigen:auth default {"type": "apiKey", "in": "header", "name": "X-Auth"}
 type MyApi struct {
+	APIRegistry
 	statuses map[string]int
 	users    map[string]*User
 	nextID   uint64
@@ -34,7 +50,7 @@ type MyApi struct {
 }
 
 func NewMyApi() *MyApi {
-	return &MyApi{
+	api := &MyApi{
 		statuses: map[string]int{
 			"user":      0,
 			"moderator": 10,
@@ -51,6 +67,8 @@ func NewMyApi() *MyApi {
 		nextID: 43,
 		mu:     &sync.RWMutex{},
 	}
+	api.RegisterAuth("default", tokenAuth{"X-Auth", "100500"})
+	return api
 }
 
 type ProfileParams struct {
@@ -118,16 +136,39 @@ func (srv *MyApi) Create(ctx context.Context, in CreateParams) (*NewUser, error)
 	return &NewUser{id}, nil
 }
 
+// apigen:api {"url": "/users/{login}", "method": "GET"}
+func (srv *MyApi) Get(ctx context.Context, in ProfileParams) (*User, error) {
+	return srv.Profile(ctx, in)
+}
+
+// apigen:api {"url": "/users/{login}", "auth": true, "method": "DELETE"}
+func (srv *MyApi) Delete(ctx context.Context, in ProfileParams) (*User, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	user, exist := srv.users[in.Login]
+	if !exist {
+		return nil, ApiError{http.StatusNotFound, fmt.Errorf("user not exist")}
+	}
+	delete(srv.users, in.Login)
+
+	return user, nil
+}
+
 // 2-я часть
 // это похожая структура, с теми же методами, но у них другие параметры!
 // код, созданный вашим кодогенератором работает с конкретной струткурой, про другие ничего не знает
 // поэтому то что рядом есть ещё походая структура с такими же методами его нисколько не смущает
 
+// apigen:auth default {"type": "apiKey", "in": "header", "name": "X-Auth"}
 type OtherApi struct {
+	APIRegistry
 }
 
 func NewOtherApi() *OtherApi {
-	return &OtherApi{}
+	api := &OtherApi{}
+	api.RegisterAuth("default", tokenAuth{"X-Auth", "100500"})
+	return api
 }
 
 type OtherCreateParams struct {
@@ -153,3 +194,38 @@ func (srv *OtherApi) Create(ctx context.Context, in OtherCreateParams) (*OtherUs
 		Level:    in.Level,
 	}, nil
 }
+
+type OtherUpdateParams struct {
+	Username string   `apivalidator:"required,regexp=^[a-zA-Z0-9_]+$"`
+	Email    string   `apivalidator:"email"`
+	Code     string   `apivalidator:"len=6"`
+	Zip      string   `apivalidator:"regexp=^[0-9]{3,6}$"`
+	Level    int      `apivalidator:"oneof=1|10|50,default=1"`
+	Tags     []string `apivalidator:"max=3,each=min=2,max=10"`
+	Friends  []int    `apivalidator:"each=min=1"`
+}
+
+// apigen:api {"url": "/user/update", "auth": true, "method": "POST"}
+func (srv *OtherApi) Update(ctx context.Context, in OtherUpdateParams) (*OtherUser, error) {
+	return &OtherUser{
+		ID:       uint64(12 + len(in.Friends)),
+		Login:    in.Username,
+		FullName: strings.Join(in.Tags, " "),
+		Level:    in.Level,
+	}, nil
+}
+
+type OtherMeParams struct{}
+
+// "session" и "requestid" не регистрируются в NewOtherApi - их подставляет тот, кто поднимает сервер
+// apigen:api {"url": "/user/me", "auth": "session", "middleware": ["requestid"]}
+func (srv *OtherApi) Me(ctx context.Context, in OtherMeParams) (*OtherUser, error) {
+	login, ok := Principal(ctx).(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected principal %#v", Principal(ctx))
+	}
+	return &OtherUser{
+		ID:    12,
+		Login: login,
+	}, nil
+}
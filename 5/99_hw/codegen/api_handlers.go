@@ -1,43 +1,324 @@
 package main
 
 import (
-  "encoding/json"
-  "net/http"
-  "strconv"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"codegenhw/models"
 )
 
+var (
+	apigenReOtherUpdateParamsUsername = regexp.MustCompile("^[a-zA-Z0-9_]+$")
+	apigenReOtherUpdateParamsZip      = regexp.MustCompile("^[0-9]{3,6}$")
+	apigenReModelsSearchParamsQuery   = regexp.MustCompile("^[a-z0-9 ]+$")
+)
 
-func (api *MyApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.URL.Path {
-	case "/user/profile":
-		api.handlerMyApiProfile(w, r)
-	case "/user/create":
-		api.handlerMyApiCreate(w, r)
+// Authenticator решает, пускать ли запрос к методу с "auth", и возвращает того, кто его сделал.
+// Ошибка типа ApiError уходит клиенту как есть, любая другая - как 403
+type Authenticator interface {
+	Authenticate(r *http.Request) (principal interface{}, err error)
+}
+
+type AuthenticatorFunc func(r *http.Request) (interface{}, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (interface{}, error) {
+	return f(r)
+}
+
+type Middleware func(http.Handler) http.Handler
+
+// APIRegistry встраивается в структуру api, на которой есть методы с "auth" или "middleware".
+// Имена из apigen:api комментариев резолвятся в то, что зарегистрировали в рантайме
+type APIRegistry struct {
+	mu         sync.RWMutex
+	auth       map[string]Authenticator
+	middleware map[string]Middleware
+}
+
+func (reg *APIRegistry) RegisterAuth(name string, a Authenticator) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.auth == nil {
+		reg.auth = make(map[string]Authenticator)
+	}
+	reg.auth[name] = a
+}
+
+func (reg *APIRegistry) RegisterMiddleware(name string, m Middleware) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.middleware == nil {
+		reg.middleware = make(map[string]Middleware)
+	}
+	reg.middleware[name] = m
+}
+
+type apigenPrincipalKey struct{}
+
+// Principal - тот, кого вернул Authenticator для текущего запроса
+func Principal(ctx context.Context) interface{} {
+	return ctx.Value(apigenPrincipalKey{})
+}
+
+func (reg *APIRegistry) authenticate(name string, r *http.Request) (*http.Request, *ApiError) {
+	reg.mu.RLock()
+	a := reg.auth[name]
+	reg.mu.RUnlock()
+	if a == nil {
+		return r, &ApiError{http.StatusInternalServerError, fmt.Errorf("authenticator %q is not registered", name)}
+	}
+
+	principal, err := a.Authenticate(r)
+	if err != nil {
+		apiErr := ApiError{}
+		if errors.As(err, &apiErr) {
+			return r, &apiErr
+		}
+		return r, &ApiError{http.StatusForbidden, err}
+	}
+	return r.WithContext(context.WithValue(r.Context(), apigenPrincipalKey{}, principal)), nil
+}
+
+// serve оборачивает хендлер в middleware, первый в списке - самый внешний
+func (reg *APIRegistry) serve(w http.ResponseWriter, r *http.Request, names []string, h http.HandlerFunc) {
+	var handler http.Handler = h
+	for i := len(names) - 1; i >= 0; i-- {
+		reg.mu.RLock()
+		m := reg.middleware[names[i]]
+		reg.mu.RUnlock()
+		if m == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": fmt.Sprintf("middleware %q is not registered", names[i]),
+			})
+			return
+		}
+		handler = m(handler)
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// apigenParams - параметры запроса, откуда бы они ни пришли: query, форма или json-тело
+type apigenParams struct {
+	r    *http.Request
+	form url.Values
+	body map[string]interface{}
+}
+
+// apigenMaxBody - столько же, сколько ParseForm разрешает форме
+const apigenMaxBody = 10 << 20
+
+// apigenReadParams выбирает декодер по Content-Type
+func apigenReadParams(w http.ResponseWriter, r *http.Request) (*apigenParams, error) {
+	p := &apigenParams{r: r}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, apigenMaxBody))
+		dec.UseNumber()
+		if err := dec.Decode(&p.body); err != nil && err != io.EOF {
+			return nil, err
+		}
+		p.form = r.URL.Query()
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return nil, err
+		}
+		p.form = r.Form
 	default:
-		w.WriteHeader(http.StatusNotFound)
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": "unknown method",
-		})
-		return
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		p.form = r.Form
+	}
+	return p, nil
+}
+
+// параметр из url-шаблона вида /user/{login} важнее query и тела
+func (p *apigenParams) Get(name string) string {
+	if v := p.r.PathValue(name); v != "" {
+		return v
+	}
+	if v, ok := p.body[name]; ok {
+		return apigenJSONString(v)
 	}
+	return p.form.Get(name)
+}
+
+// Has - параметр передан, пусть и пустым: default подставляется только вместо отсутствующего
+func (p *apigenParams) Has(name string) bool {
+	if p.r.PathValue(name) != "" {
+		return true
+	}
+	if v, ok := p.body[name]; ok {
+		return v != nil
+	}
+	_, ok := p.form[name]
+	return ok
+}
+
+func (p *apigenParams) GetAll(name string) []string {
+	if v := p.r.PathValue(name); v != "" {
+		return []string{v}
+	}
+	v, ok := p.body[name]
+	if !ok {
+		return p.form[name]
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return []string{apigenJSONString(v)}
+	}
+	res := make([]string, 0, len(list))
+	for _, item := range list {
+		res = append(res, apigenJSONString(item))
+	}
+	return res
+}
+
+// apigenSplitPath режет путь на сегменты так же, как генератор режет url-шаблоны.
+// Путь берётся неразэкранированный, чтобы %2F внутри параметра не превратился в новый сегмент
+func apigenSplitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func apigenUnescape(seg string) string {
+	if v, err := url.PathUnescape(seg); err == nil {
+		return v
+	}
+	return seg
+}
+
+// apigenJSONString приводит значение из json к тому же виду, что пришёл бы в форме
+func apigenJSONString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// apigenAtoi - пустое значение это 0, как и раньше. Одно правило и для int, и для элементов []int
+func apigenAtoi(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
+
+func apigenIsEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+func (api *MyApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segs := apigenSplitPath(r.URL.EscapedPath())
+	if len(segs) > 0 {
+		switch segs[0] {
+		case "user":
+			if len(segs) > 1 {
+				switch segs[1] {
+				case "create":
+					if len(segs) == 2 {
+						switch r.Method {
+						case "POST":
+							api.handlerMyApiCreate(w, r)
+						default:
+							w.Header().Set("Allow", "POST")
+							w.WriteHeader(http.StatusMethodNotAllowed)
+							_ = json.NewEncoder(w).Encode(map[string]interface{}{
+								"error": "bad method",
+							})
+						}
+						return
+					}
+				case "profile":
+					if len(segs) == 2 {
+						api.handlerMyApiProfile(w, r)
+						return
+					}
+				}
+			}
+		case "users":
+			if len(segs) > 1 {
+				r.SetPathValue("login", apigenUnescape(segs[1]))
+				if len(segs) == 2 {
+					switch r.Method {
+					case "DELETE":
+						api.handlerMyApiDelete(w, r)
+					case "GET":
+						api.handlerMyApiGet(w, r)
+					default:
+						w.Header().Set("Allow", "DELETE, GET")
+						w.WriteHeader(http.StatusMethodNotAllowed)
+						_ = json.NewEncoder(w).Encode(map[string]interface{}{
+							"error": "bad method",
+						})
+					}
+					return
+				}
+				r.SetPathValue("login", "")
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": "unknown method",
+	})
 }
 
 func (api *MyApi) handlerMyApiProfile(w http.ResponseWriter, r *http.Request) {
 
 	var params ProfileParams
-	//Login
+	p, err := apigenReadParams(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": "bad request body: " + err.Error(),
+		})
+		return
+	}
+
+	// собираем все ошибки валидации, а не только первую
+	var errs []string
+	// Login
 	{
-		paramName := "login"
-		val := r.FormValue(paramName)
+		val := p.Get("login")
 		if val == "" {
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "login must be not empty",
-			})
-			return
+			errs = append(errs, "login must be not empty")
+		} else {
+			params.Login = val
 		}
+	}
 
-		params.Login = val
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": strings.Join(errs, "; "),
+		})
+		return
 	}
 
 	res, err := api.Profile(r.Context(), params)
@@ -71,110 +352,218 @@ func (api *MyApi) handlerMyApiProfile(w http.ResponseWriter, r *http.Request) {
 }
 
 func (api *MyApi) handlerMyApiCreate(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		w.WriteHeader(http.StatusNotAcceptable)
+	r, authErr := api.APIRegistry.authenticate("default", r)
+	if authErr != nil {
+		w.WriteHeader(authErr.HTTPStatus)
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": "bad method",
+			"error": authErr.Err.Error(),
 		})
 		return
 	}
-	if r.Header.Get("X-Auth") != "100500" {
-		w.WriteHeader(http.StatusForbidden)
+
+	var params CreateParams
+	p, err := apigenReadParams(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": "unauthorized",
+			"error": "bad request body: " + err.Error(),
 		})
 		return
 	}
 
-	var params CreateParams
-	//Login
+	// собираем все ошибки валидации, а не только первую
+	var errs []string
+	// Login
 	{
-		paramName := "login"
-		val := r.FormValue(paramName)
+		val := p.Get("login")
 		if val == "" {
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "login must be not empty",
-			})
-			return
-		}
-		if len(val) < 10 {
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "login len must be >= 10",
-			})
-			return
+			errs = append(errs, "login must be not empty")
+		} else {
+			if len(val) < 10 {
+				errs = append(errs, "login len must be >= 10")
+			}
+			params.Login = val
 		}
-
-		params.Login = val
 	}
-	//Name
+	// Name
 	{
-		paramName := "full_name"
-		val := r.FormValue(paramName)
-
-		params.Name = val
+		val := p.Get("full_name")
+		{
+			params.Name = val
+		}
 	}
-	//Status
+	// Status
 	{
-		paramName := "status"
-		val := r.FormValue(paramName)
-		if val == "" {
+		val := p.Get("status")
+		if !p.Has("status") {
 			val = "user"
 		}
-		allowedStatus := map[string]bool{
-			"user": true,
-			"moderator": true,
-			"admin": true,
+		{
+			switch val {
+			case "user", "moderator", "admin":
+			default:
+				errs = append(errs, "status must be one of [user, moderator, admin]")
+			}
+			params.Status = val
 		}
-		if !allowedStatus[val] {
-			w.WriteHeader(http.StatusBadRequest)
+	}
+	// Age
+	{
+		valStr := p.Get("age")
+		if val, err := apigenAtoi(valStr); err != nil {
+			errs = append(errs, "age must be int")
+		} else {
+			if val < 0 {
+				errs = append(errs, "age must be >= 0")
+			}
+			if val > 128 {
+				errs = append(errs, "age must be <= 128")
+			}
+			params.Age = val
+		}
+	}
+
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": strings.Join(errs, "; "),
+		})
+		return
+	}
+
+	res, err := api.Create(r.Context(), params)
+	if err != nil {
+		switch e := err.(type) {
+		case ApiError:
+			w.WriteHeader(e.HTTPStatus)
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "status must be one of [user, moderator, admin]",
+				"error": e.Err.Error(),
+			})
+			return
+		case *ApiError:
+			w.WriteHeader(e.HTTPStatus)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": e.Err.Error(),
+			})
+			return
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": err.Error(),
 			})
 			return
 		}
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":    "",
+		"response": res,
+	})
+}
 
-		params.Status = val
+func (api *MyApi) handlerMyApiGet(w http.ResponseWriter, r *http.Request) {
+
+	var params ProfileParams
+	p, err := apigenReadParams(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": "bad request body: " + err.Error(),
+		})
+		return
 	}
-	//Age
-	{
-		paramName := "age"
-		valStr := r.FormValue(paramName)
 
-		var valInt int
-		if valStr == "" {
-			valInt = 0
+	// собираем все ошибки валидации, а не только первую
+	var errs []string
+	// Login
+	{
+		val := p.Get("login")
+		if val == "" {
+			errs = append(errs, "login must be not empty")
 		} else {
-			tmp, err := strconv.Atoi(valStr)
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				_ = json.NewEncoder(w).Encode(map[string]interface{}{
-					"error": "age must be int",
-				})
-				return
-			}
-			valInt = tmp
+			params.Login = val
 		}
-		if valInt < 0 {
-			w.WriteHeader(http.StatusBadRequest)
+	}
+
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": strings.Join(errs, "; "),
+		})
+		return
+	}
+
+	res, err := api.Get(r.Context(), params)
+	if err != nil {
+		switch e := err.(type) {
+		case ApiError:
+			w.WriteHeader(e.HTTPStatus)
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "age must be >= 0",
+				"error": e.Err.Error(),
 			})
 			return
-		}
-		if valInt > 128 {
-			w.WriteHeader(http.StatusBadRequest)
+		case *ApiError:
+			w.WriteHeader(e.HTTPStatus)
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "age must be <= 128",
+				"error": e.Err.Error(),
+			})
+			return
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": err.Error(),
 			})
 			return
 		}
+	}
 
-		params.Age = valInt
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":    "",
+		"response": res,
+	})
+}
+
+func (api *MyApi) handlerMyApiDelete(w http.ResponseWriter, r *http.Request) {
+	r, authErr := api.APIRegistry.authenticate("default", r)
+	if authErr != nil {
+		w.WriteHeader(authErr.HTTPStatus)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": authErr.Err.Error(),
+		})
+		return
 	}
 
-	res, err := api.Create(r.Context(), params)
+	var params ProfileParams
+	p, err := apigenReadParams(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": "bad request body: " + err.Error(),
+		})
+		return
+	}
+
+	// собираем все ошибки валидации, а не только первую
+	var errs []string
+	// Login
+	{
+		val := p.Get("login")
+		if val == "" {
+			errs = append(errs, "login must be not empty")
+		} else {
+			params.Login = val
+		}
+	}
+
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": strings.Join(errs, "; "),
+		})
+		return
+	}
+
+	res, err := api.Delete(r.Context(), params)
 	if err != nil {
 		switch e := err.(type) {
 		case ApiError:
@@ -205,123 +594,448 @@ func (api *MyApi) handlerMyApiCreate(w http.ResponseWriter, r *http.Request) {
 }
 
 func (api *OtherApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.URL.Path {
-	case "/user/create":
-		api.handlerOtherApiCreate(w, r)
-	default:
-		w.WriteHeader(http.StatusNotFound)
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": "unknown method",
-		})
-		return
+	segs := apigenSplitPath(r.URL.EscapedPath())
+	if len(segs) > 0 {
+		switch segs[0] {
+		case "user":
+			if len(segs) > 1 {
+				switch segs[1] {
+				case "create":
+					if len(segs) == 2 {
+						switch r.Method {
+						case "POST":
+							api.handlerOtherApiCreate(w, r)
+						default:
+							w.Header().Set("Allow", "POST")
+							w.WriteHeader(http.StatusMethodNotAllowed)
+							_ = json.NewEncoder(w).Encode(map[string]interface{}{
+								"error": "bad method",
+							})
+						}
+						return
+					}
+				case "me":
+					if len(segs) == 2 {
+						api.APIRegistry.serve(w, r, []string{"requestid"}, api.handlerOtherApiMe)
+						return
+					}
+				case "search":
+					if len(segs) == 2 {
+						switch r.Method {
+						case "GET":
+							api.handlerOtherApiSearch(w, r)
+						default:
+							w.Header().Set("Allow", "GET")
+							w.WriteHeader(http.StatusMethodNotAllowed)
+							_ = json.NewEncoder(w).Encode(map[string]interface{}{
+								"error": "bad method",
+							})
+						}
+						return
+					}
+				case "update":
+					if len(segs) == 2 {
+						switch r.Method {
+						case "POST":
+							api.handlerOtherApiUpdate(w, r)
+						default:
+							w.Header().Set("Allow", "POST")
+							w.WriteHeader(http.StatusMethodNotAllowed)
+							_ = json.NewEncoder(w).Encode(map[string]interface{}{
+								"error": "bad method",
+							})
+						}
+						return
+					}
+				}
+			}
+		}
 	}
+	w.WriteHeader(http.StatusNotFound)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": "unknown method",
+	})
 }
 
 func (api *OtherApi) handlerOtherApiCreate(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		w.WriteHeader(http.StatusNotAcceptable)
+	r, authErr := api.APIRegistry.authenticate("default", r)
+	if authErr != nil {
+		w.WriteHeader(authErr.HTTPStatus)
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": "bad method",
+			"error": authErr.Err.Error(),
 		})
 		return
 	}
-	if r.Header.Get("X-Auth") != "100500" {
-		w.WriteHeader(http.StatusForbidden)
+
+	var params OtherCreateParams
+	p, err := apigenReadParams(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": "unauthorized",
+			"error": "bad request body: " + err.Error(),
 		})
 		return
 	}
 
-	var params OtherCreateParams
-	//Username
+	// собираем все ошибки валидации, а не только первую
+	var errs []string
+	// Username
 	{
-		paramName := "username"
-		val := r.FormValue(paramName)
+		val := p.Get("username")
 		if val == "" {
-			w.WriteHeader(http.StatusBadRequest)
+			errs = append(errs, "username must be not empty")
+		} else {
+			if len(val) < 3 {
+				errs = append(errs, "username len must be >= 3")
+			}
+			params.Username = val
+		}
+	}
+	// Name
+	{
+		val := p.Get("account_name")
+		{
+			params.Name = val
+		}
+	}
+	// Class
+	{
+		val := p.Get("class")
+		if !p.Has("class") {
+			val = "warrior"
+		}
+		{
+			switch val {
+			case "warrior", "sorcerer", "rouge":
+			default:
+				errs = append(errs, "class must be one of [warrior, sorcerer, rouge]")
+			}
+			params.Class = val
+		}
+	}
+	// Level
+	{
+		valStr := p.Get("level")
+		if val, err := apigenAtoi(valStr); err != nil {
+			errs = append(errs, "level must be int")
+		} else {
+			if val < 1 {
+				errs = append(errs, "level must be >= 1")
+			}
+			if val > 50 {
+				errs = append(errs, "level must be <= 50")
+			}
+			params.Level = val
+		}
+	}
+
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": strings.Join(errs, "; "),
+		})
+		return
+	}
+
+	res, err := api.Create(r.Context(), params)
+	if err != nil {
+		switch e := err.(type) {
+		case ApiError:
+			w.WriteHeader(e.HTTPStatus)
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "username must be not empty",
+				"error": e.Err.Error(),
 			})
 			return
-		}
-		if len(val) < 3 {
-			w.WriteHeader(http.StatusBadRequest)
+		case *ApiError:
+			w.WriteHeader(e.HTTPStatus)
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "username len must be >= 3",
+				"error": e.Err.Error(),
+			})
+			return
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": err.Error(),
 			})
 			return
 		}
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":    "",
+		"response": res,
+	})
+}
 
-		params.Username = val
+func (api *OtherApi) handlerOtherApiUpdate(w http.ResponseWriter, r *http.Request) {
+	r, authErr := api.APIRegistry.authenticate("default", r)
+	if authErr != nil {
+		w.WriteHeader(authErr.HTTPStatus)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": authErr.Err.Error(),
+		})
+		return
 	}
-	//Name
-	{
-		paramName := "account_name"
-		val := r.FormValue(paramName)
 
-		params.Name = val
+	var params OtherUpdateParams
+	p, err := apigenReadParams(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": "bad request body: " + err.Error(),
+		})
+		return
 	}
-	//Class
+
+	// собираем все ошибки валидации, а не только первую
+	var errs []string
+	// Username
 	{
-		paramName := "class"
-		val := r.FormValue(paramName)
+		val := p.Get("username")
 		if val == "" {
-			val = "warrior"
+			errs = append(errs, "username must be not empty")
+		} else {
+			if val != "" && !apigenReOtherUpdateParamsUsername.MatchString(val) {
+				errs = append(errs, "username must match ^[a-zA-Z0-9_]+$")
+			}
+			params.Username = val
 		}
-		allowedClass := map[string]bool{
-			"warrior": true,
-			"sorcerer": true,
-			"rouge": true,
+	}
+	// Email
+	{
+		val := p.Get("email")
+		{
+			if val != "" && !apigenIsEmail(val) {
+				errs = append(errs, "email must be valid email")
+			}
+			params.Email = val
 		}
-		if !allowedClass[val] {
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "class must be one of [warrior, sorcerer, rouge]",
-			})
-			return
+	}
+	// Code
+	{
+		val := p.Get("code")
+		{
+			if val != "" && len(val) != 6 {
+				errs = append(errs, "code len must be == 6")
+			}
+			params.Code = val
 		}
-
-		params.Class = val
 	}
-	//Level
+	// Zip
 	{
-		paramName := "level"
-		valStr := r.FormValue(paramName)
-
-		var valInt int
-		if valStr == "" {
-			valInt = 0
+		val := p.Get("zip")
+		{
+			if val != "" && !apigenReOtherUpdateParamsZip.MatchString(val) {
+				errs = append(errs, "zip must match ^[0-9]{3,6}$")
+			}
+			params.Zip = val
+		}
+	}
+	// Level
+	{
+		valStr := p.Get("level")
+		if !p.Has("level") {
+			valStr = "1"
+		}
+		if val, err := apigenAtoi(valStr); err != nil {
+			errs = append(errs, "level must be int")
 		} else {
-			tmp, err := strconv.Atoi(valStr)
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				_ = json.NewEncoder(w).Encode(map[string]interface{}{
-					"error": "level must be int",
-				})
-				return
+			switch val {
+			case 1, 10, 50:
+			default:
+				errs = append(errs, "level must be one of [1, 10, 50]")
+			}
+			params.Level = val
+		}
+	}
+	// Tags
+	{
+		vals := p.GetAll("tags")
+		{
+			if len(vals) > 3 {
+				errs = append(errs, "tags len must be <= 3")
+			}
+			for i := range vals {
+				val := vals[i]
+				if len(val) < 2 {
+					errs = append(errs, "tags["+strconv.Itoa(i)+"]"+" len must be >= 2")
+				}
+				if len(val) > 10 {
+					errs = append(errs, "tags["+strconv.Itoa(i)+"]"+" len must be <= 10")
+				}
+				params.Tags = append(params.Tags, val)
 			}
-			valInt = tmp
 		}
-		if valInt < 1 {
-			w.WriteHeader(http.StatusBadRequest)
+	}
+	// Friends
+	{
+		vals := p.GetAll("friends")
+		{
+			for i := range vals {
+				if val, err := apigenAtoi(vals[i]); err != nil {
+					errs = append(errs, "friends["+strconv.Itoa(i)+"]"+" must be int")
+				} else {
+					if val < 1 {
+						errs = append(errs, "friends["+strconv.Itoa(i)+"]"+" must be >= 1")
+					}
+					params.Friends = append(params.Friends, val)
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": strings.Join(errs, "; "),
+		})
+		return
+	}
+
+	res, err := api.Update(r.Context(), params)
+	if err != nil {
+		switch e := err.(type) {
+		case ApiError:
+			w.WriteHeader(e.HTTPStatus)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": e.Err.Error(),
+			})
+			return
+		case *ApiError:
+			w.WriteHeader(e.HTTPStatus)
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "level must be >= 1",
+				"error": e.Err.Error(),
+			})
+			return
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": err.Error(),
 			})
 			return
 		}
-		if valInt > 50 {
-			w.WriteHeader(http.StatusBadRequest)
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":    "",
+		"response": res,
+	})
+}
+
+func (api *OtherApi) handlerOtherApiMe(w http.ResponseWriter, r *http.Request) {
+	r, authErr := api.APIRegistry.authenticate("session", r)
+	if authErr != nil {
+		w.WriteHeader(authErr.HTTPStatus)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": authErr.Err.Error(),
+		})
+		return
+	}
+
+	var params OtherMeParams
+
+	res, err := api.Me(r.Context(), params)
+	if err != nil {
+		switch e := err.(type) {
+		case ApiError:
+			w.WriteHeader(e.HTTPStatus)
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "level must be <= 50",
+				"error": e.Err.Error(),
+			})
+			return
+		case *ApiError:
+			w.WriteHeader(e.HTTPStatus)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": e.Err.Error(),
+			})
+			return
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": err.Error(),
 			})
 			return
 		}
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":    "",
+		"response": res,
+	})
+}
+
+func (api *OtherApi) handlerOtherApiSearch(w http.ResponseWriter, r *http.Request) {
+
+	var params models.SearchParams
+	p, err := apigenReadParams(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": "bad request body: " + err.Error(),
+		})
+		return
+	}
+
+	// собираем все ошибки валидации, а не только первую
+	var errs []string
+	// Query
+	{
+		val := p.Get("query")
+		if val == "" {
+			errs = append(errs, "query must be not empty")
+		} else {
+			if len(val) < 2 {
+				errs = append(errs, "query len must be >= 2")
+			}
+			if val != "" && !apigenReModelsSearchParamsQuery.MatchString(val) {
+				errs = append(errs, "query must match ^[a-z0-9 ]+$")
+			}
+			params.Query = val
+		}
+	}
+	// Limit
+	{
+		valStr := p.Get("limit")
+		if !p.Has("limit") {
+			valStr = "10"
+		}
+		if val, err := apigenAtoi(valStr); err != nil {
+			errs = append(errs, "limit must be int")
+		} else {
+			if val < 1 {
+				errs = append(errs, "limit must be >= 1")
+			}
+			if val > 100 {
+				errs = append(errs, "limit must be <= 100")
+			}
+			params.Limit = val
+		}
+	}
+	// Tags
+	{
+		vals := p.GetAll("tags")
+		{
+			for i := range vals {
+				val := vals[i]
+				switch val {
+				case "go", "web", "db":
+				default:
+					errs = append(errs, "tags["+strconv.Itoa(i)+"]"+" must be one of [go, web, db]")
+				}
+				params.Tags = append(params.Tags, val)
+			}
+		}
+	}
 
-		params.Level = valInt
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": strings.Join(errs, "; "),
+		})
+		return
 	}
 
-	res, err := api.Create(r.Context(), params)
+	res, err := api.Search(r.Context(), params)
 	if err != nil {
 		switch e := err.(type) {
 		case ApiError:
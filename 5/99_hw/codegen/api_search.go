@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"codegenhw/models"
+)
+
+// методы одной структуры могут лежать в разных файлах пакета,
+// а параметры и ответы - в соседних пакетах модуля
+
+// searchUpdatedAt - время индекса, фиксированное чтобы ответ был стабильным
+var searchUpdatedAt = time.Date(2024, time.January, 2, 15, 4, 5, 0, time.UTC)
+
+// apigen:api {"url": "/user/search", "method": "GET"}
+func (srv *OtherApi) Search(ctx context.Context, in models.SearchParams) (*models.SearchResult, error) {
+	words := strings.Fields(in.Query)
+	res := &models.SearchResult{
+		Page: models.Page{
+			Total: len(words),
+			Limit: in.Limit,
+		},
+		Users:     []models.SearchUser{},
+		UpdatedAt: searchUpdatedAt,
+	}
+	for i, w := range words {
+		if i == in.Limit {
+			break
+		}
+		res.Users = append(res.Users, models.SearchUser{Login: w, Tags: in.Tags})
+	}
+	return res, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const ApiUserMe = "/user/me"
+
+func TestOtherApiNotRegistered(t *testing.T) {
+	api := NewOtherApi()
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	runTests(t, ts, []Case{
+		Case{
+			Path:   ApiUserMe,
+			Status: http.StatusInternalServerError,
+			Result: CR{
+				"error": `middleware "requestid" is not registered`,
+			},
+		},
+	})
+
+	api.RegisterMiddleware("requestid", func(next http.Handler) http.Handler { return next })
+	runTests(t, ts, []Case{
+		Case{
+			Path:   ApiUserMe,
+			Status: http.StatusInternalServerError,
+			Result: CR{
+				"error": `authenticator "session" is not registered`,
+			},
+		},
+	})
+}
+
+func TestOtherApiSession(t *testing.T) {
+	api := NewOtherApi()
+	api.RegisterMiddleware("requestid", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Request-Id", "req-1")
+			next.ServeHTTP(w, r)
+		})
+	})
+	// по токену из X-Auth находим логин, он и будет principal
+	api.RegisterAuth("session", AuthenticatorFunc(func(r *http.Request) (interface{}, error) {
+		switch r.Header.Get("X-Auth") {
+		case "100500":
+			return "rvasily", nil
+		case "":
+			return nil, ApiError{http.StatusUnauthorized, fmt.Errorf("no session")}
+		}
+		return nil, fmt.Errorf("bad session")
+	}))
+
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	runTests(t, ts, []Case{
+		Case{
+			Path:   ApiUserMe,
+			Auth:   true,
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        12,
+					"login":     "rvasily",
+					"full_name": "",
+					"level":     0,
+				},
+			},
+		},
+		Case{ // ApiError из аутентификатора отдаётся как есть
+			Path:   ApiUserMe,
+			Status: http.StatusUnauthorized,
+			Result: CR{
+				"error": "no session",
+			},
+		},
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+ApiUserMe, nil)
+	req.Header.Set("X-Auth", "123")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	// обычная ошибка - 403, middleware отработал до аутентификации
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected http status %v, got %v", http.StatusForbidden, resp.StatusCode)
+	}
+	if resp.Header.Get("X-Request-Id") != "req-1" {
+		t.Errorf("middleware was not called")
+	}
+
+	// у /user/create свой аутентификатор "default", session на него не влияет
+	runTests(t, ts, []Case{
+		Case{
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "username=I3apBap",
+			Status: http.StatusForbidden,
+			Result: CR{
+				"error": "unauthorized",
+			},
+		},
+	})
+}
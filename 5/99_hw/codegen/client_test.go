@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"codegenhw/client/myapi"
+	"codegenhw/client/otherapi"
+)
+
+func TestMyApiClient(t *testing.T) {
+	ts := httptest.NewServer(NewMyApi())
+	defer ts.Close()
+
+	ctx := context.Background()
+	c := myapi.New(ts.URL)
+
+	user, err := c.Profile(ctx, myapi.ProfileParams{Login: "rvasily"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &myapi.User{ID: 42, Login: "rvasily", FullName: "Vasily Romanov", Status: 20}
+	if !reflect.DeepEqual(user, expected) {
+		t.Errorf("profile not match\nGot: %#v\nExpected: %#v", user, expected)
+	}
+
+	status := "moderator"
+	createParams := myapi.CreateParams{Login: "mr.moderator", Name: "Ivan Ivanov", Status: &status, Age: 32}
+
+	// без токена - 403
+	_, err = c.Create(ctx, createParams)
+	checkApiError(t, err, http.StatusForbidden, "unauthorized")
+
+	c.AuthToken = "100500"
+	newUser, err := c.Create(ctx, createParams)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if newUser.ID != 43 {
+		t.Errorf("expected id 43, got %d", newUser.ID)
+	}
+
+	// status не передали - сервер подставит default
+	_, err = c.Create(ctx, myapi.CreateParams{Login: "mr.moderator"})
+	checkApiError(t, err, http.StatusConflict, "user mr.moderator exist")
+
+	// явная пустая строка уходит как есть, default вместо неё не подставляется
+	empty := ""
+	_, err = c.Create(ctx, myapi.CreateParams{Login: "new_moderator", Status: &empty})
+	checkApiError(t, err, http.StatusBadRequest, "status must be one of [user, moderator, admin]")
+
+	_, err = c.Profile(ctx, myapi.ProfileParams{Login: "not_exist_user"})
+	checkApiError(t, err, http.StatusNotFound, "user not exist")
+
+	_, err = c.Create(ctx, myapi.CreateParams{Login: "new_moderator", Age: 129})
+	checkApiError(t, err, http.StatusBadRequest, "age must be <= 128")
+}
+
+func TestOtherApiClient(t *testing.T) {
+	ts := httptest.NewServer(NewOtherApi())
+	defer ts.Close()
+
+	c := otherapi.New(ts.URL)
+	c.AuthToken = "100500"
+
+	user, err := c.Create(context.Background(), otherapi.OtherCreateParams{Username: "I3apBap", Name: "Vasily", Level: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &otherapi.OtherUser{ID: 12, Login: "I3apBap", FullName: "Vasily", Level: 1}
+	if !reflect.DeepEqual(user, expected) {
+		t.Errorf("user not match\nGot: %#v\nExpected: %#v", user, expected)
+	}
+
+	// level не задан - сервер подставит default, явный 0 уходит как есть и не проходит oneof
+	user, err = c.Update(context.Background(), otherapi.OtherUpdateParams{Username: "ivan"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.Level != 1 {
+		t.Errorf("expected default level 1, got %d", user.Level)
+	}
+	zero := 0
+	_, err = c.Update(context.Background(), otherapi.OtherUpdateParams{Username: "ivan", Level: &zero})
+	apiErr := otherapi.ApiError{}
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusBadRequest || apiErr.Error() != "level must be one of [1, 10, 50]" {
+		t.Errorf("expected 400 level must be one of [1, 10, 50], got %v", err)
+	}
+}
+
+// TestClientAuth - у session нет схемы в apigen:auth: куда класть токен, клиент не знает
+func TestClientAuth(t *testing.T) {
+	api := NewOtherApi()
+	api.RegisterMiddleware("requestid", func(next http.Handler) http.Handler { return next })
+	api.RegisterAuth("session", AuthenticatorFunc(func(r *http.Request) (interface{}, error) {
+		if c, err := r.Cookie("sid"); err == nil && c.Value == "100500" {
+			return "rvasily", nil
+		}
+		return nil, ApiError{http.StatusUnauthorized, fmt.Errorf("no session")}
+	}))
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	c := otherapi.New(ts.URL)
+	c.AuthToken = "100500"
+	if _, err := c.Me(context.Background(), otherapi.OtherMeParams{}); err == nil || err.Error() != `no apigen:auth scheme for "session", set Client.Auth` {
+		t.Errorf("expected no scheme error, got %v", err)
+	}
+
+	c.Auth = func(req *http.Request, name string) error {
+		if name != "session" {
+			return fmt.Errorf("unexpected auth %q", name)
+		}
+		req.AddCookie(&http.Cookie{Name: "sid", Value: "100500"})
+		return nil
+	}
+	user, err := c.Me(context.Background(), otherapi.OtherMeParams{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.Login != "rvasily" {
+		t.Errorf("expected rvasily, got %q", user.Login)
+	}
+}
+
+// TestClientDeleteParams - у DELETE параметры уходят в query: тело сервер не разбирает
+func TestClientDeleteParams(t *testing.T) {
+	var got *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.Write([]byte(`{"error": "", "response": {}}`))
+	}))
+	defer ts.Close()
+
+	if _, err := myapi.New(ts.URL).Delete(context.Background(), myapi.ProfileParams{Login: "rvasily"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Method != http.MethodDelete || got.URL.Path != "/users/rvasily" || got.ContentLength != 0 {
+		t.Errorf("unexpected request %s %s, body %d bytes", got.Method, got.URL, got.ContentLength)
+	}
+}
+
+func checkApiError(t *testing.T, err error, status int, msg string) {
+	t.Helper()
+	apiErr := myapi.ApiError{}
+	if !errors.As(err, &apiErr) {
+		t.Errorf("expected ApiError, got %T: %v", err, err)
+		return
+	}
+	if apiErr.HTTPStatus != status || apiErr.Error() != msg {
+		t.Errorf("expected ApiError{%d, %q}, got {%d, %q}", status, msg, apiErr.HTTPStatus, apiErr.Error())
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// сгенерированные файлы лежат в репозитории, так что они не должны отставать от api.go
+func TestGeneratedUpToDate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go run ./handlers_gen")
+	}
+	out, err := exec.Command("go", "run", "./handlers_gen", "-check", ".", "api_handlers.go").CombinedOutput()
+	if err != nil {
+		t.Fatalf("generated files are stale, run make: %v\n%s", err, out)
+	}
+}
+
+func TestGeneratedCheckFails(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go run ./handlers_gen")
+	}
+	dir := t.TempDir()
+	out, err := exec.Command("go", "run", "./handlers_gen", "-check",
+		"-openapi", dir, "-client", dir, ".", filepath.Join(dir, "api_handlers.go")).CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected -check to fail for missing files")
+	}
+	for _, name := range []string{"api_handlers.go", "OtherApi.openapi.json", filepath.Join("myapi", "client.go")} {
+		if !strings.Contains(string(out), filepath.Join(dir, name)) {
+			t.Errorf("%s is not reported as stale:\n%s", name, out)
+		}
+	}
+}
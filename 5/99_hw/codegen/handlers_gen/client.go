@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"go/types"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// клиент генерится в отдельный пакет на каждую структуру: client/myapi, client/otherapi.
+// типы параметров и ответов копируются туда, т.к. импортировать их из main нельзя
+
+type APIClient struct {
+	Package    string
+	Receiver   string
+	Handlers   []clientHandler
+	Imports    []importSpec
+	ExtImports []importSpec
+	Types      []string
+	HasInt     bool
+	Auth       []clientAuth
+}
+
+// clientAuth - куда клиент кладёт AuthToken для аутентификатора Name.
+// In - header, query или cookie для apiKey, bearer для {"type": "http", "scheme": "bearer"}
+type clientAuth struct {
+	Name  string
+	In    string
+	Param string
+}
+
+var clientTpl = template.Must(template.New("clientTpl").Funcs(template.FuncMap{
+	"httpMethod": func(h APIHandler) string {
+		if h.Method == "" {
+			return http.MethodGet
+		}
+		return h.Method
+	},
+	"urlPath": clientURLPath,
+}).Parse(`// Code generated by handlers_gen; DO NOT EDIT.
+
+// Package {{.Package}} - клиент для {{.Receiver}}
+package {{.Package}}
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	{{- if .HasInt }}
+	"strconv"
+	{{- end }}
+	"strings"
+	{{- range .Imports }}
+	{{ if .Name }}{{ .Name }} {{ end }}{{ printf "%q" .Path }}
+	{{- end }}
+	{{- if .ExtImports }}
+	{{ range .ExtImports }}
+	{{ if .Name }}{{ .Name }} {{ end }}{{ printf "%q" .Path }}
+	{{- end }}
+	{{- end }}
+)
+
+// ApiError - ошибка, которую вернул сервер: http-статус ответа и текст из поля error
+type ApiError struct {
+	HTTPStatus int
+	Err        error
+}
+
+func (ae ApiError) Error() string {
+	return ae.Err.Error()
+}
+
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// AuthToken уходит в методы с "auth" так, как велит схема аутентификатора из apigen:auth
+	AuthToken string
+	// Auth, если задан, подписывает запросы вместо AuthToken, name - имя аутентификатора.
+	// Нужен для аутентификаторов без схемы в apigen:auth
+	Auth func(req *http.Request, name string) error
+	// Header добавляется ко всем запросам, например для своих аутентификаторов
+	Header http.Header
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+	}
+}
+{{ range .Types }}
+{{ . }}
+{{ end }}
+
+{{- range .Handlers }}
+
+func (c *Client) {{ .Name }}(ctx context.Context, in {{ .In }}) (*{{ .Out }}, error) {
+	params := url.Values{}
+	{{- $h := . }}
+	{{- range .Fields }}
+	{{- if $h.IsPathParam .ParamName }}
+	{{- else if .Optional }}
+	if in.{{ .Name }} != nil {
+		params.Set("{{ .ParamName }}", {{ if eq .Validator.Type "int" }}strconv.Itoa(*in.{{ .Name }}){{ else }}*in.{{ .Name }}{{ end }})
+	}
+	{{- else if eq .Validator.Type "int" }}
+	params.Set("{{ .ParamName }}", strconv.Itoa(in.{{ .Name }}))
+	{{- else if eq .Validator.Type "[]int" }}
+	for _, v := range in.{{ .Name }} {
+		params.Add("{{ .ParamName }}", strconv.Itoa(v))
+	}
+	{{- else if eq .Validator.Type "[]string" }}
+	for _, v := range in.{{ .Name }} {
+		params.Add("{{ .ParamName }}", v)
+	}
+	{{- else }}
+	params.Set("{{ .ParamName }}", in.{{ .Name }})
+	{{- end }}
+	{{- end }}
+
+	res := new({{ .Out }})
+	if err := c.do(ctx, "{{ httpMethod .APIHandler }}", {{ urlPath .APIHandler }}, {{ printf "%q" .Auth }}, params, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+{{- end }}
+
+// authorize кладёт AuthToken туда, где его ждёт схема аутентификатора
+func (c *Client) authorize(req *http.Request, name string) error {
+	if c.Auth != nil {
+		return c.Auth(req, name)
+	}
+	if c.AuthToken == "" {
+		return nil
+	}
+	switch name {
+	{{- range .Auth }}
+	case {{ printf "%q" .Name }}:
+		{{- if eq .In "header" }}
+		req.Header.Set({{ printf "%q" .Param }}, c.AuthToken)
+		{{- else if eq .In "query" }}
+		q := req.URL.Query()
+		q.Set({{ printf "%q" .Param }}, c.AuthToken)
+		req.URL.RawQuery = q.Encode()
+		{{- else if eq .In "cookie" }}
+		req.AddCookie(&http.Cookie{Name: {{ printf "%q" .Param }}, Value: c.AuthToken})
+		{{- else }}
+		req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+		{{- end }}
+	{{- end }}
+	default:
+		return fmt.Errorf("no apigen:auth scheme for %q, set Client.Auth", name)
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, auth string, params url.Values, res interface{}) error {
+	target := c.BaseURL + path
+	var body io.Reader
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		// тело у DELETE сервер не читает
+		if len(params) > 0 {
+			target += "?" + params.Encode()
+		}
+	default:
+		body = strings.NewReader(params.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	if auth != "" {
+		if err := c.authorize(req, auth); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	envelope := struct {
+		Error    string          ` + "`json:\"error\"`" + `
+		Response json.RawMessage ` + "`json:\"response\"`" + `
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return ApiError{resp.StatusCode, errors.New(http.StatusText(resp.StatusCode))}
+		}
+		return fmt.Errorf("cant unpack response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || envelope.Error != "" {
+		return ApiError{resp.StatusCode, errors.New(envelope.Error)}
+	}
+	return json.Unmarshal(envelope.Response, res)
+}
+`))
+
+// clientURLPath - go-выражение для пути запроса: {param} из url подставляются из полей параметров
+func clientURLPath(h APIHandler) string {
+	if len(h.PathParams) == 0 {
+		return strconv.Quote(h.URL)
+	}
+	parts := []string{}
+	static := ""
+	for _, seg := range pathSegments(h.URL) {
+		name, ok := pathParamName(seg)
+		if !ok {
+			static += "/" + seg
+			continue
+		}
+		parts = append(parts, strconv.Quote(static+"/"))
+		static = ""
+		for _, f := range h.Fields {
+			if f.ParamName() != name {
+				continue
+			}
+			if f.Validator.Type == "int" {
+				parts = append(parts, "strconv.Itoa(in."+f.Name+")")
+			} else {
+				parts = append(parts, "url.PathEscape(in."+f.Name+")")
+			}
+		}
+	}
+	if static != "" {
+		parts = append(parts, strconv.Quote(static))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// clientAuths - схемы, которые клиент умеет заполнить сам. Остальные - только через Client.Auth
+func clientAuths(schemes map[string]spec) []clientAuth {
+	res := []clientAuth{}
+	for name, scheme := range schemes {
+		typ, _ := scheme["type"].(string)
+		in, _ := scheme["in"].(string)
+		param, _ := scheme["name"].(string)
+		bearer, _ := scheme["scheme"].(string)
+		switch {
+		case typ == "apiKey" && param != "" && (in == "header" || in == "query" || in == "cookie"):
+			res = append(res, clientAuth{Name: name, In: in, Param: param})
+		case typ == "http" && strings.EqualFold(bearer, "bearer"):
+			res = append(res, clientAuth{Name: name, In: "bearer"})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// clientHandler - хендлер и его типы так, как они пишутся в пакете клиента
+type clientHandler struct {
+	APIHandler
+	In  string
+	Out string
+}
+
+// clientTypes копирует в клиент типы, объявленные в модуле, вместе со всеми вложенными.
+// Типы из чужих модулей и stdlib (time.Time и т.п.) не копируются, а импортируются
+type clientTypes struct {
+	src     *apiSource
+	imports *importSet
+	names   map[string]*types.TypeName
+	decls   []string
+	// optional - поля параметров, которые в клиенте становятся указателями, см. APIField.Optional
+	optional map[*types.TypeName]map[string]bool
+}
+
+func (c *clientTypes) expr(t types.Type) string {
+	switch t := types.Unalias(t).(type) {
+	case *types.Named:
+		obj := t.Obj()
+		if t.TypeArgs().Len() > 0 {
+			log.Fatalf("client: generic type %s is not supported", t)
+		}
+		if !c.src.modulePackage(obj.Pkg()) {
+			return types.TypeString(t, c.imports.qualifier)
+		}
+		if prev, ok := c.names[obj.Name()]; ok {
+			if prev != obj {
+				log.Fatalf("client: types %s and %s have the same name", prev.Pkg().Path()+"."+prev.Name(), obj.Pkg().Path()+"."+obj.Name())
+			}
+			return obj.Name()
+		}
+		c.names[obj.Name()] = obj
+		// место под объявление занимаем заранее, чтобы вложенные типы шли после родителя
+		idx := len(c.decls)
+		c.decls = append(c.decls, "")
+		if st, ok := t.Underlying().(*types.Struct); ok {
+			c.decls[idx] = "type " + obj.Name() + " " + c.structExpr(st, c.optional[obj])
+		} else {
+			c.decls[idx] = "type " + obj.Name() + " " + c.expr(t.Underlying())
+		}
+		return obj.Name()
+	case *types.Basic:
+		return t.Name()
+	case *types.Pointer:
+		return "*" + c.expr(t.Elem())
+	case *types.Slice:
+		return "[]" + c.expr(t.Elem())
+	case *types.Array:
+		return "[" + strconv.FormatInt(t.Len(), 10) + "]" + c.expr(t.Elem())
+	case *types.Map:
+		return "map[" + c.expr(t.Key()) + "]" + c.expr(t.Elem())
+	case *types.Struct:
+		return c.structExpr(t, nil)
+	}
+	return types.TypeString(t, c.imports.qualifier)
+}
+
+// structExpr - поля из optional пишутся указателями
+func (c *clientTypes) structExpr(t *types.Struct, optional map[string]bool) string {
+	if t.NumFields() == 0 {
+		return "struct{}"
+	}
+	b := &strings.Builder{}
+	b.WriteString("struct {\n")
+	for i := 0; i < t.NumFields(); i++ {
+		f := t.Field(i)
+		if !f.Exported() {
+			continue
+		}
+		if !f.Embedded() {
+			b.WriteString(f.Name() + " ")
+		}
+		if optional[f.Name()] {
+			b.WriteString("*")
+		}
+		b.WriteString(c.expr(f.Type()))
+		if tag := t.Tag(i); tag != "" {
+			if strings.Contains(tag, "`") {
+				b.WriteString(" " + strconv.Quote(tag))
+			} else {
+				b.WriteString(" `" + tag + "`")
+			}
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// clientImports - то, что импортирует clientTpl
+var clientImports = []string{"context", "json", "errors", "fmt", "io", "http", "url", "strconv", "strings"}
+
+func genClient(src *apiSource, api *APIServeHTTP) (string, []byte) {
+	c := APIClient{
+		Package:  strings.ToLower(api.Receiver),
+		Receiver: api.Receiver,
+	}
+	ct := &clientTypes{
+		src:      src,
+		imports:  newImportSet(nil, clientImports...),
+		names:    make(map[string]*types.TypeName),
+		optional: make(map[*types.TypeName]map[string]bool),
+	}
+	if src.pkg.Module != nil {
+		ct.imports.module = src.pkg.Module.Path
+	}
+
+	for _, h := range api.Handlers {
+		for _, f := range h.Fields {
+			if !f.Optional() {
+				continue
+			}
+			if h.IsPathParam(f.ParamName()) {
+				log.Fatalf("client: path param %s.%s can't have default", h.ParamsType.Obj().Name(), f.Name)
+			}
+			obj := h.ParamsType.Obj()
+			if ct.optional[obj] == nil {
+				ct.optional[obj] = map[string]bool{}
+			}
+			ct.optional[obj][f.Name] = true
+		}
+	}
+	for _, h := range api.Handlers {
+		c.Handlers = append(c.Handlers, clientHandler{
+			APIHandler: h,
+			In:         ct.expr(h.ParamsType),
+			Out:        ct.expr(h.ResultType),
+		})
+		for _, f := range h.Fields {
+			c.HasInt = c.HasInt || f.Validator.Type == "int" || f.Validator.Type == "[]int"
+		}
+	}
+	c.Types = ct.decls
+	c.Auth = clientAuths(api.AuthSchemes)
+	c.Imports, c.ExtImports = ct.imports.list()
+
+	buf := &bytes.Buffer{}
+	if err := clientTpl.Execute(buf, c); err != nil {
+		log.Fatal(err)
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("gofmt client for %s: %v", api.Receiver, err)
+	}
+	return c.Package, code
+}
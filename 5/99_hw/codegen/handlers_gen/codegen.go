@@ -2,14 +2,18 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"go/ast"
-	"go/parser"
-	"go/token"
+	"go/format"
+	"go/types"
 	"log"
 	"os"
-	"reflect"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
@@ -24,6 +28,12 @@ type APIValidator struct {
 	Default   string
 	Min       *int
 	Max       *int
+	Len       *int
+	Regexp    string
+	RegexpVar string
+	Email     bool
+	// Each - правила для элементов, есть только у слайсов
+	Each *APIValidator
 }
 
 type APIField struct {
@@ -31,23 +41,110 @@ type APIField struct {
 	Validator APIValidator
 }
 
+// ParamName - имя параметра в запросе: paramname из тега или lowercase от имени поля
+func (f APIField) ParamName() string {
+	if f.Validator.Paramname != "" {
+		return f.Validator.Paramname
+	}
+	return toLowerFirst(f.Name)
+}
+
+// Optional - скаляр с default: в клиенте нулевое значение не отличить от "не задано",
+// поэтому там поле становится указателем. default=0 у int ничего не меняет, его можно не считать
+func (f APIField) Optional() bool {
+	switch f.Validator.Type {
+	case "int":
+		return f.Validator.Default != "" && f.Validator.Default != "0"
+	case "string":
+		return f.Validator.Default != ""
+	}
+	return false
+}
+
 type APIMeta struct {
-	URL    string `json:"url"`
-	Auth   bool   `json:"auth"`
-	Method string `json:"method"`
+	URL        string   `json:"url"`
+	Auth       AuthName `json:"auth"`
+	Method     string   `json:"method"`
+	Middleware []string `json:"middleware"`
+}
+
+// AuthName - имя аутентификатора из "auth": строка, либо true для "default"
+type AuthName string
+
+const defaultAuth = "default"
+
+func (a *AuthName) UnmarshalJSON(data []byte) error {
+	var flag bool
+	if err := json.Unmarshal(data, &flag); err == nil {
+		*a = ""
+		if flag {
+			*a = defaultAuth
+		}
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("auth must be bool or authenticator name: %w", err)
+	}
+	*a = AuthName(name)
+	return nil
 }
 
 type APIHandler struct {
 	APIMeta
-	Name       string
-	Receiver   string
-	Fields     []APIField
-	ParamsName string
+	Name     string
+	Receiver string
+	Fields   []APIField
+	// ParamsExpr - тип параметров так, как он пишется в сгенерированном файле, с пакетом если он чужой
+	ParamsExpr    string
+	ParamsType    *types.Named
+	ResultType    types.Type
+	ErrorStatuses []int
+	// PathParams - имена {param} из url в порядке следования
+	PathParams []string
+}
+
+// IsPathParam - параметр берётся из пути, а не из query или тела
+func (h APIHandler) IsPathParam(name string) bool {
+	for _, p := range h.PathParams {
+		if p == name {
+			return true
+		}
+	}
+	return false
 }
 
 type APIServeHTTP struct {
 	Receiver string
 	Handlers []APIHandler
+	// AuthSchemes - объявленные через apigen:auth securitySchemes для openapi
+	AuthSchemes map[string]spec
+}
+
+type APIHeader struct {
+	Package    string
+	Imports    []importSpec
+	ExtImports []importSpec
+	Regexps    []*APIValidator
+}
+
+// checkCtx - данные для шаблонов проверок: правила и go-выражение с именем параметра для текста ошибки
+type checkCtx struct {
+	V    APIValidator
+	Name string
+}
+
+func newChecks(v APIValidator, name string) checkCtx {
+	return checkCtx{v, name}
+}
+
+// errMsg собирает go-выражение с текстом ошибки: для известного на этапе генерации
+// имени это просто строка, для элементов слайса имя считается в рантайме
+func errMsg(nameExpr, text string) string {
+	if name, err := strconv.Unquote(nameExpr); err == nil {
+		return strconv.Quote(name + " " + text)
+	}
+	return nameExpr + " + " + strconv.Quote(" "+text)
 }
 
 func toLowerFirst(s string) string {
@@ -66,159 +163,180 @@ func join(vals []string, sep string) string {
 var serveHTTPTpl = template.Must(template.New("serveHTTPTpl").Funcs(template.FuncMap{
 	"lowerFirst": toLowerFirst,
 	"join":       join,
+	"checks":     newChecks,
+	"router":     genRouter,
+	"errMsg":     errMsg,
+	"deref":      func(n *int) int { return *n },
 }).Parse(`
-func (api *{{.Receiver}}) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.URL.Path {
-	{{- range .Handlers }}
-	case "{{ .URL }}":
-		api.handler{{ $.Receiver }}{{ .Name }}(w, r)
+{{- define "strChecks" }}
+	{{- if .V.Min }}
+	if len(val) < {{ .V.Min }} {
+		errs = append(errs, {{ errMsg .Name (printf "len must be >= %v" (deref .V.Min)) }})
+	}
+	{{- end }}
+	{{- if .V.Max }}
+	if len(val) > {{ .V.Max }} {
+		errs = append(errs, {{ errMsg .Name (printf "len must be <= %v" (deref .V.Max)) }})
+	}
 	{{- end }}
+	{{- if .V.Enum }}
+	switch val {
+	case {{ range $i, $v := .V.Enum }}{{ if $i }}, {{ end }}{{ printf "%q" $v }}{{ end }}:
 	default:
-		w.WriteHeader(http.StatusNotFound)
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": "unknown method",
-		})
-		return
+		errs = append(errs, {{ errMsg .Name (printf "must be one of [%s]" (join .V.Enum ", ")) }})
 	}
-}
-
-{{- range .Handlers }}
-
-func (api *{{.Receiver}}) handler{{.Receiver}}{{.Name}}(w http.ResponseWriter, r *http.Request) {
-	{{- if .Method }}
-	if r.Method != "{{ .Method }}" {
-		w.WriteHeader(http.StatusNotAcceptable)
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": "bad method",
-		})
-		return
+	{{- end }}
+	{{- if .V.Len }}
+	if val != "" && len(val) != {{ .V.Len }} {
+		errs = append(errs, {{ errMsg .Name (printf "len must be == %v" (deref .V.Len)) }})
 	}
 	{{- end }}
-
-	{{- if .Auth }}
-	if r.Header.Get("X-Auth") != "100500" {
-		w.WriteHeader(http.StatusForbidden)
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": "unauthorized",
-		})
-		return
+	{{- if .V.Regexp }}
+	if val != "" && !{{ .V.RegexpVar }}.MatchString(val) {
+		errs = append(errs, {{ errMsg .Name (printf "must match %s" .V.Regexp) }})
+	}
+	{{- end }}
+	{{- if .V.Email }}
+	if val != "" && !apigenIsEmail(val) {
+		errs = append(errs, {{ errMsg .Name "must be valid email" }})
 	}
 	{{- end }}
+{{- end }}
 
-	var params {{ .ParamsName }}
+{{- define "intChecks" }}
+	{{- if .V.Min }}
+	if val < {{ .V.Min }} {
+		errs = append(errs, {{ errMsg .Name (printf "must be >= %v" (deref .V.Min)) }})
+	}
+	{{- end }}
+	{{- if .V.Max }}
+	if val > {{ .V.Max }} {
+		errs = append(errs, {{ errMsg .Name (printf "must be <= %v" (deref .V.Max)) }})
+	}
+	{{- end }}
+	{{- if .V.Enum }}
+	switch val {
+	case {{ join .V.Enum ", " }}:
+	default:
+		errs = append(errs, {{ errMsg .Name (printf "must be one of [%s]" (join .V.Enum ", ")) }})
+	}
+	{{- end }}
+{{- end }}
 
-	{{- range .Fields }}
-	//{{ .Name }}
+{{- define "field" }}
+	// {{ .Name }}
 	{
-		paramName := "{{ if .Validator.Paramname }}{{ .Validator.Paramname }}{{ else }}{{ lowerFirst .Name }}{{ end }}"
-		{{- if eq .Validator.Type "int" }}
-		valStr := r.FormValue(paramName)
+		{{- $name := printf "%q" (lowerFirst .Name) }}
+		{{- if eq .Validator.Type "string" }}
+		val := p.Get("{{ .ParamName }}")
 		{{- if .Validator.Default }}
-		if valStr == "" {
-			valStr = "{{ .Validator.Default }}"
+		if !p.Has("{{ .ParamName }}") {
+			val = {{ printf "%q" .Validator.Default }}
 		}
 		{{- end }}
-		{{- if .Validator.Required }}
-		if valStr == "" {
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "{{ lowerFirst .Name }} must be not empty",
-			})
-			return
+		{{ if .Validator.Required }}if val == "" {
+			errs = append(errs, {{ errMsg $name "must be not empty" }})
+		} else {{ end }}{
+			{{- template "strChecks" checks .Validator $name }}
+			params.{{ .Name }} = val
+		}
+		{{- else if eq .Validator.Type "int" }}
+		valStr := p.Get("{{ .ParamName }}")
+		{{- if .Validator.Default }}
+		if !p.Has("{{ .ParamName }}") {
+			valStr = {{ printf "%q" .Validator.Default }}
 		}
 		{{- end }}
-
-		var valInt int
-		if valStr == "" {
-			valInt = 0
+		{{ if .Validator.Required }}if valStr == "" {
+			errs = append(errs, {{ errMsg $name "must be not empty" }})
+		} else {{ end }}if val, err := apigenAtoi(valStr); err != nil {
+			errs = append(errs, {{ errMsg $name "must be int" }})
 		} else {
-			tmp, err := strconv.Atoi(valStr)
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				_ = json.NewEncoder(w).Encode(map[string]interface{}{
-					"error": "{{ lowerFirst .Name }} must be int",
-				})
-				return
-			}
-			valInt = tmp
-		}
-
-		{{- if .Validator.Min }}
-		if valInt < {{ .Validator.Min }} {
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "{{ lowerFirst .Name }} must be >= {{ .Validator.Min }}",
-			})
-			return
+			{{- template "intChecks" checks .Validator $name }}
+			params.{{ .Name }} = val
 		}
-		{{- end }}
-		{{- if .Validator.Max }}
-		if valInt > {{ .Validator.Max }} {
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "{{ lowerFirst .Name }} must be <= {{ .Validator.Max }}",
-			})
-			return
+		{{- else }}
+		vals := p.GetAll("{{ .ParamName }}")
+		{{ if .Validator.Required }}if len(vals) == 0 {
+			errs = append(errs, {{ errMsg $name "must be not empty" }})
+		} else {{ end }}{
+			{{- if .Validator.Min }}
+			if len(vals) < {{ .Validator.Min }} {
+				errs = append(errs, {{ errMsg $name (printf "len must be >= %v" (deref .Validator.Min)) }})
+			}
+			{{- end }}
+			{{- if .Validator.Max }}
+			if len(vals) > {{ .Validator.Max }} {
+				errs = append(errs, {{ errMsg $name (printf "len must be <= %v" (deref .Validator.Max)) }})
+			}
+			{{- end }}
+			{{- if .Validator.Len }}
+			if len(vals) != {{ .Validator.Len }} {
+				errs = append(errs, {{ errMsg $name (printf "len must be == %v" (deref .Validator.Len)) }})
+			}
+			{{- end }}
+			{{- $elemName := printf "\"%s[\" + strconv.Itoa(i) + \"]\"" (lowerFirst .Name) }}
+			for i := range vals {
+				{{- if eq .Validator.Each.Type "string" }}
+				val := vals[i]
+				{{- template "strChecks" checks .Validator.Each $elemName }}
+				params.{{ .Name }} = append(params.{{ .Name }}, val)
+				{{- else }}
+				if val, err := apigenAtoi(vals[i]); err != nil {
+					errs = append(errs, {{ errMsg $elemName "must be int" }})
+				} else {
+					{{- template "intChecks" checks .Validator.Each $elemName }}
+					params.{{ .Name }} = append(params.{{ .Name }}, val)
+				}
+				{{- end }}
+			}
 		}
 		{{- end }}
+	}
+{{- end }}
 
-		params.{{ .Name }} = valInt
-		{{- else if eq .Validator.Type "string" }}
-		val := r.FormValue(paramName)
+func (api *{{.Receiver}}) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	{{ router . }}
+}
 
-		{{- if .Validator.Default }}
-		if val == "" {
-			val = "{{ .Validator.Default }}"
-		}
-		{{- end }}
+{{- range .Handlers }}
 
-		{{- if .Validator.Required }}
-		if val == "" {
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "{{ lowerFirst .Name }} must be not empty",
-			})
-			return
-		}
-		{{- end }}
+func (api *{{.Receiver}}) handler{{.Receiver}}{{.Name}}(w http.ResponseWriter, r *http.Request) {
+	{{- if .Auth }}
+	r, authErr := api.APIRegistry.authenticate({{ printf "%q" .Auth }}, r)
+	if authErr != nil {
+		w.WriteHeader(authErr.HTTPStatus)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": authErr.Err.Error(),
+		})
+		return
+	}
+	{{- end }}
 
-		{{- if .Validator.Min }}
-		if len(val) < {{ .Validator.Min }} {
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "{{ lowerFirst .Name }} len must be >= {{ .Validator.Min }}",
-			})
-			return
-		}
-		{{- end }}
+	var params {{ .ParamsExpr }}
 
-		{{- if .Validator.Max }}
-		if len(val) > {{ .Validator.Max }} {
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "{{ lowerFirst .Name }} len must be <= {{ .Validator.Max }}",
-			})
-			return
-		}
-		{{- end }}
+	{{- if .Fields }}
+	p, err := apigenReadParams(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": "bad request body: " + err.Error(),
+		})
+		return
+	}
 
-		{{- if .Validator.Enum }}
-		allowed{{ .Name }} := map[string]bool{
-			{{- range .Validator.Enum }}
-			"{{ . }}": true,
-			{{- end }}
-		}
-		if !allowed{{ .Name }}[val] {
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": "{{ lowerFirst .Name }} must be one of [{{ join .Validator.Enum ", " }}]",
-			})
-			return
-		}
-		{{- end }}
+	// собираем все ошибки валидации, а не только первую
+	var errs []string
+	{{- range .Fields }}
+	{{- template "field" . }}
+	{{- end }}
 
-		params.{{ .Name }} = val
-		{{- end }}
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": strings.Join(errs, "; "),
+		})
+		return
 	}
 	{{- end }}
 
@@ -254,182 +372,416 @@ func (api *{{.Receiver}}) handler{{.Receiver}}{{.Name}}(w http.ResponseWriter, r
 {{- end }}
 `))
 
-func main() {
-	if len(os.Args) != 3 {
-		log.Fatalf("usage: %s <in.go> <out.go>", os.Args[0])
+// headerTpl - импорты и общие хелперы, пишутся один раз на файл
+var headerTpl = template.Must(template.New("headerTpl").Parse(`package {{ .Package }}
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/url"
+	{{- if .Regexps }}
+	"regexp"
+	{{- end }}
+	"strconv"
+	"strings"
+	"sync"
+	{{- range .Imports }}
+	{{ if .Name }}{{ .Name }} {{ end }}{{ printf "%q" .Path }}
+	{{- end }}
+	{{- if .ExtImports }}
+	{{ range .ExtImports }}
+	{{ if .Name }}{{ .Name }} {{ end }}{{ printf "%q" .Path }}
+	{{- end }}
+	{{- end }}
+)
+{{- if .Regexps }}
+
+var (
+	{{- range .Regexps }}
+	{{ .RegexpVar }} = regexp.MustCompile({{ printf "%q" .Regexp }})
+	{{- end }}
+)
+{{- end }}
+
+// Authenticator решает, пускать ли запрос к методу с "auth", и возвращает того, кто его сделал.
+// Ошибка типа ApiError уходит клиенту как есть, любая другая - как 403
+type Authenticator interface {
+	Authenticate(r *http.Request) (principal interface{}, err error)
+}
+
+type AuthenticatorFunc func(r *http.Request) (interface{}, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (interface{}, error) {
+	return f(r)
+}
+
+type Middleware func(http.Handler) http.Handler
+
+// APIRegistry встраивается в структуру api, на которой есть методы с "auth" или "middleware".
+// Имена из apigen:api комментариев резолвятся в то, что зарегистрировали в рантайме
+type APIRegistry struct {
+	mu         sync.RWMutex
+	auth       map[string]Authenticator
+	middleware map[string]Middleware
+}
+
+func (reg *APIRegistry) RegisterAuth(name string, a Authenticator) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.auth == nil {
+		reg.auth = make(map[string]Authenticator)
 	}
+	reg.auth[name] = a
+}
 
-	in := os.Args[1]
-	outFile := os.Args[2]
+func (reg *APIRegistry) RegisterMiddleware(name string, m Middleware) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.middleware == nil {
+		reg.middleware = make(map[string]Middleware)
+	}
+	reg.middleware[name] = m
+}
 
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, in, nil, parser.ParseComments)
-	if err != nil {
-		log.Fatal(err)
+type apigenPrincipalKey struct{}
+
+// Principal - тот, кого вернул Authenticator для текущего запроса
+func Principal(ctx context.Context) interface{} {
+	return ctx.Value(apigenPrincipalKey{})
+}
+
+func (reg *APIRegistry) authenticate(name string, r *http.Request) (*http.Request, *ApiError) {
+	reg.mu.RLock()
+	a := reg.auth[name]
+	reg.mu.RUnlock()
+	if a == nil {
+		return r, &ApiError{http.StatusInternalServerError, fmt.Errorf("authenticator %q is not registered", name)}
 	}
 
-	out, err := os.Create(outFile)
+	principal, err := a.Authenticate(r)
 	if err != nil {
-		log.Fatal(err)
+		apiErr := ApiError{}
+		if errors.As(err, &apiErr) {
+			return r, &apiErr
+		}
+		return r, &ApiError{http.StatusForbidden, err}
 	}
-	defer out.Close()
+	return r.WithContext(context.WithValue(r.Context(), apigenPrincipalKey{}, principal)), nil
+}
 
-	fmt.Fprintf(out, "package %s\n\n", node.Name.Name)
-	fmt.Fprintln(out, `import (`)
-	fmt.Fprintln(out, `  "encoding/json"`)
-	fmt.Fprintln(out, `  "net/http"`)
-	fmt.Fprintln(out, `  "strconv"`)
-	fmt.Fprintln(out, `)`)
-	fmt.Fprintln(out)
+// serve оборачивает хендлер в middleware, первый в списке - самый внешний
+func (reg *APIRegistry) serve(w http.ResponseWriter, r *http.Request, names []string, h http.HandlerFunc) {
+	var handler http.Handler = h
+	for i := len(names) - 1; i >= 0; i-- {
+		reg.mu.RLock()
+		m := reg.middleware[names[i]]
+		reg.mu.RUnlock()
+		if m == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": fmt.Sprintf("middleware %q is not registered", names[i]),
+			})
+			return
+		}
+		handler = m(handler)
+	}
+	handler.ServeHTTP(w, r)
+}
 
-	validators := make(map[string][]APIField)
-	apis := make(map[string]*APIServeHTTP)
+// apigenParams - параметры запроса, откуда бы они ни пришли: query, форма или json-тело
+type apigenParams struct {
+	r    *http.Request
+	form url.Values
+	body map[string]interface{}
+}
 
-	for _, decl := range node.Decls {
-		fun, ok := decl.(*ast.FuncDecl)
-		if !ok || fun.Doc == nil {
-			continue
+// apigenMaxBody - столько же, сколько ParseForm разрешает форме
+const apigenMaxBody = 10 << 20
+
+// apigenReadParams выбирает декодер по Content-Type
+func apigenReadParams(w http.ResponseWriter, r *http.Request) (*apigenParams, error) {
+	p := &apigenParams{r: r}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, apigenMaxBody))
+		dec.UseNumber()
+		if err := dec.Decode(&p.body); err != nil && err != io.EOF {
+			return nil, err
+		}
+		p.form = r.URL.Query()
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return nil, err
 		}
+		p.form = r.Form
+	default:
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		p.form = r.Form
+	}
+	return p, nil
+}
 
-		for _, c := range fun.Doc.List {
-			if !strings.HasPrefix(c.Text, "// apigen:api") {
-				continue
-			}
+// параметр из url-шаблона вида /user/{login} важнее query и тела
+func (p *apigenParams) Get(name string) string {
+	if v := p.r.PathValue(name); v != "" {
+		return v
+	}
+	if v, ok := p.body[name]; ok {
+		return apigenJSONString(v)
+	}
+	return p.form.Get(name)
+}
 
-			if fun.Recv == nil || len(fun.Recv.List) != 1 {
-				continue
-			}
+// Has - параметр передан, пусть и пустым: default подставляется только вместо отсутствующего
+func (p *apigenParams) Has(name string) bool {
+	if p.r.PathValue(name) != "" {
+		return true
+	}
+	if v, ok := p.body[name]; ok {
+		return v != nil
+	}
+	_, ok := p.form[name]
+	return ok
+}
 
-			star, ok := fun.Recv.List[0].Type.(*ast.StarExpr)
-			if !ok {
-				continue
-			}
-			receiverIdent, ok := star.X.(*ast.Ident)
-			if !ok {
-				continue
-			}
-			receiver := receiverIdent.Name
+func (p *apigenParams) GetAll(name string) []string {
+	if v := p.r.PathValue(name); v != "" {
+		return []string{v}
+	}
+	v, ok := p.body[name]
+	if !ok {
+		return p.form[name]
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return []string{apigenJSONString(v)}
+	}
+	res := make([]string, 0, len(list))
+	for _, item := range list {
+		res = append(res, apigenJSONString(item))
+	}
+	return res
+}
 
-			var meta APIMeta
-			jsonText := strings.TrimPrefix(c.Text, "// apigen:api ")
-			if err := json.Unmarshal([]byte(jsonText), &meta); err != nil {
-				log.Fatalf("cant parse apigen json for %s: %v", fun.Name.Name, err)
-			}
+// apigenSplitPath режет путь на сегменты так же, как генератор режет url-шаблоны.
+// Путь берётся неразэкранированный, чтобы %2F внутри параметра не превратился в новый сегмент
+func apigenSplitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
 
-			if fun.Type.Params == nil || len(fun.Type.Params.List) != 2 {
-				continue
-			}
-			paramIdent, ok := fun.Type.Params.List[1].Type.(*ast.Ident)
-			if !ok {
-				continue
-			}
-			paramName := paramIdent.Name
+func apigenUnescape(seg string) string {
+	if v, err := url.PathUnescape(seg); err == nil {
+		return v
+	}
+	return seg
+}
 
-			fields, ok := validators[paramName]
-			if !ok {
-				fields = findAndParseValidators(node, paramName)
-				validators[paramName] = fields
-			}
+// apigenJSONString приводит значение из json к тому же виду, что пришёл бы в форме
+func apigenJSONString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
 
-			h := APIHandler{
-				APIMeta:    meta,
-				Name:       fun.Name.Name,
-				Receiver:   receiver,
-				Fields:     fields,
-				ParamsName: paramName,
-			}
+// apigenAtoi - пустое значение это 0, как и раньше. Одно правило и для int, и для элементов []int
+func apigenAtoi(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
 
-			api := apis[receiver]
-			if api == nil {
-				api = &APIServeHTTP{
-					Receiver: receiver,
-				}
-				apis[receiver] = api
-			}
-			api.Handlers = append(api.Handlers, h)
-		}
+func apigenIsEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+`))
+
+func main() {
+	openapiDir := flag.String("openapi", "", "dir for <Receiver>.openapi.json specs, defaults to dir of out.go")
+	clientDir := flag.String("client", "", "dir for generated client packages, defaults to client/ next to out.go")
+	check := flag.Bool("check", false, "dont write anything, exit with 1 if generated files are stale")
+	flag.Parse()
+	if flag.NArg() != 2 {
+		log.Fatalf("usage: %s [-check] [-openapi dir] [-client dir] <in.go|pkgdir> <out.go>", os.Args[0])
+	}
+
+	in := flag.Arg(0)
+	outFile := flag.Arg(1)
+	if *openapiDir == "" {
+		*openapiDir = filepath.Dir(outFile)
 	}
+	if *clientDir == "" {
+		*clientDir = filepath.Join(filepath.Dir(outFile), "client")
+	}
+
+	src := collectAPIs(loadPackage(in, outFile))
+	apis := src.receivers()
 
+	src.header.Imports, src.header.ExtImports = src.imports.list()
+	out := &bytes.Buffer{}
+	if err := headerTpl.Execute(out, src.header); err != nil {
+		log.Fatal(err)
+	}
 	for _, api := range apis {
 		if err := serveHTTPTpl.Execute(out, api); err != nil {
 			log.Fatal(err)
 		}
 	}
-}
 
-func findAndParseValidators(node *ast.File, structName string) []APIField {
-	for _, decl := range node.Decls {
-		g, ok := decl.(*ast.GenDecl)
-		if !ok || g.Tok != token.TYPE {
-			continue
-		}
-		for _, spec := range g.Specs {
-			ts, ok := spec.(*ast.TypeSpec)
-			if !ok || ts.Name.Name != structName {
-				continue
-			}
-			st, ok := ts.Type.(*ast.StructType)
-			if !ok {
-				continue
+	// шаблоны вложены друг в друга, так что отступы правим через gofmt
+	code, err := format.Source(out.Bytes())
+	if err != nil {
+		log.Fatalf("gofmt %s: %v", outFile, err)
+	}
+
+	files := map[string][]byte{outFile: code}
+	for _, api := range apis {
+		files[filepath.Join(*openapiDir, api.Receiver+".openapi.json")] = genOpenAPI(api)
+		pkgName, client := genClient(src, api)
+		files[filepath.Join(*clientDir, pkgName, "client.go")] = client
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if *check {
+		var stale []string
+		for _, name := range names {
+			if old, err := os.ReadFile(name); err != nil || !bytes.Equal(old, files[name]) {
+				stale = append(stale, name)
 			}
-			return parseValidators(st)
 		}
+		if len(stale) > 0 {
+			fmt.Fprintf(os.Stderr, "generated files are stale, rerun %s:\n\t%s\n", filepath.Base(os.Args[0]), strings.Join(stale, "\n\t"))
+			os.Exit(1)
+		}
+		return
 	}
-	return nil
-}
 
-func parseValidators(st *ast.StructType) []APIField {
-	var res []APIField
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(name, files[name], 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
 
+func embedsRegistry(st *ast.StructType) bool {
+	if st == nil {
+		return false
+	}
 	for _, f := range st.Fields.List {
-		if f.Tag == nil || len(f.Names) == 0 {
-			continue
+		if ident, ok := f.Type.(*ast.Ident); ok && len(f.Names) == 0 && ident.Name == "APIRegistry" {
+			return true
 		}
+	}
+	return false
+}
 
-		tag := strings.Trim(f.Tag.Value, "`")
-		stTag := reflect.StructTag(tag)
-		av := stTag.Get("apivalidator")
-		if av == "" {
-			continue
+// parseRules разбирает правила через запятую. each= и regexp= должны идти последними:
+// всё что после each= - правила для каждого элемента слайса, а regexp= забирает остаток тега
+// целиком, чтобы в регулярке можно было писать запятые: regexp=^\d{2,5}$
+func parseRules(fieldName, rules string, v *APIValidator) {
+	parts := strings.Split(rules, ",")
+loop:
+	for i, p := range parts {
+		if strings.HasPrefix(p, "regexp=") {
+			p = strings.Join(parts[i:], ",")
 		}
-
-		v := APIValidator{}
-		switch t := f.Type.(type) {
-		case *ast.Ident:
-			v.Type = t.Name
-		default:
-			continue
+		switch {
+		case p == "required":
+			v.Required = true
+		case p == "email":
+			v.Email = true
+		case strings.HasPrefix(p, "paramname="):
+			v.Paramname = strings.TrimPrefix(p, "paramname=")
+		case strings.HasPrefix(p, "enum="):
+			v.Enum = strings.Split(strings.TrimPrefix(p, "enum="), "|")
+		case strings.HasPrefix(p, "oneof="):
+			v.Enum = strings.Split(strings.TrimPrefix(p, "oneof="), "|")
+		case strings.HasPrefix(p, "default="):
+			v.Default = strings.TrimPrefix(p, "default=")
+		case strings.HasPrefix(p, "min="):
+			v.Min = parseIntRule(fieldName, p)
+		case strings.HasPrefix(p, "max="):
+			v.Max = parseIntRule(fieldName, p)
+		case strings.HasPrefix(p, "len="):
+			v.Len = parseIntRule(fieldName, p)
+		case strings.HasPrefix(p, "regexp="):
+			v.Regexp = strings.TrimPrefix(p, "regexp=")
+			if _, err := regexp.Compile(v.Regexp); err != nil {
+				log.Fatalf("field %s: bad regexp: %v", fieldName, err)
+			}
+			break loop
+		case strings.HasPrefix(p, "each="):
+			if v.Each == nil {
+				log.Fatalf("field %s: each= is allowed only for slices", fieldName)
+			}
+			eachRules := append([]string{strings.TrimPrefix(p, "each=")}, parts[i+1:]...)
+			parseRules(fieldName, strings.Join(eachRules, ","), v.Each)
+			return
 		}
+	}
 
-		parts := strings.Split(av, ",")
-		for _, p := range parts {
-			switch {
-			case p == "required":
-				v.Required = true
-			case strings.HasPrefix(p, "paramname="):
-				v.Paramname = strings.TrimPrefix(p, "paramname=")
-			case strings.HasPrefix(p, "enum="):
-				v.Enum = strings.Split(strings.TrimPrefix(p, "enum="), "|")
-			case strings.HasPrefix(p, "default="):
-				v.Default = strings.TrimPrefix(p, "default=")
-			case strings.HasPrefix(p, "min="):
-				n, err := strconv.Atoi(strings.TrimPrefix(p, "min="))
-				if err == nil {
-					v.Min = &n
-				}
-			case strings.HasPrefix(p, "max="):
-				n, err := strconv.Atoi(strings.TrimPrefix(p, "max="))
-				if err == nil {
-					v.Max = &n
-				}
+	if v.Type == "int" {
+		for _, e := range v.Enum {
+			if _, err := strconv.Atoi(e); err != nil {
+				log.Fatalf("field %s: enum value %q is not int", fieldName, e)
 			}
 		}
+	}
+}
 
-		res = append(res, APIField{
-			Name:      f.Names[0].Name,
-			Validator: v,
-		})
+func parseIntRule(fieldName, rule string) *int {
+	n, err := strconv.Atoi(rule[strings.Index(rule, "=")+1:])
+	if err != nil {
+		log.Fatalf("field %s: bad rule %s: %v", fieldName, rule, err)
 	}
+	return &n
+}
 
+// collectRegexps даёт имена переменным для скомпилированных regexp-ов
+func collectRegexps(structName string, fields []APIField) []*APIValidator {
+	var res []*APIValidator
+	for i := range fields {
+		for _, v := range []*APIValidator{&fields[i].Validator, fields[i].Validator.Each} {
+			if v == nil || v.Regexp == "" {
+				continue
+			}
+			v.RegexpVar = "apigenRe" + structName + fields[i].Name
+			if v == fields[i].Validator.Each {
+				v.RegexpVar += "Each"
+			}
+			res = append(res, v)
+		}
+	}
 	return res
 }
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// пакет грузится целиком через go/packages: методы api могут лежать в разных файлах,
+// а параметры и результаты - в соседних пакетах модуля. Всё, что нужно генератору,
+// берётся из types.Info, а не из AST одного файла
+
+const loadMode = packages.NeedName | packages.NeedFiles | packages.NeedSyntax |
+	packages.NeedTypes | packages.NeedTypesInfo | packages.NeedImports | packages.NeedDeps | packages.NeedModule
+
+// loadPackage грузит пакет, в котором лежит in (файл или папка).
+// out.go подменяется пустым файлом: старый сгенерированный код не должен влиять на разбор
+func loadPackage(in, outFile string) *packages.Package {
+	dir := in
+	if info, err := os.Stat(in); err == nil && !info.IsDir() {
+		dir = filepath.Dir(in)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := &packages.Config{
+		Mode:    loadMode,
+		Dir:     dir,
+		Overlay: map[string][]byte{},
+	}
+	if outAbs, err := filepath.Abs(outFile); err == nil {
+		if f, err := parser.ParseFile(token.NewFileSet(), outAbs, nil, parser.PackageClauseOnly); err == nil {
+			cfg.Overlay[outAbs] = []byte("package " + f.Name.Name + "\n")
+		}
+	}
+
+	pkgs, err := packages.Load(cfg, ".")
+	if err != nil {
+		log.Fatalf("load %s: %v", dir, err)
+	}
+	if len(pkgs) != 1 {
+		log.Fatalf("load %s: expected 1 package, got %d", dir, len(pkgs))
+	}
+	pkg := pkgs[0]
+
+	// ошибки типов терпим: без out.go в пакете нет APIRegistry и прочего сгенерированного.
+	// а вот если пакет не нашёлся или не разобрался - генерить не из чего
+	for _, e := range pkg.Errors {
+		if e.Kind != packages.TypeError {
+			log.Fatalf("load %s: %v", dir, e)
+		}
+	}
+	if pkg.Types == nil || pkg.TypesInfo == nil {
+		log.Fatalf("load %s: no type info", dir)
+	}
+	return pkg
+}
+
+// sortedFiles - файлы пакета по имени, от этого зависит порядок хендлеров в выводе
+func sortedFiles(pkg *packages.Package) []*ast.File {
+	files := append([]*ast.File{}, pkg.Syntax...)
+	sort.Slice(files, func(i, j int) bool {
+		return pkg.Fset.Position(files[i].Pos()).Filename < pkg.Fset.Position(files[j].Pos()).Filename
+	})
+	return files
+}
+
+// importSet - импорты сгенерированного файла для типов из других пакетов
+type importSet struct {
+	self   *types.Package
+	module string
+	names  map[string]string // path -> имя в файле
+	real   map[string]string // path -> имя пакета
+	used   map[string]bool   // занятые имена
+}
+
+type importSpec struct {
+	Name string
+	Path string
+}
+
+func newImportSet(self *types.Package, reserved ...string) *importSet {
+	s := &importSet{
+		self:  self,
+		names: make(map[string]string),
+		real:  make(map[string]string),
+		used:  make(map[string]bool),
+	}
+	for _, name := range reserved {
+		s.used[name] = true
+	}
+	return s
+}
+
+func (s *importSet) qualifier(p *types.Package) string {
+	if p == nil || (s.self != nil && p.Path() == s.self.Path()) {
+		return ""
+	}
+	if name, ok := s.names[p.Path()]; ok {
+		return name
+	}
+	name := p.Name()
+	for i := 2; s.used[name]; i++ {
+		name = p.Name() + strconv.Itoa(i)
+	}
+	s.used[name] = true
+	s.names[p.Path()] = name
+	s.real[p.Path()] = p.Name()
+	return name
+}
+
+// list - импорты в стабильном порядке, alias только если имя не совпадает с пакетом.
+// stdlib идёт в общий блок, всё остальное - отдельной группой
+func (s *importSet) list() (std, ext []importSpec) {
+	paths := make([]string, 0, len(s.names))
+	for path := range s.names {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		spec := importSpec{Path: path}
+		if s.names[path] != s.real[path] {
+			spec.Name = s.names[path]
+		}
+		first := strings.SplitN(path, "/", 2)[0]
+		if strings.Contains(first, ".") || path == s.module || strings.HasPrefix(path, s.module+"/") {
+			ext = append(ext, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	return std, ext
+}
+
+// stdImports - то, что импортирует headerTpl; чужие пакеты с такими именами получат alias
+var stdImports = []string{"context", "json", "errors", "fmt", "io", "mime", "http", "mail", "url", "regexp", "strconv", "strings", "sync"}
+
+// apiSource - распарсенный пакет и всё, что генератор из него достал
+type apiSource struct {
+	pkg     *packages.Package
+	imports *importSet
+	header  APIHeader
+	apis    map[string]*APIServeHTTP
+	fields  map[*types.Named][]APIField
+	// authSchemes - receiver -> имя аутентификатора -> securityScheme из apigen:auth
+	authSchemes map[string]map[string]spec
+}
+
+func collectAPIs(pkg *packages.Package) *apiSource {
+	src := &apiSource{
+		pkg:         pkg,
+		imports:     newImportSet(pkg.Types, stdImports...),
+		header:      APIHeader{Package: pkg.Name},
+		apis:        make(map[string]*APIServeHTTP),
+		fields:      make(map[*types.Named][]APIField),
+		authSchemes: make(map[string]map[string]spec),
+	}
+
+	if pkg.Module != nil {
+		src.imports.module = pkg.Module.Path
+	}
+
+	for _, file := range sortedFiles(pkg) {
+		for _, decl := range file.Decls {
+			if gen, ok := decl.(*ast.GenDecl); ok {
+				src.addAuthSchemes(gen)
+				continue
+			}
+			fun, ok := decl.(*ast.FuncDecl)
+			if !ok || fun.Doc == nil {
+				continue
+			}
+			for _, c := range fun.Doc.List {
+				if strings.HasPrefix(c.Text, "// apigen:api") {
+					src.addHandler(fun, c.Text)
+				}
+			}
+		}
+	}
+	for receiver, schemes := range src.authSchemes {
+		if api := src.apis[receiver]; api != nil {
+			api.AuthSchemes = schemes
+		}
+	}
+	return src
+}
+
+// addAuthSchemes читает комментарии вида
+//
+//	// apigen:auth default {"type": "apiKey", "in": "header", "name": "X-Auth"}
+//
+// над типом api. Аутентификаторы регистрируются в рантайме, и как они проверяют запрос,
+// генератор сам узнать не может - для openapi это можно только объявить
+func (src *apiSource) addAuthSchemes(gen *ast.GenDecl) {
+	for _, s := range gen.Specs {
+		ts, ok := s.(*ast.TypeSpec)
+		if !ok {
+			continue
+		}
+		doc := ts.Doc
+		if doc == nil && len(gen.Specs) == 1 {
+			doc = gen.Doc
+		}
+		if doc == nil {
+			continue
+		}
+		for _, c := range doc.List {
+			if !strings.HasPrefix(c.Text, "// apigen:auth ") {
+				continue
+			}
+			pos := src.pkg.Fset.Position(c.Pos())
+			name, jsonText, _ := strings.Cut(strings.TrimPrefix(c.Text, "// apigen:auth "), " ")
+			scheme := spec{}
+			if err := json.Unmarshal([]byte(jsonText), &scheme); err != nil {
+				log.Fatalf("%s: cant parse apigen:auth json for %s: %v", pos, name, err)
+			}
+			if _, ok := scheme["type"]; !ok {
+				log.Fatalf("%s: apigen:auth %s: securityScheme must have type", pos, name)
+			}
+			if src.authSchemes[ts.Name.Name] == nil {
+				src.authSchemes[ts.Name.Name] = map[string]spec{}
+			}
+			src.authSchemes[ts.Name.Name][name] = scheme
+		}
+	}
+}
+
+func (src *apiSource) addHandler(fun *ast.FuncDecl, comment string) {
+	pos := src.pkg.Fset.Position(fun.Pos())
+	obj, ok := src.pkg.TypesInfo.Defs[fun.Name].(*types.Func)
+	if !ok {
+		return
+	}
+	sig := obj.Type().(*types.Signature)
+	if sig.Recv() == nil {
+		return
+	}
+	recvPtr, ok := sig.Recv().Type().(*types.Pointer)
+	if !ok {
+		return
+	}
+	recvNamed, ok := recvPtr.Elem().(*types.Named)
+	if !ok {
+		return
+	}
+	receiver := recvNamed.Obj().Name()
+
+	var meta APIMeta
+	jsonText := strings.TrimPrefix(comment, "// apigen:api ")
+	if err := json.Unmarshal([]byte(jsonText), &meta); err != nil {
+		log.Fatalf("%s: cant parse apigen json for %s: %v", pos, fun.Name.Name, err)
+	}
+
+	if sig.Params().Len() != 2 || sig.Results().Len() != 2 {
+		log.Fatalf("%s: %s.%s must be func(ctx, Params) (*Result, error)", pos, receiver, fun.Name.Name)
+	}
+	paramsType, ok := sig.Params().At(1).Type().(*types.Named)
+	if !ok {
+		log.Fatalf("%s: %s.%s: params must be a named struct", pos, receiver, fun.Name.Name)
+	}
+	if _, ok := paramsType.Underlying().(*types.Struct); !ok {
+		log.Fatalf("%s: %s.%s: params must be a named struct", pos, receiver, fun.Name.Name)
+	}
+	resultType := sig.Results().At(0).Type()
+	if ptr, ok := resultType.(*types.Pointer); ok {
+		resultType = ptr.Elem()
+	}
+
+	fields, ok := src.fields[paramsType]
+	if !ok {
+		fields = parseValidators(paramsType)
+		src.fields[paramsType] = fields
+		src.header.Regexps = append(src.header.Regexps, collectRegexps(src.regexpPrefix(paramsType), fields)...)
+	}
+
+	h := APIHandler{
+		APIMeta:       meta,
+		Name:          fun.Name.Name,
+		Receiver:      receiver,
+		Fields:        fields,
+		ParamsExpr:    types.TypeString(paramsType, src.imports.qualifier),
+		ParamsType:    paramsType,
+		ResultType:    resultType,
+		ErrorStatuses: apiErrorStatuses(src.pkg.TypesInfo, fun),
+		PathParams:    urlPathParams(meta.URL),
+	}
+	for _, name := range h.PathParams {
+		found := false
+		for _, f := range fields {
+			found = found || f.ParamName() == name
+		}
+		if !found {
+			log.Fatalf("%s: %s.%s: no field in %s for path param {%s}", pos, receiver, h.Name, h.ParamsExpr, name)
+		}
+	}
+
+	if (meta.Auth != "" || len(meta.Middleware) > 0) && !embedsRegistry(findStruct(src.pkg, receiver)) {
+		log.Fatalf("%s: %s.%s uses auth or middleware, so %s must embed APIRegistry", pos, receiver, fun.Name.Name, receiver)
+	}
+
+	api := src.apis[receiver]
+	if api == nil {
+		api = &APIServeHTTP{
+			Receiver: receiver,
+		}
+		src.apis[receiver] = api
+	}
+	api.Handlers = append(api.Handlers, h)
+}
+
+// regexpPrefix - часть имени переменной для regexp-ов: у типов из других пакетов
+// добавляем имя пакета, чтобы одинаковые имена структур не пересеклись
+func (src *apiSource) regexpPrefix(t *types.Named) string {
+	name := t.Obj().Name()
+	if p := t.Obj().Pkg(); p != nil && p.Path() != src.pkg.PkgPath {
+		name = strings.ToUpper(p.Name()[:1]) + p.Name()[1:] + name
+	}
+	return name
+}
+
+// receivers - в алфавитном порядке, чтобы вывод не зависел от обхода map
+func (src *apiSource) receivers() []*APIServeHTTP {
+	names := make([]string, 0, len(src.apis))
+	for name := range src.apis {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res := make([]*APIServeHTTP, 0, len(names))
+	for _, name := range names {
+		res = append(res, src.apis[name])
+	}
+	return res
+}
+
+// findStruct ищет объявление структуры во всех файлах пакета
+func findStruct(pkg *packages.Package, name string) *ast.StructType {
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			g, ok := decl.(*ast.GenDecl)
+			if !ok || g.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range g.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok || ts.Name.Name != name {
+					continue
+				}
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					return st
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func parseValidators(named *types.Named) []APIField {
+	st := named.Underlying().(*types.Struct)
+	var res []APIField
+
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		if f.Embedded() {
+			continue
+		}
+		av := reflect.StructTag(st.Tag(i)).Get("apivalidator")
+		if av == "" {
+			continue
+		}
+
+		v := APIValidator{}
+		switch t := f.Type().Underlying().(type) {
+		case *types.Basic:
+			v.Type = t.Name()
+		case *types.Slice:
+			if elem, ok := t.Elem().Underlying().(*types.Basic); ok {
+				v.Type = "[]" + elem.Name()
+				v.Each = &APIValidator{Type: elem.Name()}
+			}
+		}
+		// именованные типы поверх int/string не поддерживаем: генерится присваивание без конверсии
+		if _, ok := f.Type().(*types.Named); ok {
+			v.Type = f.Type().String()
+		}
+		switch v.Type {
+		case "int", "string", "[]int", "[]string":
+		default:
+			log.Fatalf("%s.%s: unsupported type %s", named.Obj().Name(), f.Name(), f.Type())
+		}
+
+		parseRules(f.Name(), av, &v)
+
+		res = append(res, APIField{
+			Name:      f.Name(),
+			Validator: v,
+		})
+	}
+
+	return res
+}
+
+// apiErrorStatuses ищет в теле метода ApiError{http.StatusXxx, ...} - это и есть
+// коды ошибок, которые метод может вернуть помимо валидации. Значение статуса
+// берётся из type checker-а, так что подходят и константы, и выражения над ними
+func apiErrorStatuses(info *types.Info, fun *ast.FuncDecl) []int {
+	if fun.Body == nil {
+		return nil
+	}
+	seen := map[int]bool{}
+	ast.Inspect(fun.Body, func(n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok || len(lit.Elts) == 0 {
+			return true
+		}
+		t := info.TypeOf(lit)
+		if ptr, ok := t.(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		named, ok := t.(*types.Named)
+		if !ok || named.Obj().Name() != "ApiError" {
+			return true
+		}
+		status := lit.Elts[0]
+		for _, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				if key, ok := kv.Key.(*ast.Ident); ok && key.Name == "HTTPStatus" {
+					status = kv.Value
+				}
+			}
+		}
+		if tv, ok := info.Types[status]; ok && tv.Value != nil && tv.Value.Kind() == constant.Int {
+			if code, ok := constant.Int64Val(tv.Value); ok && code != 0 {
+				seen[int(code)] = true
+			}
+		}
+		return true
+	})
+
+	res := make([]int, 0, len(seen))
+	for code := range seen {
+		res = append(res, code)
+	}
+	sort.Ints(res)
+	return res
+}
+
+// modulePackage - тип объявлен в этом же модуле, его можно скопировать в клиент
+func (src *apiSource) modulePackage(p *types.Package) bool {
+	if p == nil {
+		return false
+	}
+	if src.pkg.Module == nil {
+		return p.Path() == src.pkg.PkgPath
+	}
+	mod := src.pkg.Module.Path
+	return p.Path() == mod || strings.HasPrefix(p.Path(), mod+"/")
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"go/types"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// openapi-спеку собираем из тех же APIHandler/APIField, по которым генерим хендлеры,
+// поэтому она не может разойтись с реальным поведением ServeHTTP
+
+type spec map[string]interface{}
+
+// goToSchema - простые типы go в типы json schema
+var goToSchema = map[string]spec{
+	"int":     {"type": "integer"},
+	"int32":   {"type": "integer", "format": "int32"},
+	"int64":   {"type": "integer", "format": "int64"},
+	"uint":    {"type": "integer", "minimum": 0},
+	"uint32":  {"type": "integer", "format": "int32", "minimum": 0},
+	"uint64":  {"type": "integer", "format": "int64", "minimum": 0},
+	"float32": {"type": "number", "format": "float"},
+	"float64": {"type": "number", "format": "double"},
+	"string":  {"type": "string"},
+	"bool":    {"type": "boolean"},
+}
+
+func genOpenAPI(api *APIServeHTTP) []byte {
+	schemas := spec{
+		"Error": spec{
+			"type":     "object",
+			"required": []string{"error"},
+			"properties": spec{
+				"error": spec{"type": "string"},
+			},
+		},
+	}
+
+	paths := spec{}
+	securitySchemes := spec{}
+	for _, h := range api.Handlers {
+		op := operationSpec(h, schemas)
+		// как именно аутентификатор проверяет запрос, знает только код, который его зарегистрировал.
+		// Если схему не объявили через apigen:auth, выдумывать её не будем - только имя
+		if name := string(h.Auth); name != "" {
+			if scheme, ok := api.AuthSchemes[name]; ok {
+				securitySchemes[name] = scheme
+				op["security"] = []spec{{name: []string{}}}
+			} else {
+				op["x-apigen-auth"] = name
+			}
+		}
+		path, ok := paths[h.URL].(spec)
+		if !ok {
+			path = spec{}
+			paths[h.URL] = path
+		}
+		path[operationMethod(h)] = op
+	}
+
+	doc := spec{
+		"openapi": "3.0.3",
+		"info": spec{
+			"title":   api.Receiver,
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": spec{
+			"schemas":         schemas,
+			"securitySchemes": securitySchemes,
+		},
+	}
+
+	// encoding/json сортирует ключи map, так что вывод стабилен между запусками
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	return append(data, '\n')
+}
+
+// без явного method хендлер отвечает на любой, в спеке описываем его как GET
+func operationMethod(h APIHandler) string {
+	if h.Method == "" {
+		return "get"
+	}
+	return strings.ToLower(h.Method)
+}
+
+func operationSpec(h APIHandler, schemas spec) spec {
+	op := spec{
+		"operationId": h.Receiver + h.Name,
+		"tags":        []string{h.Receiver},
+	}
+
+	properties := spec{}
+	required := []string{}
+	params := []spec{}
+	pathParams := []spec{}
+	for _, f := range h.Fields {
+		name := f.ParamName()
+		schema := paramSchema(f.Validator)
+		if h.IsPathParam(name) {
+			pathParams = append(pathParams, spec{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   schema,
+			})
+			continue
+		}
+		if f.Validator.Required {
+			required = append(required, name)
+		}
+		params = append(params, spec{
+			"name":     name,
+			"in":       "query",
+			"required": f.Validator.Required,
+			"schema":   schema,
+		})
+		properties[name] = schema
+	}
+
+	// параметры читаются и из query, и из тела формы или json - для POST описываем тело
+	if h.Method == http.MethodPost && len(properties) > 0 {
+		body := spec{
+			"type":       "object",
+			"properties": properties,
+		}
+		if len(required) > 0 {
+			body["required"] = required
+		}
+		op["requestBody"] = spec{
+			"required": len(required) > 0,
+			"content": spec{
+				"application/x-www-form-urlencoded": spec{"schema": body},
+				"application/json":                  spec{"schema": body},
+			},
+		}
+		params = nil
+	}
+	if all := append(pathParams, params...); len(all) > 0 {
+		op["parameters"] = all
+	}
+
+	responses := spec{
+		"200": spec{
+			"description": "OK",
+			"content": spec{
+				"application/json": spec{"schema": spec{
+					"type":     "object",
+					"required": []string{"error", "response"},
+					"properties": spec{
+						"error":    spec{"type": "string", "enum": []string{""}},
+						"response": typeSchema(h.ResultType, schemas),
+					},
+				}},
+			},
+		},
+	}
+	errorCodes := append([]int{}, h.ErrorStatuses...)
+	if len(h.Fields) > 0 {
+		errorCodes = append(errorCodes, http.StatusBadRequest)
+	}
+	if h.Auth != "" {
+		errorCodes = append(errorCodes, http.StatusForbidden)
+	}
+	if h.Method != "" {
+		errorCodes = append(errorCodes, http.StatusMethodNotAllowed)
+	}
+	errorCodes = append(errorCodes, http.StatusInternalServerError)
+	for _, code := range errorCodes {
+		responses[strconv.Itoa(code)] = spec{
+			"description": http.StatusText(code),
+			"content": spec{
+				"application/json": spec{"schema": spec{"$ref": "#/components/schemas/Error"}},
+			},
+		}
+	}
+	op["responses"] = responses
+
+	return op
+}
+
+func paramSchema(v APIValidator) spec {
+	if v.Each != nil {
+		schema := spec{
+			"type":  "array",
+			"items": paramSchema(*v.Each),
+		}
+		if v.Min != nil {
+			schema["minItems"] = *v.Min
+		}
+		if v.Max != nil {
+			schema["maxItems"] = *v.Max
+		}
+		if v.Len != nil {
+			schema["minItems"] = *v.Len
+			schema["maxItems"] = *v.Len
+		}
+		return schema
+	}
+
+	schema := spec{}
+	for k, val := range goToSchema[v.Type] {
+		schema[k] = val
+	}
+	if v.Type == "int" {
+		if v.Min != nil {
+			schema["minimum"] = *v.Min
+		}
+		if v.Max != nil {
+			schema["maximum"] = *v.Max
+		}
+		if v.Default != "" {
+			if n, err := strconv.Atoi(v.Default); err == nil {
+				schema["default"] = n
+			}
+		}
+		if len(v.Enum) > 0 {
+			enum := make([]int, 0, len(v.Enum))
+			for _, e := range v.Enum {
+				n, _ := strconv.Atoi(e)
+				enum = append(enum, n)
+			}
+			schema["enum"] = enum
+		}
+		return schema
+	}
+
+	if v.Min != nil {
+		schema["minLength"] = *v.Min
+	}
+	if v.Max != nil {
+		schema["maxLength"] = *v.Max
+	}
+	if v.Len != nil {
+		schema["minLength"] = *v.Len
+		schema["maxLength"] = *v.Len
+	}
+	if v.Default != "" {
+		schema["default"] = v.Default
+	}
+	if len(v.Enum) > 0 {
+		schema["enum"] = v.Enum
+	}
+	if v.Regexp != "" {
+		schema["pattern"] = v.Regexp
+	}
+	if v.Email {
+		schema["format"] = "email"
+	}
+	return schema
+}
+
+// typeSchema описывает тип результата, именованные структуры складываются в components/schemas.
+// Поля встроенных структур поднимаются наверх, как это делает encoding/json
+func typeSchema(t types.Type, schemas spec) spec {
+	if named, ok := t.(*types.Named); ok {
+		obj := named.Obj()
+		if obj.Pkg() != nil && obj.Pkg().Path() == "time" && obj.Name() == "Time" {
+			return spec{"type": "string", "format": "date-time"}
+		}
+		if _, ok := named.Underlying().(*types.Struct); !ok {
+			return typeSchema(named.Underlying(), schemas)
+		}
+
+		name := obj.Name()
+		ref := spec{"$ref": "#/components/schemas/" + name}
+		if _, done := schemas[name]; done {
+			return ref
+		}
+		// ставим заглушку до обхода полей, чтобы не зациклиться на рекурсивных типах
+		schemas[name] = spec{}
+		schemas[name] = typeSchema(named.Underlying(), schemas)
+		return ref
+	}
+
+	switch t := t.(type) {
+	case *types.Basic:
+		if s, ok := goToSchema[t.Name()]; ok {
+			return s
+		}
+	case *types.Pointer:
+		return typeSchema(t.Elem(), schemas)
+	case *types.Slice:
+		return spec{"type": "array", "items": typeSchema(t.Elem(), schemas)}
+	case *types.Array:
+		return spec{"type": "array", "items": typeSchema(t.Elem(), schemas)}
+	case *types.Map:
+		return spec{"type": "object", "additionalProperties": typeSchema(t.Elem(), schemas)}
+	case *types.Struct:
+		properties := spec{}
+		addStructProperties(t, properties, schemas)
+		return spec{
+			"type":       "object",
+			"properties": properties,
+		}
+	}
+	return spec{}
+}
+
+func addStructProperties(st *types.Struct, properties, schemas spec) {
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		tag := reflect.StructTag(st.Tag(i)).Get("json")
+		tagName := strings.Split(tag, ",")[0]
+		if tagName == "-" {
+			continue
+		}
+		if f.Embedded() && tagName == "" {
+			ft := f.Type()
+			if ptr, ok := ft.(*types.Pointer); ok {
+				ft = ptr.Elem()
+			}
+			if embedded, ok := ft.Underlying().(*types.Struct); ok {
+				addStructProperties(embedded, properties, schemas)
+				continue
+			}
+		}
+		if !f.Exported() {
+			continue
+		}
+		jsonName := f.Name()
+		if tagName != "" {
+			jsonName = tagName
+		}
+		properties[jsonName] = typeSchema(f.Type(), schemas)
+	}
+}
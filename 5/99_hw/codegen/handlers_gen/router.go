@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// роутер строится на этапе генерации: url-шаблоны складываются в trie по сегментам пути,
+// а trie разворачивается во вложенные switch-и. Статические сегменты проверяются раньше {param}
+
+type routeNode struct {
+	static    map[string]*routeNode
+	param     *routeNode
+	paramName string
+	// handlers - методы, у которых url заканчивается в этом узле, по http-методу.
+	// "" - метод без "method", отвечает на любой
+	handlers map[string]APIHandler
+}
+
+func newRouteNode() *routeNode {
+	return &routeNode{
+		static:   make(map[string]*routeNode),
+		handlers: make(map[string]APIHandler),
+	}
+}
+
+// pathSegments - сегменты url-шаблона, для "/" - пустой список
+func pathSegments(url string) []string {
+	url = strings.Trim(url, "/")
+	if url == "" {
+		return nil
+	}
+	return strings.Split(url, "/")
+}
+
+// pathParamName возвращает имя для сегмента вида {name}
+func pathParamName(seg string) (string, bool) {
+	if len(seg) > 2 && strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+		return seg[1 : len(seg)-1], true
+	}
+	return "", false
+}
+
+// urlPathParams - имена параметров из url-шаблона в порядке следования
+func urlPathParams(url string) []string {
+	var res []string
+	for _, seg := range pathSegments(url) {
+		if name, ok := pathParamName(seg); ok {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+func buildRoutes(api *APIServeHTTP) *routeNode {
+	root := newRouteNode()
+	for _, h := range api.Handlers {
+		node := root
+		for _, seg := range pathSegments(h.URL) {
+			name, isParam := pathParamName(seg)
+			if !isParam {
+				child := node.static[seg]
+				if child == nil {
+					child = newRouteNode()
+					node.static[seg] = child
+				}
+				node = child
+				continue
+			}
+			if node.param == nil {
+				node.param = newRouteNode()
+				node.paramName = name
+			}
+			if node.paramName != name {
+				log.Fatalf("%s.%s: path param {%s} conflicts with {%s} at the same position", api.Receiver, h.Name, name, node.paramName)
+			}
+			node = node.param
+		}
+
+		method := strings.ToUpper(h.Method)
+		if prev, ok := node.handlers[method]; ok {
+			log.Fatalf("%s.%s: %s %s is already handled by %s", api.Receiver, h.Name, method, h.URL, prev.Name)
+		}
+		node.handlers[method] = h
+	}
+	return root
+}
+
+// genRouter - тело ServeHTTP
+func genRouter(api *APIServeHTTP) string {
+	b := &strings.Builder{}
+	fmt.Fprintln(b, "segs := apigenSplitPath(r.URL.EscapedPath())")
+	genRouteNode(b, api, buildRoutes(api), 0)
+	fmt.Fprint(b, `w.WriteHeader(http.StatusNotFound)
+_ = json.NewEncoder(w).Encode(map[string]interface{}{
+	"error": "unknown method",
+})`)
+	return b.String()
+}
+
+func genRouteNode(b *strings.Builder, api *APIServeHTTP, node *routeNode, depth int) {
+	d := strconv.Itoa(depth)
+
+	if len(node.handlers) > 0 {
+		fmt.Fprintf(b, "if len(segs) == %s {\n", d)
+		genDispatch(b, api, node)
+		fmt.Fprintln(b, "return")
+		fmt.Fprintln(b, "}")
+	}
+
+	if len(node.static) == 0 && node.param == nil {
+		return
+	}
+
+	fmt.Fprintf(b, "if len(segs) > %s {\n", d)
+	if len(node.static) > 0 {
+		segs := make([]string, 0, len(node.static))
+		for seg := range node.static {
+			segs = append(segs, seg)
+		}
+		sort.Strings(segs)
+
+		fmt.Fprintf(b, "switch segs[%s] {\n", d)
+		for _, seg := range segs {
+			fmt.Fprintf(b, "case %q:\n", seg)
+			genRouteNode(b, api, node.static[seg], depth+1)
+		}
+		fmt.Fprintln(b, "}")
+	}
+	if node.param != nil {
+		// если глубже ничего не нашлось - откатываем параметр, чтобы он не утёк в другой маршрут
+		fmt.Fprintf(b, "r.SetPathValue(%q, apigenUnescape(segs[%s]))\n", node.paramName, d)
+		genRouteNode(b, api, node.param, depth+1)
+		fmt.Fprintf(b, "r.SetPathValue(%q, \"\")\n", node.paramName)
+	}
+	fmt.Fprintln(b, "}")
+}
+
+func genDispatch(b *strings.Builder, api *APIServeHTTP, node *routeNode) {
+	methods := make([]string, 0, len(node.handlers))
+	for method := range node.handlers {
+		if method != "" {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+
+	if len(methods) == 0 {
+		genCall(b, api, node.handlers[""])
+		return
+	}
+
+	fmt.Fprintln(b, "switch r.Method {")
+	for _, method := range methods {
+		fmt.Fprintf(b, "case %q:\n", method)
+		genCall(b, api, node.handlers[method])
+	}
+	fmt.Fprintln(b, "default:")
+	if h, ok := node.handlers[""]; ok {
+		genCall(b, api, h)
+	} else {
+		fmt.Fprintf(b, `w.Header().Set("Allow", %q)
+w.WriteHeader(http.StatusMethodNotAllowed)
+_ = json.NewEncoder(w).Encode(map[string]interface{}{
+	"error": "bad method",
+})
+`, strings.Join(methods, ", "))
+	}
+	fmt.Fprintln(b, "}")
+}
+
+func genCall(b *strings.Builder, api *APIServeHTTP, h APIHandler) {
+	handler := "api.handler" + api.Receiver + h.Name
+	if len(h.Middleware) == 0 {
+		fmt.Fprintf(b, "%s(w, r)\n", handler)
+		return
+	}
+	quoted := make([]string, 0, len(h.Middleware))
+	for _, m := range h.Middleware {
+		quoted = append(quoted, strconv.Quote(m))
+	}
+	fmt.Fprintf(b, "api.APIRegistry.serve(w, r, []string{%s}, %s)\n", strings.Join(quoted, ", "), handler)
+}
@@ -0,0 +1,28 @@
+// Package models - параметры и ответы, которые живут вне package main.
+// Генератор находит их через go/packages, копировать типы в api.go не нужно
+package models
+
+import "time"
+
+type SearchParams struct {
+	Query string   `apivalidator:"required,min=2,regexp=^[a-z0-9 ]+$"`
+	Limit int      `apivalidator:"min=1,max=100,default=10"`
+	Tags  []string `apivalidator:"each=oneof=go|web|db"`
+}
+
+type Page struct {
+	Total int `json:"total"`
+	Limit int `json:"limit"`
+}
+
+type SearchUser struct {
+	Login string   `json:"login"`
+	Tags  []string `json:"tags"`
+}
+
+// SearchResult - Page встроена, в json её поля лежат на верхнем уровне
+type SearchResult struct {
+	Page
+	Users     []SearchUser `json:"users"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// спека генерируется вместе с api_handlers.go, проверяем что она описывает те же правила
+func loadSpec(t *testing.T, fileName string) map[string]interface{} {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("cant read spec: %v", err)
+	}
+	spec := map[string]interface{}{}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("cant unpack spec: %v", err)
+	}
+	return spec
+}
+
+func dig(t *testing.T, data interface{}, path ...string) interface{} {
+	for _, key := range path {
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			t.Fatalf("%v: not an object at %q", path, key)
+		}
+		data, ok = m[key]
+		if !ok {
+			t.Fatalf("%v: no key %q", path, key)
+		}
+	}
+	return data
+}
+
+func TestOpenAPIMyApi(t *testing.T) {
+	spec := loadSpec(t, "MyApi.openapi.json")
+
+	create := dig(t, spec, "paths", ApiUserCreate, "post")
+	responses := dig(t, create, "responses").(map[string]interface{})
+	for _, code := range []string{"200", "400", "403", "405", "409", "500"} {
+		if _, ok := responses[code]; !ok {
+			t.Errorf("create: no response for %s", code)
+		}
+	}
+
+	props := dig(t, create, "requestBody", "content", "application/x-www-form-urlencoded", "schema", "properties")
+	expected := CR{
+		"login":     CR{"type": "string", "minLength": 10},
+		"full_name": CR{"type": "string"},
+		"status":    CR{"type": "string", "enum": []string{"user", "moderator", "admin"}, "default": "user"},
+		"age":       CR{"type": "integer", "minimum": 0, "maximum": 128},
+	}
+	var expectedProps interface{}
+	data, _ := json.Marshal(expected)
+	json.Unmarshal(data, &expectedProps)
+	if !reflect.DeepEqual(props, expectedProps) {
+		t.Errorf("create params not match\nGot: %#v\nExpected: %#v", props, expectedProps)
+	}
+
+	required := dig(t, create, "requestBody", "content", "application/x-www-form-urlencoded", "schema", "required")
+	if !reflect.DeepEqual(required, []interface{}{"login"}) {
+		t.Errorf("create: bad required list %#v", required)
+	}
+
+	profile := dig(t, spec, "paths", ApiUserProfile, "get")
+	if _, ok := dig(t, profile, "responses").(map[string]interface{})["404"]; !ok {
+		t.Errorf("profile: no response for 404")
+	}
+	ref := dig(t, profile, "responses", "200", "content", "application/json", "schema", "properties", "response", "$ref")
+	if ref != "#/components/schemas/User" {
+		t.Errorf("profile: bad response schema %v", ref)
+	}
+	dig(t, spec, "components", "schemas", "User", "properties", "full_name")
+}
+
+func TestOpenAPIOtherApi(t *testing.T) {
+	spec := loadSpec(t, "OtherApi.openapi.json")
+
+	level := dig(t, spec, "paths", ApiUserCreate, "post", "requestBody", "content",
+		"application/x-www-form-urlencoded", "schema", "properties", "level")
+	if !reflect.DeepEqual(level, map[string]interface{}{"type": "integer", "minimum": 1.0, "maximum": 50.0}) {
+		t.Errorf("bad level schema %#v", level)
+	}
+	dig(t, spec, "paths", ApiUserCreate, "post", "requestBody", "content",
+		"application/x-www-form-urlencoded", "schema", "properties", "account_name")
+
+	// default объявлен через apigen:auth, а про session генератор ничего не знает - схемы нет, только имя
+	schemes := dig(t, spec, "components", "securitySchemes").(map[string]interface{})
+	expected := map[string]interface{}{"default": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-Auth"}}
+	if !reflect.DeepEqual(schemes, expected) {
+		t.Errorf("bad securitySchemes %#v", schemes)
+	}
+	dig(t, spec, "paths", ApiUserCreate, "post", "security")
+	me := dig(t, spec, "paths", "/user/me", "get").(map[string]interface{})
+	if _, ok := me["security"]; ok || me["x-apigen-auth"] != "session" {
+		t.Errorf("/user/me: expected only x-apigen-auth, got security %v, x-apigen-auth %v", me["security"], me["x-apigen-auth"])
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"codegenhw/client/myapi"
+)
+
+func TestMyApiPathParams(t *testing.T) {
+	ts := httptest.NewServer(NewMyApi())
+	defer ts.Close()
+
+	rvasily := CR{
+		"id":        42,
+		"login":     "rvasily",
+		"full_name": "Vasily Romanov",
+		"status":    20,
+	}
+
+	cases := []Case{
+		Case{ // login берётся из пути, а не из query
+			Path:   "/users/rvasily",
+			Query:  "login=not_exist_user",
+			Status: http.StatusOK,
+			Result: CR{
+				"error":    "",
+				"response": rvasily,
+			},
+		},
+		Case{
+			Path:   "/users/not_exist_user",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "user not exist",
+			},
+		},
+		Case{
+			Path:   "/users/rvasily",
+			Method: http.MethodDelete,
+			Status: http.StatusForbidden,
+			Result: CR{
+				"error": "unauthorized",
+			},
+		},
+		Case{
+			Path:   "/users/rvasily",
+			Method: http.MethodDelete,
+			Auth:   true,
+			Status: http.StatusOK,
+			Result: CR{
+				"error":    "",
+				"response": rvasily,
+			},
+		},
+		Case{
+			Path:   "/users/rvasily",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "user not exist",
+			},
+		},
+		Case{ // лишний сегмент
+			Path:   "/users/rvasily/profile",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown method",
+			},
+		},
+		Case{
+			Path:   "/users/",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown method",
+			},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
+func TestMyApiMethodNotAllowed(t *testing.T) {
+	ts := httptest.NewServer(NewMyApi())
+	defer ts.Close()
+
+	cases := []struct {
+		Method string
+		Path   string
+		Allow  string
+	}{
+		{http.MethodPut, "/users/rvasily", "DELETE, GET"},
+		{http.MethodGet, ApiUserCreate, "POST"},
+	}
+	for idx, item := range cases {
+		req, _ := http.NewRequest(item.Method, ts.URL+item.Path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("[%d] request error: %v", idx, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("[%d] expected http status %v, got %v", idx, http.StatusMethodNotAllowed, resp.StatusCode)
+		}
+		if allow := resp.Header.Get("Allow"); allow != item.Allow {
+			t.Errorf("[%d] expected Allow %q, got %q", idx, item.Allow, allow)
+		}
+	}
+}
+
+func TestMyApiClientPathParams(t *testing.T) {
+	ts := httptest.NewServer(NewMyApi())
+	defer ts.Close()
+
+	ctx := context.Background()
+	c := myapi.New(ts.URL)
+	c.AuthToken = "100500"
+
+	// логин со слешем должен уйти одним сегментом
+	_, err := c.Get(ctx, myapi.ProfileParams{Login: "a/b"})
+	checkApiError(t, err, http.StatusNotFound, "user not exist")
+
+	user, err := c.Delete(ctx, myapi.ProfileParams{Login: "rvasily"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &myapi.User{ID: 42, Login: "rvasily", FullName: "Vasily Romanov", Status: 20}
+	if !reflect.DeepEqual(user, expected) {
+		t.Errorf("user not match\nGot: %#v\nExpected: %#v", user, expected)
+	}
+
+	_, err = c.Get(ctx, myapi.ProfileParams{Login: "rvasily"})
+	checkApiError(t, err, http.StatusNotFound, "user not exist")
+}
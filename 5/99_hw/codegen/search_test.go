@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"codegenhw/client/otherapi"
+)
+
+const ApiUserSearch = "/user/search"
+
+// OtherApi.Search лежит в api_search.go, а параметры и ответ - в пакете models
+func TestOtherApiSearch(t *testing.T) {
+	ts := httptest.NewServer(NewOtherApi())
+	defer ts.Close()
+
+	cases := []Case{
+		Case{
+			Path:   ApiUserSearch,
+			Query:  "query=ivan+petr+olga&limit=2&tags=go&tags=db",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"total": 3,
+					"limit": 2,
+					"users": []CR{
+						CR{"login": "ivan", "tags": []string{"go", "db"}},
+						CR{"login": "petr", "tags": []string{"go", "db"}},
+					},
+					"updated_at": "2024-01-02T15:04:05Z",
+				},
+			},
+		},
+		Case{
+			Path:   ApiUserSearch,
+			Query:  "query=Ivan&limit=0&tags=js",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "query must match ^[a-z0-9 ]+$; limit must be >= 1; tags[0] must be one of [go, web, db]",
+			},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
+func TestOtherApiClientSearch(t *testing.T) {
+	ts := httptest.NewServer(NewOtherApi())
+	defer ts.Close()
+
+	res, err := otherapi.New(ts.URL).Search(context.Background(), otherapi.SearchParams{Query: "ivan"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &otherapi.SearchResult{
+		Page:      otherapi.Page{Total: 1, Limit: 10},
+		Users:     []otherapi.SearchUser{{Login: "ivan"}},
+		UpdatedAt: searchUpdatedAt,
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("result not match\nGot: %#v\nExpected: %#v", res, expected)
+	}
+}
+
+func TestOpenAPISearch(t *testing.T) {
+	spec := loadSpec(t, "OtherApi.openapi.json")
+
+	dig(t, spec, "paths", ApiUserSearch, "get", "parameters")
+	// поля встроенной Page поднимаются на верхний уровень, как в encoding/json
+	props := dig(t, spec, "components", "schemas", "SearchResult", "properties").(map[string]interface{})
+	for _, name := range []string{"total", "limit", "users"} {
+		if _, ok := props[name]; !ok {
+			t.Errorf("SearchResult: no property %s", name)
+		}
+	}
+	updatedAt := dig(t, props, "updated_at")
+	if !reflect.DeepEqual(updatedAt, map[string]interface{}{"type": "string", "format": "date-time"}) {
+		t.Errorf("bad updated_at schema %#v", updatedAt)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const ApiUserUpdate = "/user/update"
+
+func TestOtherApiUpdate(t *testing.T) {
+	ts := httptest.NewServer(NewOtherApi())
+	defer ts.Close()
+
+	cases := []Case{
+		Case{ // все правила проходят, слайсы передаются повтором параметра
+			Path:   ApiUserUpdate,
+			Method: http.MethodPost,
+			Query:  "username=ivan_1&email=ivan@mail.ru&code=123456&level=10&tags=go&tags=web&friends=1&friends=2",
+			Auth:   true,
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        14,
+					"login":     "ivan_1",
+					"full_name": "go web",
+					"level":     10,
+				},
+			},
+		},
+		Case{ // level по-умолчанию
+			Path:   ApiUserUpdate,
+			Method: http.MethodPost,
+			Query:  "username=ivan",
+			Auth:   true,
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        12,
+					"login":     "ivan",
+					"full_name": "",
+					"level":     1,
+				},
+			},
+		},
+		Case{ // возвращаются все ошибки сразу, в порядке полей структуры
+			Path:   ApiUserUpdate,
+			Method: http.MethodPost,
+			Query:  "username=ivan%20ivanov&email=ivan&code=123&level=3&tags=a&tags=ok&friends=0&friends=x",
+			Auth:   true,
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "username must match ^[a-zA-Z0-9_]+$; " +
+					"email must be valid email; " +
+					"code len must be == 6; " +
+					"level must be one of [1, 10, 50]; " +
+					"tags[0] len must be >= 2; " +
+					"friends[0] must be >= 1; " +
+					"friends[1] must be int",
+			},
+		},
+		Case{
+			Path:   ApiUserUpdate,
+			Method: http.MethodPost,
+			Query:  "username=ivan&tags=aa&tags=bb&tags=cc&tags=verylongtag",
+			Auth:   true,
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "tags len must be <= 3; tags[3] len must be <= 10",
+			},
+		},
+		Case{ // запятая внутри regexp= не режет правило
+			Path:   ApiUserUpdate,
+			Method: http.MethodPost,
+			Query:  "username=ivan&zip=123456",
+			Auth:   true,
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        12,
+					"login":     "ivan",
+					"full_name": "",
+					"level":     1,
+				},
+			},
+		},
+		Case{
+			Path:   ApiUserUpdate,
+			Method: http.MethodPost,
+			Query:  "username=ivan&zip=12",
+			Auth:   true,
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "zip must match ^[0-9]{3,6}$",
+			},
+		},
+		Case{ // пустой элемент []int - 0, как и пустой int
+			Path:   ApiUserUpdate,
+			Method: http.MethodPost,
+			Query:  "username=ivan&friends=",
+			Auth:   true,
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "friends[0] must be >= 1",
+			},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
+func TestOtherApiUpdateJSON(t *testing.T) {
+	ts := httptest.NewServer(NewOtherApi())
+	defer ts.Close()
+
+	cases := []struct {
+		Body   string
+		Status int
+		Result interface{}
+	}{
+		{
+			Body:   `{"username": "ivan", "level": 50, "tags": ["go"], "friends": [5]}`,
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        13,
+					"login":     "ivan",
+					"full_name": "go",
+					"level":     50,
+				},
+			},
+		},
+		{
+			Body:   `{"level": 1.5, "friends": [1, "two"]}`,
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "username must be not empty; level must be int; friends[1] must be int",
+			},
+		},
+		{
+			Body:   `{"username": "ivan",`,
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "bad request body: unexpected EOF",
+			},
+		},
+		{ // json-тело ограничено так же, как форма
+			Body:   `{"username": "` + strings.Repeat("a", 10<<20) + `"}`,
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "bad request body: http: request body too large",
+			},
+		},
+	}
+
+	for idx, item := range cases {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+ApiUserUpdate, strings.NewReader(item.Body))
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		req.Header.Set("X-Auth", "100500")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("[%d] request error: %v", idx, err)
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != item.Status {
+			t.Errorf("[%d] expected http status %v, got %v", idx, item.Status, resp.StatusCode)
+			continue
+		}
+
+		var result, expected interface{}
+		if err := json.Unmarshal(body, &result); err != nil {
+			t.Errorf("[%d] cant unpack json: %v", idx, err)
+			continue
+		}
+		data, _ := json.Marshal(item.Result)
+		json.Unmarshal(data, &expected)
+
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("[%d] results not match\nGot: %#v\nExpected: %#v", idx, result, item.Result)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// права доступа. Без Handler.Policy разрешено всё, как раньше. С политикой:
+//
+//	read_only: true          # никаких записей, кто бы ни спрашивал
+//	schema_reload: [admin]   # кто может POST /_schema/reload
+//	roles:
+//	  "*":                   # роль, для которой нет своих правил
+//	    items:
+//	      operations: [read]
+//	  admin:
+//	    "*":                 # все таблицы, которых нет в списке роли
+//	      operations: [read, insert, update, delete]
+//	    users:
+//	      read: {deny: [password]}
+//	      write: {allow: [login, password, email]}
+//	      mask: [email]
+//
+// Роль определяет Policy.Auth по запросу. Таблицы, которой для роли нет ни под своим именем, ни под "*",
+// для неё как будто не существует - 404, в том числе в GET /_schema. Запрещённая операция или колонка - 403
+
+const (
+	opRead   = "read"
+	opInsert = "insert"
+	opUpdate = "update"
+	opDelete = "delete"
+)
+
+// maskValue - что отдаётся вместо значения скрытой колонки
+const maskValue = "***"
+
+type Policy struct {
+	// ReadOnly запрещает любые записи
+	ReadOnly bool `yaml:"read_only"`
+	// Auth определяет роль по запросу, ошибка - 401. Без Auth у всех роль ""
+	Auth func(r *http.Request) (string, error) `yaml:"-"`
+	// Roles - правила по ролям: роль -> таблица -> правила, "*" - для остальных ролей и таблиц
+	Roles map[string]map[string]TablePolicy `yaml:"roles"`
+	// SchemaReload - роли, которым можно перечитывать схему. С ReadOnly нельзя никому
+	SchemaReload []string `yaml:"schema_reload"`
+}
+
+type TablePolicy struct {
+	// Operations - read, insert, update, delete. Пустой - все
+	Operations []string `yaml:"operations"`
+	// Read - какие колонки видно в ответах и можно использовать в filter, sort, fields, expand
+	Read ColumnRule `yaml:"read"`
+	// Write - какие колонки можно передавать в PUT и POST
+	Write ColumnRule `yaml:"write"`
+	// Mask - колонки, которые отдаются, но вместо значения - maskValue
+	Mask []string `yaml:"mask"`
+}
+
+// ColumnRule - если Allow не пустой, то только эти колонки, и кроме колонок из Deny
+type ColumnRule struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+func (c ColumnRule) allows(name string) bool {
+	return (len(c.Allow) == 0 || contains(c.Allow, name)) && !contains(c.Deny, name)
+}
+
+// LoadPolicy читает политику из yaml, Auth надо проставить руками
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("policy %s: %w", path, err)
+	}
+	for role, tables := range p.Roles {
+		for table, tp := range tables {
+			for _, op := range tp.Operations {
+				if op != opRead && op != opInsert && op != opUpdate && op != opDelete {
+					return nil, fmt.Errorf("policy %s: role %s, table %s: unknown operation %s", path, role, table, op)
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+var errReadOnly = &StatusError{http.StatusForbidden, "read-only mode"}
+
+// access - права того, кто сделал запрос
+type access struct {
+	policy *Policy
+	role   string
+}
+
+type accessKey struct{}
+
+// newAccess определяет роль по запросу
+func (h *Handler) newAccess(r *http.Request) (*access, error) {
+	a := &access{policy: h.Policy}
+	if a.policy == nil || a.policy.Auth == nil {
+		return a, nil
+	}
+	role, err := a.policy.Auth(r)
+	if err != nil {
+		return nil, err
+	}
+	a.role = role
+	return a, nil
+}
+
+// accessOf - права из контекста запроса, их туда кладёт Router
+func accessOf(r *http.Request) *access {
+	if a, ok := r.Context().Value(accessKey{}).(*access); ok {
+		return a
+	}
+	return &access{}
+}
+
+func withAccess(r *http.Request, a *access) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), accessKey{}, a))
+}
+
+// rules - правила для таблицы, ok == false - таблицы для этой роли нет
+func (a *access) rules(table string) (TablePolicy, bool) {
+	if a.policy == nil {
+		return TablePolicy{}, true
+	}
+	tables, ok := a.policy.Roles[a.role]
+	if !ok {
+		tables = a.policy.Roles["*"]
+	}
+	if tp, ok := tables[table]; ok {
+		return tp, true
+	}
+	tp, ok := tables["*"]
+	return tp, ok
+}
+
+func (a *access) visible(table string) bool {
+	_, ok := a.rules(table)
+	return ok
+}
+
+// canReload - можно ли роли перечитать схему через POST /_schema/reload
+func (a *access) canReload() error {
+	switch {
+	case a.policy == nil:
+		return nil
+	case a.policy.ReadOnly:
+		return errReadOnly
+	case !contains(a.policy.SchemaReload, a.role):
+		return &StatusError{http.StatusForbidden, "schema reload is not allowed"}
+	}
+	return nil
+}
+
+// schemaView - таблица для GET /_schema: как view, но без ссылок на невидимые таблицы
+// и без имён нечитаемых колонок в ключе
+func (a *access) schemaView(t Table) Table {
+	if a.policy == nil {
+		return t
+	}
+	v := a.view(t)
+	for name, fk := range v.ForeignKeys {
+		if !a.visible(fk.RefTable) {
+			delete(v.ForeignKeys, name)
+		}
+	}
+	v.PriKeys = nil
+	for _, name := range t.PriKeys {
+		if _, ok := v.Columns[name]; ok {
+			v.PriKeys = append(v.PriKeys, name)
+		}
+	}
+	if _, ok := v.Columns[v.Version]; !ok {
+		v.Version = ""
+	}
+	return v
+}
+
+// can проверяет, что операцию op над t можно делать
+func (a *access) can(t Table, op string) error {
+	if op != opRead && a.policy != nil && a.policy.ReadOnly {
+		return errReadOnly
+	}
+	tp, _ := a.rules(t.Name)
+	if len(tp.Operations) > 0 && !contains(tp.Operations, op) {
+		return &StatusError{http.StatusForbidden, fmt.Sprintf("operation %s is not allowed on %s", op, t.Name)}
+	}
+	if op == opRead && len(a.view(t).Columns) == 0 {
+		return &StatusError{http.StatusForbidden, fmt.Sprintf("no readable columns in %s", t.Name)}
+	}
+	return nil
+}
+
+// view - таблица, какой её видно на чтение: только читаемые колонки и внешние ключи по ним
+func (a *access) view(t Table) Table {
+	if a.policy == nil {
+		return t
+	}
+	tp, _ := a.rules(t.Name)
+	v := t
+	v.Columns = make(map[string]Column, len(t.Columns))
+	v.ForeignKeys = make(map[string]ForeignKey, len(t.ForeignKeys))
+	for name, col := range t.Columns {
+		if tp.Read.allows(name) {
+			v.Columns[name] = col
+		}
+	}
+	for name, fk := range t.ForeignKeys {
+		if _, ok := v.Columns[name]; ok {
+			v.ForeignKeys[name] = fk
+		}
+	}
+	return v
+}
+
+// checkWrite - операция op и все колонки из values разрешены
+func (a *access) checkWrite(t Table, op string, values map[string]interface{}) error {
+	if err := a.can(t, op); err != nil {
+		return err
+	}
+	tp, _ := a.rules(t.Name)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := t.Columns[name]; ok && !tp.Write.allows(name) {
+			return &StatusError{http.StatusForbidden, fmt.Sprintf("field %s is not writable", name)}
+		}
+	}
+	return nil
+}
+
+func (a *access) masked(t Table, name string) bool {
+	tp, _ := a.rules(t.Name)
+	return contains(tp.Mask, name)
+}
+
+// checkMasked - по скрытым колонкам нельзя фильтровать и сортировать:
+// иначе значение угадывается по тому, какие строки вернулись и в каком порядке
+func (a *access) checkMasked(t Table, q Query) error {
+	for _, f := range q.Filters {
+		if a.masked(t, f.Name) {
+			return paramErrorf("filter column %s is masked", f.Name)
+		}
+	}
+	for _, o := range q.Sort {
+		if a.masked(t, o.Name) {
+			return paramErrorf("sort column %s is masked", o.Name)
+		}
+	}
+	return nil
+}
+
+// mask прячет значения колонок из Mask
+func (a *access) mask(t Table, rows []map[string]interface{}) {
+	tp, _ := a.rules(t.Name)
+	for _, row := range rows {
+		for _, name := range tp.Mask {
+			if v, ok := row[name]; ok && v != nil {
+				row[name] = maskValue
+			}
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testPolicy = `
+schema_reload: [admin]
+roles:
+  "*":
+    items:
+      operations: [read]
+      read: {allow: [id, title]}
+  admin:
+    "*": {}
+    users:
+      read: {deny: [password]}
+      write: {allow: [login, password, email, info]}
+      mask: [email]
+`
+
+func roleAuth(r *http.Request) (string, error) {
+	role := r.Header.Get("X-Role")
+	if role == "nobody" {
+		return "", errors.New("unknown caller")
+	}
+	return role, nil
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.yaml")
+	os.WriteFile(path, []byte(testPolicy), 0644)
+	p, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := TablePolicy{
+		Read:  ColumnRule{Deny: []string{"password"}},
+		Write: ColumnRule{Allow: []string{"login", "password", "email", "info"}},
+		Mask:  []string{"email"},
+	}
+	if got := p.Roles["admin"]["users"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	os.WriteFile(path, []byte("roles: {admin: {users: {operations: [drop]}}}"), 0644)
+	if _, err := LoadPolicy(path); err == nil {
+		t.Error("expected error for unknown operation")
+	}
+	if _, err := LoadPolicy(filepath.Join(dir, "nope.yaml")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	db := prepareSQLite(t)
+	defer db.Close()
+	h, err := NewHandler(db, SQLite{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	os.WriteFile(path, []byte(testPolicy), 0644)
+	if h.Policy, err = LoadPolicy(path); err != nil {
+		t.Fatal(err)
+	}
+	h.Policy.Auth = roleAuth
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	cases := []struct {
+		Role   string
+		Method string
+		Path   string
+		Body   interface{}
+		Status int
+		Result interface{}
+	}{
+		{"", http.MethodGet, "/", nil, http.StatusOK, CR{"response": CR{"tables": []string{"items"}}}},
+		{"nobody", http.MethodGet, "/", nil, http.StatusUnauthorized, CR{"error": "unknown caller"}},
+		{"", http.MethodGet, "/users", nil, http.StatusNotFound, CR{"error": "unknown table"}},
+		{"", http.MethodGet, "/items/1", nil, http.StatusOK, CR{"response": CR{"record": CR{"id": 1, "title": "database/sql"}}}},
+		{"", http.MethodGet, "/items?fields=description", nil, http.StatusBadRequest, CR{"error": "unknown field description"}},
+		{"", http.MethodGet, "/items?filter[updated][null]=true", nil, http.StatusBadRequest, CR{"error": "unknown filter column updated"}},
+		{"", http.MethodGet, "/items?sort=-id", nil, http.StatusOK, CR{"response": CR{"records": []CR{
+			CR{"id": 2, "title": "memcache"},
+			CR{"id": 1, "title": "database/sql"},
+		}}}},
+		{"", http.MethodDelete, "/items/1", nil, http.StatusForbidden, CR{"error": "operation delete is not allowed on items"}},
+		{"", http.MethodPost, "/_batch", []CR{CR{"op": "delete", "table": "items", "key": 1}}, http.StatusForbidden,
+			CR{"error": "operation delete is not allowed on items", "index": 0}},
+		{"", http.MethodGet, "/_schema", nil, http.StatusOK, nil},
+		{"", http.MethodPost, "/_schema/reload", nil, http.StatusForbidden, CR{"error": "schema reload is not allowed"}},
+		{"admin", http.MethodPost, "/_schema/reload", nil, http.StatusOK, nil},
+
+		{"admin", http.MethodGet, "/users/1", nil, http.StatusOK, CR{"response": CR{"record": CR{
+			"user_id": 1, "login": "rvasily", "email": "***", "info": "none", "updated": nil,
+		}}}},
+		{"admin", http.MethodGet, "/users?filter[password]=love", nil, http.StatusBadRequest, CR{"error": "unknown filter column password"}},
+		{"admin", http.MethodGet, "/users?filter[email][like]=a%25", nil, http.StatusBadRequest, CR{"error": "filter column email is masked"}},
+		{"admin", http.MethodGet, "/users?sort=-email", nil, http.StatusBadRequest, CR{"error": "sort column email is masked"}},
+		{"admin", http.MethodGet, "/users?fields=email", nil, http.StatusOK, CR{"response": CR{"records": []CR{CR{"email": "***"}}}}},
+		{"admin", http.MethodPost, "/users/1", CR{"updated": "now"}, http.StatusForbidden, CR{"error": "field updated is not writable"}},
+		{"admin", http.MethodPost, "/users/1", CR{"password": "secret"}, http.StatusOK, CR{"response": CR{"updated": 1}}},
+		{"admin", http.MethodPut, "/users", CR{"login": "a", "password": "b", "email": "c", "info": "d"}, http.StatusOK, CR{"response": CR{"user_id": 2}}},
+		{"admin", http.MethodDelete, "/items/2", nil, http.StatusOK, CR{"response": CR{"deleted": 1}}},
+	}
+	for i, item := range cases {
+		var body io.Reader
+		if item.Body != nil {
+			data, _ := json.Marshal(item.Body)
+			body = bytes.NewReader(data)
+		}
+		req, _ := http.NewRequest(item.Method, ts.URL+item.Path, body)
+		req.Header.Set("X-Role", item.Role)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != item.Status {
+			t.Errorf("[%d] %s %s as %q: expected %d, got %d: %s", i, item.Method, item.Path, item.Role, item.Status, resp.StatusCode, data)
+			continue
+		}
+		if item.Result == nil {
+			continue
+		}
+		var got, expected interface{}
+		json.Unmarshal(data, &got)
+		raw, _ := json.Marshal(item.Result)
+		json.Unmarshal(raw, &expected)
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("[%d] %s %s as %q\nGot : %s\nWant: %s", i, item.Method, item.Path, item.Role, data, raw)
+		}
+	}
+
+	var password string
+	db.QueryRow("SELECT password FROM users WHERE user_id = 1").Scan(&password)
+	if password != "secret" {
+		t.Errorf("write-only column must be written, got %q", password)
+	}
+
+	// в /_schema только то, что роль может видеть
+	schemaCases := []struct {
+		Role    string
+		Columns map[string][]string
+	}{
+		{"", map[string][]string{"items": {"id", "title"}}},
+		{"admin", map[string][]string{
+			"items": {"description", "id", "title", "updated"},
+			"users": {"email", "info", "login", "updated", "user_id"},
+		}},
+	}
+	for _, item := range schemaCases {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/_schema", nil)
+		req.Header.Set("X-Role", item.Role)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var schema struct {
+			Response struct {
+				Tables map[string]struct {
+					Columns []struct {
+						Name string `json:"name"`
+					} `json:"columns"`
+				} `json:"tables"`
+			} `json:"response"`
+		}
+		json.NewDecoder(resp.Body).Decode(&schema)
+		resp.Body.Close()
+		got := map[string][]string{}
+		for name, table := range schema.Response.Tables {
+			for _, col := range table.Columns {
+				got[name] = append(got[name], col.Name)
+			}
+		}
+		if !reflect.DeepEqual(got, item.Columns) {
+			t.Errorf("/_schema as %q: expected %v, got %v", item.Role, item.Columns, got)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	db := prepareSQLite(t)
+	defer db.Close()
+	h, err := NewHandler(db, SQLite{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Policy = &Policy{
+		ReadOnly: true,
+		Roles:    map[string]map[string]TablePolicy{"*": {"*": {}}},
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path: "/",
+			Result: CR{
+				"response": CR{
+					"tables": []string{"items", "users"},
+				},
+			},
+		},
+		Case{
+			Path:   "/items",
+			Method: http.MethodPut,
+			Body:   CR{"title": "x"},
+			Status: http.StatusForbidden,
+			Result: CR{
+				"error": "read-only mode",
+			},
+		},
+		Case{
+			Path:   "/items/1",
+			Method: http.MethodDelete,
+			Status: http.StatusForbidden,
+			Result: CR{
+				"error": "read-only mode",
+			},
+		},
+		Case{
+			Path:   "/_schema/reload",
+			Method: http.MethodPost,
+			Status: http.StatusForbidden,
+			Result: CR{
+				"error": "read-only mode",
+			},
+		},
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// POST /_batch - несколько записей в разные таблицы одной транзакцией:
+//
+//	[
+//		{"op": "insert", "table": "items", "values": {"title": "x", "description": "y"}},
+//		{"op": "update", "table": "items", "key": 1, "values": {"title": "z"}, "if_match": 3},
+//		{"op": "delete", "table": "user_follows", "key": [2, 1]}
+//	]
+//
+// key - значение ключа, для составного - массив в порядке колонок ключа.
+// Если все операции прошли - коммит и {"response": {"results": [...]}} с ответом на каждую,
+// как у PUT/POST/DELETE. Если нет - откат всей транзакции, статус упавшей операции и её номер:
+// {"error": "...", "index": 1}
+
+// maxBatchOps - больше операций в одной транзакции не берём
+const maxBatchOps = 1000
+
+type batchOp struct {
+	Op      string                 `json:"op"`
+	Table   string                 `json:"table"`
+	Key     interface{}            `json:"key"`
+	Values  map[string]interface{} `json:"values"`
+	IfMatch interface{}            `json:"if_match"`
+}
+
+func (h *Handler) Batch(w http.ResponseWriter, r *http.Request) {
+	var ops []batchOp
+	err := json.NewDecoder(r.Body).Decode(&ops)
+	if err != nil {
+		h.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	r.Body.Close()
+	if len(ops) == 0 {
+		h.fail(w, http.StatusBadRequest, "empty batch")
+		return
+	}
+	if len(ops) > maxBatchOps {
+		h.fail(w, http.StatusBadRequest, fmt.Sprintf("too many operations, max %d", maxBatchOps))
+		return
+	}
+
+	acl := accessOf(r)
+	tx, err := h.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		h.fail(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	results := make([]interface{}, 0, len(ops))
+	for i, op := range ops {
+		res, err := h.runOp(tx, acl, op)
+		if err != nil {
+			tx.Rollback()
+			h.writeJSON(w, errorStatus(err, http.StatusInternalServerError), map[string]interface{}{
+				"error": err.Error(),
+				"index": i,
+			})
+			return
+		}
+		results = append(results, res)
+	}
+	if err := tx.Commit(); err != nil {
+		h.fail(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.ok(w, map[string]interface{}{"results": results})
+}
+
+func (h *Handler) runOp(db queryer, acl *access, op batchOp) (map[string]interface{}, error) {
+	if op.Op != "insert" && op.Op != "update" && op.Op != "delete" {
+		return nil, paramErrorf("unknown op %s", op.Op)
+	}
+	t, ok := h.schema()[op.Table]
+	if !ok || !acl.visible(op.Table) {
+		return nil, &StatusError{http.StatusNotFound, "unknown table"}
+	}
+	if op.Op == "insert" {
+		if op.IfMatch != nil {
+			return nil, paramErrorf("if_match is not allowed for insert")
+		}
+		if err := acl.checkWrite(t, opInsert, op.Values); err != nil {
+			return nil, err
+		}
+		return h.insertRow(db, t, op.Values)
+	}
+	if err := acl.checkWrite(t, op.Op, op.Values); err != nil {
+		return nil, err
+	}
+
+	parts, isList := op.Key.([]interface{})
+	if !isList {
+		parts = []interface{}{op.Key}
+	}
+	key, ok, err := keyValues(t, parts)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &StatusError{http.StatusNotFound, "record not found"}
+	}
+	if op.Op == "update" {
+		c, err := h.updateRow(db, t, key, op.Values, op.IfMatch)
+		return map[string]interface{}{"updated": c}, err
+	}
+	c, err := h.deleteRow(db, t, key, op.IfMatch)
+	return map[string]interface{}{"deleted": c}, err
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func prepareBatch(t *testing.T) *sql.DB {
+	return openSQLite(t, []string{
+		`CREATE TABLE notes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  title varchar(255) NOT NULL,
+  version int(11) NOT NULL DEFAULT 1
+);`,
+		`CREATE TABLE comments (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  note_id INTEGER NOT NULL REFERENCES notes(id),
+  body text NOT NULL
+);`,
+		`INSERT INTO notes (id, title) VALUES (1, 'first'), (2, 'second');`,
+		`INSERT INTO comments (id, note_id, body) VALUES (1, 1, 'a'), (2, 2, 'b');`,
+	})
+}
+
+// newBatchHandler - у notes блокировка по version, у comments её нет
+func newBatchHandler(t *testing.T, db *sql.DB) *Handler {
+	h, err := NewHandler(db, SQLite{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Versions = map[string]string{"notes": "version"}
+	if _, err := h.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestBatch(t *testing.T) {
+	db := prepareBatch(t)
+	defer db.Close()
+
+	ts := httptest.NewServer(newBatchHandler(t, db))
+	defer ts.Close()
+
+	cases := []Case{
+		Case{
+			Path:   "/_batch",
+			Method: http.MethodPost,
+			Body: []CR{
+				CR{"op": "insert", "table": "notes", "values": CR{"title": "third"}},
+				CR{"op": "update", "table": "notes", "key": 1, "values": CR{"title": "first!"}, "if_match": 1},
+				CR{"op": "delete", "table": "comments", "key": []interface{}{1}},
+			},
+			Result: CR{
+				"response": CR{
+					"results": []CR{
+						CR{"id": 3},
+						CR{"updated": 1},
+						CR{"deleted": 1},
+					},
+				},
+			},
+		},
+		Case{
+			Path: "/notes",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 1, "title": "first!", "version": 2},
+						CR{"id": 2, "title": "second", "version": 1},
+						CR{"id": 3, "title": "third", "version": 1},
+					},
+				},
+			},
+		},
+		// версия уже 2 - вторая операция падает, первая откатывается
+		Case{
+			Path:   "/_batch",
+			Method: http.MethodPost,
+			Body: []CR{
+				CR{"op": "insert", "table": "notes", "values": CR{"title": "lost"}},
+				CR{"op": "update", "table": "notes", "key": 1, "values": CR{"title": "lost"}, "if_match": 1},
+			},
+			Status: http.StatusPreconditionFailed,
+			Result: CR{
+				"error": "version mismatch",
+				"index": 1,
+			},
+		},
+		Case{
+			Path:   "/notes/4",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "record not found",
+			},
+		},
+		Case{
+			Path:   "/_batch",
+			Method: http.MethodPost,
+			Body: []CR{
+				CR{"op": "update", "table": "notes", "key": 2, "values": CR{"title": "lost"}},
+				CR{"op": "delete", "table": "notes", "key": 2},
+			},
+			Status: http.StatusConflict,
+			Result: CR{
+				"error": errReferenced,
+				"index": 1,
+			},
+		},
+		Case{
+			Path: "/notes/2",
+			Result: CR{
+				"response": CR{
+					"record": CR{"id": 2, "title": "second", "version": 1},
+				},
+			},
+		},
+		Case{
+			Path:   "/_batch",
+			Method: http.MethodPost,
+			Body: []CR{
+				CR{"op": "update", "table": "notes", "key": 2, "values": CR{"title": 42}},
+			},
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "field title have invalid type",
+				"index": 0,
+			},
+		},
+		Case{
+			Path:   "/_batch",
+			Method: http.MethodPost,
+			Body: []CR{
+				CR{"op": "insert", "table": "notes", "values": CR{"title": "x"}},
+				CR{"op": "upsert", "table": "notes"},
+			},
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "unknown op upsert",
+				"index": 1,
+			},
+		},
+		Case{
+			Path:   "/_batch",
+			Method: http.MethodPost,
+			Body: []CR{
+				CR{"op": "delete", "table": "unknown_table", "key": 1},
+			},
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown table",
+				"index": 0,
+			},
+		},
+		Case{
+			Path:   "/_batch",
+			Method: http.MethodPost,
+			Body: []CR{
+				CR{"op": "delete", "table": "notes", "key": "x"},
+			},
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "record not found",
+				"index": 0,
+			},
+		},
+		Case{
+			Path:   "/_batch",
+			Method: http.MethodPost,
+			Body:   []CR{},
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "empty batch",
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+func TestIfMatch(t *testing.T) {
+	db := prepareBatch(t)
+	defer db.Close()
+
+	ts := httptest.NewServer(newBatchHandler(t, db))
+	defer ts.Close()
+
+	do := func(method, path, ifMatch, body string) *http.Response {
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if tag := do(http.MethodGet, "/notes/1", "", "").Header.Get("ETag"); tag != `"1"` {
+		t.Errorf("expected ETag \"1\", got %s", tag)
+	}
+	if tag := do(http.MethodGet, "/comments/1", "", "").Header.Get("ETag"); tag != "" {
+		t.Errorf("table without version must have no ETag, got %s", tag)
+	}
+
+	cases := []struct {
+		Method, Path, IfMatch, Body string
+		Status                      int
+	}{
+		{http.MethodPost, "/notes/1", `"1"`, `{"title": "new"}`, http.StatusOK},
+		{http.MethodPost, "/notes/1", `"1"`, `{"title": "newer"}`, http.StatusPreconditionFailed},
+		{http.MethodPost, "/notes/1", `"2"`, `{"version": 5}`, http.StatusBadRequest},
+		{http.MethodPost, "/notes/1", `"two"`, `{"title": "newer"}`, http.StatusBadRequest},
+		{http.MethodPost, "/notes/9", `"1"`, `{"title": "newer"}`, http.StatusPreconditionFailed},
+		{http.MethodPost, "/comments/1", `"1"`, `{"body": "x"}`, http.StatusBadRequest},
+		{http.MethodDelete, "/notes/1", `"1"`, "", http.StatusPreconditionFailed},
+		{http.MethodPost, "/notes/2", `*`, `{"title": "any"}`, http.StatusOK},
+		{http.MethodDelete, "/comments/1", "", "", http.StatusOK},
+		{http.MethodDelete, "/notes/1", `W/"2"`, "", http.StatusOK},
+	}
+	for i, item := range cases {
+		if resp := do(item.Method, item.Path, item.IfMatch, item.Body); resp.StatusCode != item.Status {
+			t.Errorf("[%d] %s %s If-Match %s: expected %d, got %d", i, item.Method, item.Path, item.IfMatch, item.Status, resp.StatusCode)
+		}
+	}
+	if tag := do(http.MethodGet, "/notes/2", "", "").Header.Get("ETag"); tag != `"2"` {
+		t.Errorf("update must bump version, got ETag %s", tag)
+	}
+}
+
+// TestVersionsOptIn - колонка с именем version сама по себе блокировку не включает
+func TestVersionsOptIn(t *testing.T) {
+	db := prepareBatch(t)
+	defer db.Close()
+
+	h, err := NewHandler(db, SQLite{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	cases := []Case{
+		Case{
+			Path:   "/notes/1",
+			Method: http.MethodPost,
+			Body: CR{
+				"version": 5,
+			},
+			Result: CR{
+				"response": CR{
+					"updated": 1,
+				},
+			},
+		},
+		Case{
+			Path: "/notes/1",
+			Result: CR{
+				"response": CR{
+					"record": CR{"id": 1, "title": "first", "version": 5},
+				},
+			},
+		},
+	}
+	runCases(t, ts, db, cases)
+
+	resp, err := client.Get(ts.URL + "/notes/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if tag := resp.Header.Get("ETag"); tag != "" {
+		t.Errorf("table without configured version must have no ETag, got %s", tag)
+	}
+
+	for _, col := range []string{"title", "id", "missing"} {
+		h.Versions = map[string]string{"notes": col}
+		if _, err := h.Reload(); err == nil {
+			t.Errorf("version column %s must be rejected", col)
+		}
+	}
+	// таблицы нет - не ошибка, её могли удалить, пока работает Watch
+	h.Versions = map[string]string{"dropped": "version"}
+	if _, err := h.Reload(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
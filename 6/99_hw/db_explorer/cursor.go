@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// постраничная выдача по ключу вместо OFFSET:
+//
+//	GET /$table?limit=100&sort=-created&after=        - первая страница
+//	GET /$table?limit=100&sort=-created&after=<курсор> - следующая
+//
+// В ответе рядом с records приходит next_cursor, на последней странице - null.
+// К sort дописываются колонки первичного ключа, чтобы порядок был однозначным, и следующая
+// страница выбирается условием по значениям этих колонок в последней строке, а не OFFSET-ом.
+// Курсор непрозрачный и годится только для того же sort. Колонки сортировки
+// не могут быть nullable: null-ы базы сортируют по-разному
+
+// cursor - что лежит внутри токена: порядок, для которого он выдан, и значения последней строки
+type cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+}
+
+// keysetOrder - sort плюс недостающие колонки первичного ключа по возрастанию
+func keysetOrder(t Table, sort []Order) []Order {
+	order := append([]Order{}, sort...)
+	for _, pk := range t.PriKeys {
+		found := false
+		for _, o := range sort {
+			found = found || o.Name == pk
+		}
+		if !found {
+			order = append(order, Order{Name: pk})
+		}
+	}
+	return order
+}
+
+func sortSpec(order []Order) string {
+	parts := make([]string, len(order))
+	for i, o := range order {
+		parts[i] = o.Name
+		if o.Desc {
+			parts[i] = "-" + o.Name
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// checkKeyset - по этим колонкам можно листать курсором: они видны, не скрыты и не nullable
+func checkKeyset(acl *access, t Table, order []Order) error {
+	if len(t.PriKeys) == 0 {
+		return paramErrorf("table %s has no primary key", t.Name)
+	}
+	view := acl.view(t)
+	for _, o := range order {
+		col, ok := view.Columns[o.Name]
+		if !ok || acl.masked(t, o.Name) {
+			return paramErrorf("cursor needs readable column %s", o.Name)
+		}
+		if col.Nullable {
+			return paramErrorf("cursor can't sort by nullable column %s", o.Name)
+		}
+	}
+	return nil
+}
+
+func encodeCursor(order []Order, row map[string]interface{}) string {
+	c := cursor{Sort: sortSpec(order)}
+	for _, o := range order {
+		c.Values = append(c.Values, csvValue(row[o.Name]))
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// parseCursor разбирает токен и приводит значения к типам колонок
+func parseCursor(raw string, t Table, order []Order) ([]interface{}, error) {
+	errBad := paramErrorf("bad cursor")
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errBad
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || len(c.Values) != len(order) {
+		return nil, errBad
+	}
+	if c.Sort != sortSpec(order) {
+		return nil, paramErrorf("cursor was issued for sort=%s", c.Sort)
+	}
+	values := make([]interface{}, len(order))
+	for i, o := range order {
+		v, err := coerce(c.Values[i], t.Columns[o.Name], false)
+		if err != nil || v == nil {
+			return nil, errBad
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// keyset - условие "строго после values" для порядка order:
+// (a > ?) OR (a = ? AND b < ?) OR (a = ? AND b = ? AND c > ?), знак - по направлению колонки
+func (b *sqlBuilder) keyset(order []Order, values []interface{}) {
+	b.WriteString("(")
+	for i, o := range order {
+		if i > 0 {
+			b.WriteString(" OR ")
+		}
+		b.WriteString("(")
+		for j := 0; j < i; j++ {
+			b.WriteString(b.quote(order[j].Name) + " = " + b.arg(values[j]) + " AND ")
+		}
+		op := " > "
+		if o.Desc {
+			op = " < "
+		}
+		b.WriteString(b.quote(o.Name) + op + b.arg(values[i]) + ")")
+	}
+	b.WriteString(")")
+}
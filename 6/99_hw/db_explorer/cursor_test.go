@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func prepareCursor(t *testing.T) *sql.DB {
+	return openSQLite(t, []string{
+		`CREATE TABLE events (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  prio int(11) NOT NULL,
+  name varchar(255) NOT NULL,
+  note text DEFAULT NULL
+);`,
+		`INSERT INTO events (id, prio, name) VALUES
+(1, 2, 'a'), (2, 1, 'b'), (3, 2, 'c'), (4, 3, 'd'), (5, 1, 'e'), (6, 2, 'f'), (7, 3, 'g');`,
+	})
+}
+
+type cursorPage struct {
+	Response struct {
+		Records    []map[string]interface{} `json:"records"`
+		NextCursor *string                  `json:"next_cursor"`
+	} `json:"response"`
+	Error string `json:"error"`
+}
+
+func getPage(t *testing.T, ts *httptest.Server, query string) (int, cursorPage) {
+	t.Helper()
+	resp, err := client.Get(ts.URL + "/events?" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var page cursorPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, page
+}
+
+func TestCursor(t *testing.T) {
+	db := prepareCursor(t)
+	defer db.Close()
+	h, err := NewHandler(db, SQLite{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	cases := []struct {
+		Query string
+		Names []string
+	}{
+		{"limit=3", []string{"a", "b", "c", "d", "e", "f", "g"}},
+		{"limit=3&sort=-prio", []string{"d", "g", "a", "c", "f", "b", "e"}},
+		{"limit=2&sort=prio,-id&fields=name", []string{"e", "b", "f", "c", "a", "g", "d"}},
+		{"limit=2&sort=-name&filter[prio][gte]=2", []string{"g", "f", "d", "c", "a"}},
+		{"limit=7", []string{"a", "b", "c", "d", "e", "f", "g"}},
+	}
+	for _, item := range cases {
+		names := []string{}
+		after, pages := "", 0
+		for {
+			status, page := getPage(t, ts, item.Query+"&after="+url.QueryEscape(after))
+			if status != http.StatusOK {
+				t.Fatalf("[%s] expected 200, got %d: %s", item.Query, status, page.Error)
+			}
+			pages++
+			for _, row := range page.Response.Records {
+				names = append(names, row["name"].(string))
+				// колонки сортировки, которые не просили в fields, в ответ не попадают
+				if strings.Contains(item.Query, "fields=") && len(row) != 1 {
+					t.Errorf("[%s] unexpected fields %v", item.Query, row)
+				}
+			}
+			if page.Response.NextCursor == nil || pages > 10 {
+				break
+			}
+			after = *page.Response.NextCursor
+		}
+		if !reflect.DeepEqual(names, item.Names) {
+			t.Errorf("[%s] expected %v, got %v", item.Query, item.Names, names)
+		}
+	}
+
+	// курсор переживает вставку в уже пройденную часть, в отличие от offset
+	_, page := getPage(t, ts, "limit=3&after=")
+	if _, err := db.Exec("INSERT INTO events (id, prio, name) VALUES (0, 1, 'z')"); err != nil {
+		t.Fatal(err)
+	}
+	_, page = getPage(t, ts, "limit=3&after="+url.QueryEscape(*page.Response.NextCursor))
+	if got := page.Response.Records[0]["name"]; got != "d" {
+		t.Errorf("expected page to start with d, got %v", got)
+	}
+
+	_, page = getPage(t, ts, "limit=3&sort=-prio&after=")
+	cursor := url.QueryEscape(*page.Response.NextCursor)
+	errCases := []struct {
+		Query string
+		Error string
+	}{
+		{"limit=3&sort=prio&after=" + cursor, "cursor was issued for sort=-prio,id"},
+		{"limit=3&after=!!!", "bad cursor"},
+		{"limit=3&after=e30", "bad cursor"},
+		{"limit=3&offset=3&after=", "after and offset can't be used together"},
+		{"limit=3&sort=note&after=", "cursor can't sort by nullable column note"},
+	}
+	for _, item := range errCases {
+		status, page := getPage(t, ts, item.Query)
+		if status != http.StatusBadRequest || page.Error != item.Error {
+			t.Errorf("[%s] expected 400 %q, got %d %q", item.Query, item.Error, status, page.Error)
+		}
+	}
+}
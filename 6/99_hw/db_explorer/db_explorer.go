@@ -4,40 +4,84 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type Handler struct {
-	db     *sql.DB
+	// Policy - права доступа, см. acl.go. nil - разрешено всё
+	Policy *Policy
+	// ErrorLog - куда писать ошибки перечитывания схемы в Watch, по умолчанию log.Printf
+	ErrorLog func(format string, args ...interface{})
+	// Versions - таблица -> целая колонка для оптимистичной блокировки, см. write.go.
+	// Применяется при чтении схемы: NewHandler её уже прочитал, так что после изменения нужен Reload
+	Versions map[string]string
+
+	db *sql.DB
+	d  Dialect
+
+	// tables целиком подменяется в Reload и после этого не меняется,
+	// так что читать её можно без блокировки, получив через schema()
+	mu     sync.RWMutex
 	tables map[string]Table
 }
 
 type Column struct {
 	Name     string
-	Type     string
+	Type     ColumnType
 	Nullable bool
+	// AutoIncrement - значение генерирует сама база: auto_increment, serial, INTEGER PRIMARY KEY
+	AutoIncrement bool
+	// RawType - тип как его отдала база: int(10) unsigned, varchar(255)
+	RawType string
+
+	Unsigned bool
+	// Bits - размер целого типа
+	Bits int
+	// Precision и Scale - decimal(Precision,Scale)
+	Precision int
+	Scale     int
+	// Size - предел длины в символах, а если LenBytes - в байтах. 0 - без предела
+	Size     int
+	LenBytes bool
+	// Values - допустимые значения enum и set
+	Values []string
 }
 
 type Table struct {
 	Name    string
 	Columns map[string]Column
-	PriKey  string
+	// PriKeys - колонки первичного ключа по порядку, для составного ключа их несколько
+	PriKeys []string
+	// Version - колонка для If-Match из Handler.Versions. Пустая - блокировки нет
+	Version string
+	// ForeignKeys - внешние ключи по имени колонки, составные ключи не поддерживаются
+	ForeignKeys map[string]ForeignKey
 }
 
-type Where struct {
-	Name  string
-	Value string
+// ForeignKey - колонка Column ссылается на RefTable.RefColumn
+type ForeignKey struct {
+	Column    string
+	RefTable  string
+	RefColumn string
 }
 
 type Query struct {
 	Table  string
 	Limit  int
 	Offset int
-	Id     string
+	// Key - значения первичного ключа, если нужна одна запись
+	Key []interface{}
+	// Fields - какие колонки вернуть, пустой - все
+	Fields  []string
+	Filters []Where
+	Sort    []Order
+	// After - значения колонок Sort в строке, после которой начинать, см. cursor.go
+	After []interface{}
 }
 
 func (h *Handler) writeJSON(w http.ResponseWriter, status int, payload interface{}) {
@@ -56,17 +100,25 @@ func (h *Handler) fail(w http.ResponseWriter, status int, msg string) {
 	h.writeJSON(w, status, map[string]interface{}{"error": msg})
 }
 
+// splitPath режет неразэкранированный путь, иначе %2F в ключе стал бы ещё одним сегментом
 func splitPath(r *http.Request) []string {
-	p := strings.Trim(r.URL.Path, "/")
+	p := strings.Trim(r.URL.EscapedPath(), "/")
 	if p == "" {
 		return nil
 	}
-	return strings.Split(p, "/")
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		if s, err := url.PathUnescape(part); err == nil {
+			parts[i] = s
+		}
+	}
+	return parts
 }
 
-func (h *Handler) tableOr404(w http.ResponseWriter, name string) (Table, bool) {
-	t, ok := h.tables[name]
-	if !ok {
+// tableOr404 - таблица, если она есть и видна тому, кто спрашивает
+func (h *Handler) tableOr404(w http.ResponseWriter, r *http.Request, name string) (Table, bool) {
+	t, ok := h.schema()[name]
+	if !ok || !accessOf(r).visible(name) {
 		h.fail(w, http.StatusNotFound, "unknown table")
 		return Table{}, false
 	}
@@ -82,21 +134,6 @@ func intQuery(r *http.Request, key string) int {
 	return 0
 }
 
-func placeholders(n int) string {
-	if n <= 0 {
-		return ""
-	}
-	return strings.TrimRight(strings.Repeat("?, ", n), ", ")
-}
-
-func backtickJoin(cols []string) string {
-	out := make([]string, len(cols))
-	for i, c := range cols {
-		out[i] = fmt.Sprintf("`%s`", c)
-	}
-	return strings.Join(out, ", ")
-}
-
 func colNames(t Table) []string {
 	names := make([]string, 0, len(t.Columns))
 	for name := range t.Columns {
@@ -106,54 +143,13 @@ func colNames(t Table) []string {
 	return names
 }
 
-func coerce(val interface{}, col Column, missing bool) (interface{}, error) {
-	if val == nil {
-		if missing {
-			if col.Nullable {
-				return nil, nil
-			}
-			switch col.Type {
-			case "int":
-				return 0, nil
-			default:
-				return "", nil
-			}
-		}
-		if !col.Nullable {
-			return nil, fmt.Errorf("field %s have invalid type", col.Name)
-		}
-		return nil, nil
-	}
-	switch col.Type {
-	case "int":
-		switch v := val.(type) {
-		case float64:
-			return int(v), nil
-		case string:
-			if v == "" && col.Nullable {
-				return nil, nil
-			}
-			i, err := strconv.Atoi(v)
-			if err != nil {
-				return nil, fmt.Errorf("field %s have invalid type", col.Name)
-			}
-			return i, nil
-		case int:
-			return v, nil
-		default:
-			return nil, fmt.Errorf("field %s have invalid type", col.Name)
-		}
-	default:
-		if s, ok := val.(string); ok {
-			return s, nil
-		}
-		return nil, fmt.Errorf("field %s have invalid type", col.Name)
-	}
-}
-
 func (h *Handler) GetTables(w http.ResponseWriter, r *http.Request) {
 	var tables []string
-	for key := range h.tables {
+	acl := accessOf(r)
+	for key := range h.schema() {
+		if !acl.visible(key) {
+			continue
+		}
 		tables = append(tables, key)
 	}
 	sort.Strings(tables)
@@ -161,86 +157,192 @@ func (h *Handler) GetTables(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) Query(q Query) (result []map[string]interface{}, err error) {
-	t, ok := h.tables[q.Table]
+	err = h.queryEach(q, func(row map[string]interface{}) error {
+		result = append(result, row)
+		return nil
+	})
+	return result, err
+}
+
+// queryEach - как Query, но отдаёт строки по одной, не собирая их в память
+func (h *Handler) queryEach(q Query, fn func(row map[string]interface{}) error) error {
+	t, ok := h.schema()[q.Table]
 	if !ok {
-		return nil, fmt.Errorf("unknown table")
+		return fmt.Errorf("unknown table")
 	}
 	cols := colNames(t)
-	args := []interface{}{}
-	query := fmt.Sprintf("SELECT %s FROM `%s`", backtickJoin(cols), q.Table)
-	if q.Id != "" {
-		query += fmt.Sprintf(" WHERE %s = ?", h.tables[q.Table].PriKey)
-		args = append(args, q.Id)
-	}
-	if q.Limit != 0 {
-		query += " LIMIT ?"
-		args = append(args, q.Limit)
+	if len(q.Fields) > 0 {
+		cols = q.Fields
+	}
+	b := newBuilder(h.d)
+	b.WriteString("SELECT " + b.quoteList(cols) + " FROM " + b.quote(q.Table))
+	filters := q.Filters
+	if q.Key != nil {
+		filters = append(keyFilters(t, q.Key), filters...)
+	}
+	if len(filters) > 0 || q.After != nil {
+		b.WriteString(" WHERE ")
+		b.where(filters)
+	}
+	if q.After != nil {
+		if len(filters) > 0 {
+			b.WriteString(" AND ")
+		}
+		b.keyset(q.Sort, q.After)
 	}
-	if q.Offset != 0 {
-		query += " OFFSET ?"
-		args = append(args, q.Offset)
+	if len(q.Sort) > 0 {
+		b.WriteString(" ORDER BY ")
+		b.order(q.Sort)
 	}
-	rows, err := h.db.Query(query, args...)
+	b.limit(q.Limit, q.Offset)
+	rows, err := h.db.Query(b.String(), b.args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		row := make(map[string]interface{})
-		values := make([]interface{}, len(h.tables[q.Table].Columns))
-		valuePtrs := make([]interface{}, len(h.tables[q.Table].Columns))
+		values := make([]interface{}, len(cols))
+		valuePtrs := make([]interface{}, len(cols))
 		for i := range values {
 			valuePtrs[i] = &values[i]
 		}
 		if err = rows.Scan(valuePtrs...); err != nil {
-			return nil, err
+			return err
 		}
 		for i, col := range cols {
-			val := values[i]
-			if b, ok := val.([]byte); ok {
-				switch h.tables[q.Table].Columns[col].Type {
-				case "int":
-					row[col], err = strconv.Atoi(string(b))
-					if err != nil {
-						log.Fatal(err)
-					}
-				default:
-					row[col] = string(b)
-				}
-			} else {
-				row[col] = val
+			if row[col], err = decodeValue(t.Columns[col], values[i]); err != nil {
+				return fmt.Errorf("column %s: %w", col, err)
 			}
 		}
-		result = append(result, row)
+		if err = fn(row); err != nil {
+			return err
+		}
 	}
-	return result, nil
+	return rows.Err()
 }
 
 func (h *Handler) GetRows(w http.ResponseWriter, r *http.Request) {
 	parts := splitPath(r)
 	tableName := parts[0]
-	if _, ok := h.tableOr404(w, tableName); !ok {
+	t, ok := h.tableOr404(w, r, tableName)
+	if !ok {
+		return
+	}
+	acl := accessOf(r)
+	if err := acl.can(t, opRead); err != nil {
+		h.failErr(w, http.StatusForbidden, err)
 		return
 	}
 
-	limit := intQuery(r, "limit")
-	offset := intQuery(r, "offset")
-	result, err := h.Query(Query{Limit: limit, Offset: offset, Table: tableName})
+	q := Query{
+		Table:  tableName,
+		Limit:  intQuery(r, "limit"),
+		Offset: intQuery(r, "offset"),
+	}
+	view := acl.view(t)
+	if err := parseListParams(r.URL.Query(), view, &q); err != nil {
+		h.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := acl.checkMasked(t, q); err != nil {
+		h.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(q.Fields) == 0 {
+		q.Fields = colNames(view)
+	}
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+	case "csv", "ndjson":
+		h.export(w, acl, t, q, format)
+		return
+	default:
+		h.fail(w, http.StatusBadRequest, fmt.Sprintf("unknown format %s", format))
+		return
+	}
+	after, paged := r.URL.Query()["after"]
+	var extra []string
+	if paged {
+		if q.Offset != 0 {
+			h.fail(w, http.StatusBadRequest, "after and offset can't be used together")
+			return
+		}
+		q.Sort = keysetOrder(t, q.Sort)
+		if err := checkKeyset(acl, t, q.Sort); err != nil {
+			h.fail(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if after[0] != "" {
+			var err error
+			if q.After, err = parseCursor(after[0], t, q.Sort); err != nil {
+				h.fail(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		// для курсора нужны значения колонок сортировки, даже если их не просили в fields
+		for _, o := range q.Sort {
+			if !contains(q.Fields, o.Name) {
+				extra = append(extra, o.Name)
+			}
+		}
+		q.Fields = append(q.Fields, extra...)
+	}
+	result, err := h.Query(q)
 	if err != nil {
 		h.fail(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	h.ok(w, map[string]interface{}{"records": result})
+	if !paged {
+		acl.mask(t, result)
+		h.ok(w, map[string]interface{}{"records": result})
+		return
+	}
+
+	var next interface{}
+	if q.Limit > 0 && len(result) == q.Limit {
+		next = encodeCursor(q.Sort, result[len(result)-1])
+	}
+	for _, row := range result {
+		for _, name := range extra {
+			delete(row, name)
+		}
+	}
+	acl.mask(t, result)
+	h.ok(w, map[string]interface{}{"records": result, "next_cursor": next})
 }
 
 func (h *Handler) GetRow(w http.ResponseWriter, r *http.Request) {
 	parts := splitPath(r)
-	tableName, id := parts[0], parts[1]
-	if _, ok := h.tableOr404(w, tableName); !ok {
+	tableName := parts[0]
+	t, ok := h.tableOr404(w, r, tableName)
+	if !ok {
+		return
+	}
+	key, ok := h.keyOr404(w, r, t)
+	if !ok {
+		return
+	}
+	acl := accessOf(r)
+	if err := acl.can(t, opRead); err != nil {
+		h.failErr(w, http.StatusForbidden, err)
 		return
 	}
+	view := acl.view(t)
+	expand, err := parseExpand(r.URL.Query().Get("expand"), view)
+	if err != nil {
+		h.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// встроенная строка выдала бы скрытое значение ключа
+	for _, fk := range expand {
+		if acl.masked(t, fk.Column) {
+			h.fail(w, http.StatusBadRequest, "expand column "+fk.Column+" is masked")
+			return
+		}
+	}
 
-	result, err := h.Query(Query{Id: id, Table: tableName})
+	result, err := h.Query(Query{Key: key, Table: tableName, Fields: colNames(view)})
 
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -250,13 +352,21 @@ func (h *Handler) GetRow(w http.ResponseWriter, r *http.Request) {
 		h.fail(w, http.StatusNotFound, "record not found")
 		return
 	}
+	if err := h.expandRow(acl, result[0], expand); err != nil {
+		h.failErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	acl.mask(t, result)
+	if _, ok := view.Columns[t.Version]; ok {
+		w.Header().Set("ETag", etag(t, result[0]))
+	}
 	h.ok(w, map[string]interface{}{"record": result[0]})
 }
 
 func (h *Handler) PutRow(w http.ResponseWriter, r *http.Request) {
 	parts := splitPath(r)
 	tableName := parts[0]
-	t, ok := h.tableOr404(w, tableName)
+	t, ok := h.tableOr404(w, r, tableName)
 	if !ok {
 		return
 	}
@@ -267,37 +377,26 @@ func (h *Handler) PutRow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	r.Body.Close()
-	var cols []string
-	var args []interface{}
-
-	for key, col := range t.Columns {
-		if key == t.PriKey {
-			continue
-		}
-		raw, exists := values[key]
-		cv, err := coerce(raw, col, !exists)
-		if err != nil {
-			h.fail(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		cols = append(cols, key)
-		args = append(args, cv)
+	if err := accessOf(r).checkWrite(t, opInsert, values); err != nil {
+		h.failErr(w, http.StatusForbidden, err)
+		return
 	}
-	query := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s)", tableName, backtickJoin(cols), placeholders(len(args)))
-
-	res, err := h.db.Exec(query, args...)
+	resp, err := h.insertRow(h.db, t, values)
 	if err != nil {
-		h.fail(w, http.StatusInternalServerError, err.Error())
+		h.failErr(w, http.StatusInternalServerError, err)
 		return
 	}
-	id, _ := res.LastInsertId()
-	h.ok(w, map[string]interface{}{t.PriKey: id})
+	h.ok(w, resp)
 }
 
 func (h *Handler) PostRow(w http.ResponseWriter, r *http.Request) {
 	parts := splitPath(r)
-	tableName, id := parts[0], parts[1]
-	t, ok := h.tableOr404(w, tableName)
+	tableName := parts[0]
+	t, ok := h.tableOr404(w, r, tableName)
+	if !ok {
+		return
+	}
+	key, ok := h.keyOr404(w, r, t)
 	if !ok {
 		return
 	}
@@ -309,67 +408,67 @@ func (h *Handler) PostRow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	r.Body.Close()
-	var cols []string
-	var args []interface{}
-
-	if _, hasPk := values[t.PriKey]; hasPk {
-		h.fail(w, http.StatusBadRequest, fmt.Sprintf("field %s have invalid type", t.PriKey))
+	if err := accessOf(r).checkWrite(t, opUpdate, values); err != nil {
+		h.failErr(w, http.StatusForbidden, err)
 		return
 	}
-	for colName, raw := range values {
-		colMeta, ok := t.Columns[colName]
-		if !ok || colName == t.PriKey {
-			continue
-		}
-		cv, err := coerce(raw, colMeta, false)
-		if err != nil {
-			h.fail(w, http.StatusBadRequest, fmt.Sprintf("field %s have invalid type", colName))
-			return
-		}
-		cols = append(cols, colName)
-		args = append(args, cv)
-	}
-	args = append(args, id)
-	places := strings.Join(cols, " = ?,") + " = ?"
-	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s = ?", tableName, places, t.PriKey)
-	res, err := h.db.Exec(query, args...)
+	c, err := h.updateRow(h.db, t, key, values, ifMatch(r))
 	if err != nil {
-		h.fail(w, http.StatusBadRequest, err.Error())
+		h.failErr(w, http.StatusBadRequest, err)
 		return
 	}
-	c, _ := res.RowsAffected()
 	h.ok(w, map[string]interface{}{"updated": c})
 }
 
 func (h *Handler) DeleteRow(w http.ResponseWriter, r *http.Request) {
 	parts := splitPath(r)
-	tableName, id := parts[0], parts[1]
-	t, ok := h.tableOr404(w, tableName)
+	tableName := parts[0]
+	t, ok := h.tableOr404(w, r, tableName)
 	if !ok {
 		return
 	}
-	query := fmt.Sprintf("DELETE FROM %s WHERE %s = ?", tableName, t.PriKey)
-	res, err := h.db.Exec(query, id)
+	key, ok := h.keyOr404(w, r, t)
+	if !ok {
+		return
+	}
+	if err := accessOf(r).can(t, opDelete); err != nil {
+		h.failErr(w, http.StatusForbidden, err)
+		return
+	}
+	c, err := h.deleteRow(h.db, t, key, ifMatch(r))
 	if err != nil {
-		h.fail(w, http.StatusBadRequest, err.Error())
+		h.failErr(w, http.StatusBadRequest, err)
 		return
 	}
-	c, _ := res.RowsAffected()
 	h.ok(w, map[string]interface{}{"deleted": c})
 }
 
 func (h *Handler) Router(w http.ResponseWriter, r *http.Request) {
+	acl, err := h.newAccess(r)
+	if err != nil {
+		h.fail(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	r = withAccess(r, acl)
 	parts := splitPath(r)
 
 	switch {
 	case len(parts) == 0:
 		h.GetTables(w, r)
+	case len(parts) == 1 && parts[0] == "_batch" && r.Method == http.MethodPost:
+		h.Batch(w, r)
+	case len(parts) == 1 && parts[0] == "_schema" && r.Method == http.MethodGet:
+		h.GetSchema(w, r)
+	case len(parts) == 2 && parts[0] == "_schema" && parts[1] == "reload" && r.Method == http.MethodPost:
+		h.ReloadSchema(w, r)
 	case len(parts) == 1:
 		if r.Method == http.MethodPut {
 			h.PutRow(w, r)
 		} else {
 			h.GetRows(w, r)
 		}
+	case len(parts) == 2 && parts[1] == "_import" && r.Method == http.MethodPost:
+		h.Import(w, r)
 	case len(parts) == 2:
 		switch r.Method {
 		case http.MethodPost:
@@ -379,74 +478,50 @@ func (h *Handler) Router(w http.ResponseWriter, r *http.Request) {
 		default:
 			h.GetRow(w, r)
 		}
+	case len(parts) == 3 && r.Method == http.MethodGet:
+		h.GetChildren(w, r)
 	default:
 		h.fail(w, http.StatusNotFound, "not found")
 	}
 }
 
-func (h *Handler) Init() {
-	tables := make(map[string]Table)
-	tableNames := []string{}
-	rows, err := h.db.Query("SHOW TABLES")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var table string
-		if err := rows.Scan(&table); err != nil {
-			log.Fatal(err)
-		}
-		tableNames = append(tableNames, table)
-	}
-
-	for _, table := range tableNames {
-		cTable := Table{
-			Name:    table,
-			Columns: make(map[string]Column),
-		}
+// Init перечитывает схему базы через диалект
+func (h *Handler) Init() error {
+	_, err := h.Reload()
+	return err
+}
 
-		crows, err := h.db.Query(fmt.Sprintf("SHOW FULL COLUMNS FROM `%s`", table))
-		if err != nil {
-			log.Fatal(err)
-		}
+// NewDbExplorer определяет диалект по драйверу db, см. detectDialect
+func NewDbExplorer(db *sql.DB) (http.Handler, error) {
+	return NewDbExplorerDialect(db, detectDialect(db))
+}
 
-		for crows.Next() {
-			var (
-				field, typ, key, extra, privileges string
-				collation, nullStr, def, comment   sql.NullString
-			)
-			if err := crows.Scan(&field, &typ, &collation, &nullStr, &key, &def, &extra, &privileges, &comment); err != nil {
-				log.Fatal(err)
-			}
-			if key == "PRI" {
-				cTable.PriKey = field
-			}
-			var nullable bool
-			if nullStr.String == "YES" {
-				nullable = true
-			}
-			if strings.Contains(typ, "int") {
-				typ = "int"
-			}
-			cTable.Columns[field] = Column{Name: field, Type: typ, Nullable: nullable}
-		}
-		crows.Close()
-		tables[table] = cTable
+// NewDbExplorerDialect - когда диалект по драйверу не угадать, например у обёрток над драйвером
+func NewDbExplorerDialect(db *sql.DB, d Dialect) (http.Handler, error) {
+	handler, err := NewHandler(db, d)
+	if err != nil {
+		return nil, err
 	}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", handler.Router)
 
-	h.tables = tables
+	return mux, nil
 }
 
-func NewDbExplorer(db *sql.DB) (http.Handler, error) {
+// NewHandler - то же, что NewDbExplorerDialect, но отдаёт сам Handler,
+// например чтобы запустить Watch
+func NewHandler(db *sql.DB, d Dialect) (*Handler, error) {
 	handler := &Handler{
 		db: db,
+		d:  d,
 	}
-	handler.Init()
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("/", handler.Router)
+	if err := handler.Init(); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
 
-	return mux, nil
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.Router(w, r)
 }
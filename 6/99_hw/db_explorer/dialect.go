@@ -0,0 +1,198 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+)
+
+// Dialect - всё, чем базы отличаются друг от друга с точки зрения explorer-а:
+// как узнать таблицы и колонки, как экранировать имена, как писать плейсхолдеры
+// и как получить ключ только что вставленной записи
+type Dialect interface {
+	Name() string
+	// Quote экранирует имя таблицы или колонки
+	Quote(ident string) string
+	// Placeholder - плейсхолдер для n-го аргумента запроса, с 1
+	Placeholder(n int) string
+	// NoLimit - что писать в LIMIT, если задан только OFFSET. Пустая строка - LIMIT можно не писать
+	NoLimit() string
+	// LoadTables читает из базы таблицы, их колонки и первичные ключи
+	LoadTables(db queryer) (map[string]Table, error)
+	// Insert вставляет запись и возвращает значение, которое база сгенерировала для Table.autoKey,
+	// или nil, если генерируемой колонки нет
+	Insert(db queryer, t Table, cols []string, args []interface{}) (interface{}, error)
+	// IsForeignKeyError - ошибка записи из-за нарушения внешнего ключа
+	IsForeignKeyError(err error) bool
+}
+
+// queryer - то общее, что есть у *sql.DB и *sql.Tx
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// detectDialect угадывает диалект по пакету драйвера, по умолчанию - MySQL
+func detectDialect(db *sql.DB) Dialect {
+	t := reflect.TypeOf(db.Driver())
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return dialectForDriver(t.PkgPath() + "." + t.Name())
+}
+
+// dialectForDriver - по полному имени типа драйвера: у pgx это *stdlib.Driver,
+// так что смотреть надо на путь пакета, а не на короткое имя
+func dialectForDriver(name string) Dialect {
+	name = strings.ToLower(name)
+	switch {
+	case strings.Contains(name, "sqlite"):
+		return SQLite{}
+	case strings.Contains(name, "/lib/pq."), strings.Contains(name, "/pgx/"), strings.Contains(name, "postgres"):
+		return PostgreSQL{}
+	}
+	return MySQL{}
+}
+
+// insertSQL - INSERT без RETURNING, общий для всех диалектов
+func insertSQL(d Dialect, t Table, cols []string, args []interface{}) *sqlBuilder {
+	return insertManySQL(d, t, cols, [][]interface{}{args})
+}
+
+// insertManySQL - INSERT сразу нескольких строк, у всех строк колонки cols
+func insertManySQL(d Dialect, t Table, cols []string, rows [][]interface{}) *sqlBuilder {
+	b := newBuilder(d)
+	b.WriteString("INSERT INTO " + d.Quote(t.Name))
+	if len(cols) == 0 {
+		// ни одной колонки кроме автоинкрементного ключа - пусть база подставит значения по умолчанию
+		b.WriteString(" DEFAULT VALUES")
+		return b
+	}
+	b.WriteString(" (" + b.quoteList(cols) + ") VALUES ")
+	for i, args := range rows {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for j, arg := range args {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(b.arg(arg))
+		}
+		b.WriteString(")")
+	}
+	return b
+}
+
+// lastInsertID - для баз, где ключ отдаёт драйвер через LastInsertId
+func lastInsertID(db queryer, t Table, b *sqlBuilder) (interface{}, error) {
+	res, err := db.Exec(b.String(), b.args...)
+	if err != nil || t.autoKey() == "" {
+		return nil, err
+	}
+	return res.LastInsertId()
+}
+
+// fkColumn - строка из описания внешних ключей: ограничение, колонка и на что она ссылается
+type fkColumn struct {
+	Constraint string
+	ForeignKey
+}
+
+// scanForeignKeys читает запрос, который отдаёт fkColumn построчно,
+// и оставляет только ключи из одной колонки
+func scanForeignKeys(db queryer, query string, args ...interface{}) (map[string]ForeignKey, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols := []fkColumn{}
+	for rows.Next() {
+		var c fkColumn
+		if err := rows.Scan(&c.Constraint, &c.Column, &c.RefTable, &c.RefColumn); err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return singleColumnKeys(cols), nil
+}
+
+func singleColumnKeys(cols []fkColumn) map[string]ForeignKey {
+	count := map[string]int{}
+	for _, c := range cols {
+		count[c.Constraint]++
+	}
+	res := map[string]ForeignKey{}
+	for _, c := range cols {
+		if count[c.Constraint] == 1 {
+			res[c.Column] = c.ForeignKey
+		}
+	}
+	return res
+}
+
+// scanStrings читает запрос, который отдаёт одну строковую колонку
+func scanStrings(db queryer, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []string{}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
+
+// sqlBuilder собирает запрос под конкретный диалект: имена экранирует Quote,
+// значения уходят в args, а в текст - плейсхолдер с правильным номером
+type sqlBuilder struct {
+	strings.Builder
+	d    Dialect
+	args []interface{}
+}
+
+func newBuilder(d Dialect) *sqlBuilder {
+	return &sqlBuilder{d: d}
+}
+
+// arg запоминает значение и возвращает его плейсхолдер
+func (b *sqlBuilder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return b.d.Placeholder(len(b.args))
+}
+
+func (b *sqlBuilder) quote(ident string) string {
+	return b.d.Quote(ident)
+}
+
+func (b *sqlBuilder) quoteList(idents []string) string {
+	out := make([]string, len(idents))
+	for i, ident := range idents {
+		out[i] = b.d.Quote(ident)
+	}
+	return strings.Join(out, ", ")
+}
+
+// limit дописывает LIMIT/OFFSET, нули означают, что ограничения нет
+func (b *sqlBuilder) limit(limit, offset int) {
+	if limit != 0 {
+		b.WriteString(" LIMIT " + b.arg(limit))
+	} else if offset != 0 && b.d.NoLimit() != "" {
+		b.WriteString(" LIMIT " + b.d.NoLimit())
+	}
+	if offset != 0 {
+		b.WriteString(" OFFSET " + b.arg(offset))
+	}
+}
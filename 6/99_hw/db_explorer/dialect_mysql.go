@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL - SHOW TABLES и SHOW FULL COLUMNS, `имена` и ?
+type MySQL struct{}
+
+func (MySQL) Name() string { return "mysql" }
+
+func (MySQL) Quote(ident string) string {
+	return "`" + strings.ReplaceAll(ident, "`", "``") + "`"
+}
+
+func (MySQL) Placeholder(n int) string { return "?" }
+
+// NoLimit - так советует делать документация mysql
+func (MySQL) NoLimit() string { return "18446744073709551615" }
+
+func (d MySQL) LoadTables(db queryer) (map[string]Table, error) {
+	names, err := scanStrings(db, "SHOW TABLES")
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string]Table, len(names))
+	for _, name := range names {
+		t, err := d.loadTable(db, name)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+		// SHOW COLUMNS отдаёт колонки в порядке таблицы, а нужен порядок ключа
+		t.PriKeys, err = scanStrings(db, `SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY'
+			ORDER BY ORDINAL_POSITION`, name)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+		if t.ForeignKeys, err = d.foreignKeys(db, name); err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+		tables[name] = t
+	}
+	return tables, nil
+}
+
+func (d MySQL) loadTable(db queryer, name string) (Table, error) {
+	t := Table{
+		Name:    name,
+		Columns: make(map[string]Column),
+	}
+	rows, err := db.Query("SHOW FULL COLUMNS FROM " + d.Quote(name))
+	if err != nil {
+		return t, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			field, typ, key, extra, privileges string
+			collation, nullStr, def, comment   sql.NullString
+		)
+		if err := rows.Scan(&field, &typ, &collation, &nullStr, &key, &def, &extra, &privileges, &comment); err != nil {
+			return t, err
+		}
+		col := Column{
+			Name:          field,
+			Nullable:      nullStr.String == "YES",
+			AutoIncrement: strings.Contains(extra, "auto_increment"),
+		}
+		parseMySQLType(&col, typ)
+		t.Columns[field] = col
+	}
+	return t, rows.Err()
+}
+
+func (d MySQL) Insert(db queryer, t Table, cols []string, args []interface{}) (interface{}, error) {
+	b := insertSQL(d, t, cols, args)
+	if len(cols) == 0 {
+		// в mysql нет DEFAULT VALUES
+		b = newBuilder(d)
+		b.WriteString("INSERT INTO " + d.Quote(t.Name) + " () VALUES ()")
+	}
+	return lastInsertID(db, t, b)
+}
+
+func (d MySQL) foreignKeys(db queryer, table string) (map[string]ForeignKey, error) {
+	return scanForeignKeys(db, `SELECT CONSTRAINT_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND REFERENCED_TABLE_NAME IS NOT NULL`, table)
+}
+
+// IsForeignKeyError - ER_ROW_IS_REFERENCED(_2) и ER_NO_REFERENCED_ROW(_2)
+func (MySQL) IsForeignKeyError(err error) bool {
+	var myErr *mysql.MySQLError
+	if !errors.As(err, &myErr) {
+		return false
+	}
+	switch myErr.Number {
+	case 1216, 1217, 1451, 1452:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PostgreSQL - information_schema текущей схемы, "имена" и $1, $2, ...
+// Ключ вставленной записи отдаёт INSERT ... RETURNING
+type PostgreSQL struct{}
+
+func (PostgreSQL) Name() string { return "postgres" }
+
+func (PostgreSQL) Quote(ident string) string {
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+func (PostgreSQL) Placeholder(n int) string { return "$" + strconv.Itoa(n) }
+
+func (PostgreSQL) NoLimit() string { return "" }
+
+func (d PostgreSQL) LoadTables(db queryer) (map[string]Table, error) {
+	names, err := scanStrings(db, `SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_type = 'BASE TABLE'`)
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string]Table, len(names))
+	for _, name := range names {
+		t, err := d.loadTable(db, name)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+		if t.ForeignKeys, err = d.foreignKeys(db, name); err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+		tables[name] = t
+	}
+	return tables, nil
+}
+
+func (d PostgreSQL) loadTable(db queryer, name string) (Table, error) {
+	t := Table{
+		Name:    name,
+		Columns: make(map[string]Column),
+	}
+	rows, err := db.Query(`SELECT column_name, data_type, udt_schema, udt_name, is_nullable,
+			character_maximum_length, numeric_precision, numeric_scale, column_default, is_identity
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1
+		ORDER BY ordinal_position`, name)
+	if err != nil {
+		return t, err
+	}
+	cols := []Column{}
+	// udtSchemas - схема пользовательского типа колонки: enum с тем же именем может быть и в другой схеме
+	udtSchemas := map[string]string{}
+	for rows.Next() {
+		var (
+			field, dataType, udtSchema, udt, nullable, identity string
+			size, precision, scale                              sql.NullInt64
+			def                                                 sql.NullString
+		)
+		if err := rows.Scan(&field, &dataType, &udtSchema, &udt, &nullable, &size, &precision, &scale, &def, &identity); err != nil {
+			rows.Close()
+			return t, err
+		}
+		col := Column{
+			Name:          field,
+			RawType:       udt,
+			Nullable:      nullable == "YES",
+			AutoIncrement: identity == "YES" || strings.HasPrefix(def.String, "nextval("),
+			Size:          int(size.Int64),
+			Precision:     int(precision.Int64),
+			Scale:         int(scale.Int64),
+		}
+		parsePostgresType(&col, dataType)
+		cols = append(cols, col)
+		udtSchemas[field] = udtSchema
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return t, err
+	}
+
+	// значения enum-ов и ключ читаем, когда курсор по колонкам уже закрыт
+	for _, col := range cols {
+		if col.Type == TypeEnum {
+			values, err := scanStrings(db, `SELECT e.enumlabel FROM pg_type t
+				JOIN pg_namespace n ON n.oid = t.typnamespace
+				JOIN pg_enum e ON e.enumtypid = t.oid
+				WHERE n.nspname = $1 AND t.typname = $2 ORDER BY e.enumsortorder`, udtSchemas[col.Name], col.RawType)
+			if err != nil {
+				return t, err
+			}
+			if len(values) == 0 {
+				// не enum: составной тип, тип из расширения (citext, hstore) и т.п.
+				col.Type = TypeString
+			} else {
+				col.Values = values
+			}
+		}
+		t.Columns[col.Name] = col
+	}
+
+	keys, err := scanStrings(db, `SELECT kcu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+			ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema AND tc.table_name = kcu.table_name
+		WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = current_schema() AND tc.table_name = $1
+		ORDER BY kcu.ordinal_position`, name)
+	if err != nil {
+		return t, err
+	}
+	t.PriKeys = keys
+	return t, nil
+}
+
+// parsePostgresType - по data_type из information_schema, размеры уже лежат в col
+func parsePostgresType(col *Column, dataType string) {
+	switch dataType {
+	case "smallint":
+		col.Type, col.Bits = TypeInt, 16
+	case "integer":
+		col.Type, col.Bits = TypeInt, 32
+	case "bigint":
+		col.Type, col.Bits = TypeInt, 64
+	case "real", "double precision":
+		col.Type = TypeFloat
+	case "numeric":
+		col.Type = TypeDecimal
+	case "boolean":
+		col.Type = TypeBool
+	case "date":
+		col.Type = TypeDate
+	case "timestamp without time zone", "timestamp with time zone":
+		col.Type = TypeDateTime
+	case "time without time zone", "time with time zone":
+		col.Type = TypeTime
+	case "json", "jsonb":
+		col.Type = TypeJSON
+	case "bytea":
+		col.Type, col.LenBytes = TypeBinary, true
+	case "USER-DEFINED":
+		// enum или что-то другое, станет ясно, когда loadTable поищет значения в pg_enum.
+		// Не нашлось значений - колонка строковая
+		col.Type = TypeEnum
+	default:
+		col.Type = TypeString
+	}
+	if col.Type != TypeString && col.Type != TypeBinary {
+		col.Size = 0
+	}
+	if col.Type != TypeDecimal {
+		col.Precision, col.Scale = 0, 0
+	}
+}
+
+func (d PostgreSQL) Insert(db queryer, t Table, cols []string, args []interface{}) (interface{}, error) {
+	b := insertSQL(d, t, cols, args)
+	auto := t.autoKey()
+	if auto == "" {
+		_, err := db.Exec(b.String(), b.args...)
+		return nil, err
+	}
+	b.WriteString(" RETURNING " + d.Quote(auto))
+	var id interface{}
+	if err := db.QueryRow(b.String(), b.args...).Scan(&id); err != nil {
+		return nil, err
+	}
+	return decodeValue(t.Columns[auto], id)
+}
+
+func (d PostgreSQL) foreignKeys(db queryer, table string) (map[string]ForeignKey, error) {
+	return scanForeignKeys(db, `SELECT tc.constraint_name, kcu.column_name, ccu.table_name, ccu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+			ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema
+		JOIN information_schema.constraint_column_usage ccu
+			ON tc.constraint_name = ccu.constraint_name AND tc.table_schema = ccu.constraint_schema
+		WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = current_schema() AND tc.table_name = $1`, table)
+}
+
+// IsForeignKeyError - SQLSTATE 23503. Драйвер не импортируем, поэтому смотрим
+// на метод SQLState (pgx) или на текст ошибки (lib/pq)
+func (PostgreSQL) IsForeignKeyError(err error) bool {
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		return state.SQLState() == "23503"
+	}
+	return strings.Contains(err.Error(), "violates foreign key constraint")
+}
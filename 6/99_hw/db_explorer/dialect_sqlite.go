@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SQLite - sqlite_master и PRAGMA table_info, "имена" и ?
+type SQLite struct{}
+
+func (SQLite) Name() string { return "sqlite" }
+
+func (SQLite) Quote(ident string) string {
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+func (SQLite) Placeholder(n int) string { return "?" }
+
+func (SQLite) NoLimit() string { return "-1" }
+
+func (d SQLite) LoadTables(db queryer) (map[string]Table, error) {
+	names, err := scanStrings(db, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string]Table, len(names))
+	for _, name := range names {
+		t, err := d.loadTable(db, name)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+		if t.ForeignKeys, err = d.foreignKeys(db, name); err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+		tables[name] = t
+	}
+	for _, t := range tables {
+		for col, fk := range t.ForeignKeys {
+			if ref := tables[fk.RefTable]; fk.RefColumn == "" && len(ref.PriKeys) == 1 {
+				fk.RefColumn = ref.PriKeys[0]
+				t.ForeignKeys[col] = fk
+			}
+		}
+	}
+	return tables, nil
+}
+
+func (d SQLite) loadTable(db queryer, name string) (Table, error) {
+	t := Table{
+		Name:    name,
+		Columns: make(map[string]Column),
+	}
+	rows, err := db.Query("PRAGMA table_info(" + d.Quote(name) + ")")
+	if err != nil {
+		return t, err
+	}
+	defer rows.Close()
+
+	// pk в table_info - номер колонки в ключе, с 1
+	keys := map[int]string{}
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			field, typ       string
+			def              sql.NullString
+		)
+		if err := rows.Scan(&cid, &field, &typ, &notNull, &def, &pk); err != nil {
+			return t, err
+		}
+		col := Column{Name: field, Nullable: notNull == 0 && pk == 0}
+		parseSQLiteType(&col, typ)
+		if pk > 0 {
+			keys[pk] = field
+		}
+		t.Columns[field] = col
+	}
+	if err := rows.Err(); err != nil {
+		return t, err
+	}
+	for i := 1; i <= len(keys); i++ {
+		t.PriKeys = append(t.PriKeys, keys[i])
+	}
+	// единственный INTEGER PRIMARY KEY - это rowid, он генерируется сам
+	if len(t.PriKeys) == 1 {
+		if pk := t.Columns[t.PriKeys[0]]; strings.EqualFold(pk.RawType, "integer") {
+			pk.AutoIncrement = true
+			t.Columns[pk.Name] = pk
+		}
+	}
+	return t, nil
+}
+
+// parseSQLiteType - в sqlite тип колонки это произвольный текст, смысл у него только через affinity.
+// Поэтому сначала пробуем понять его как mysql-тип (varchar(255), tinyint(1), datetime),
+// а целые делаем 64-битными, как они и хранятся
+func parseSQLiteType(col *Column, raw string) {
+	lower := strings.ToLower(raw)
+	parseMySQLType(col, lower)
+	col.RawType = raw
+	switch {
+	case col.Type == TypeInt:
+		col.Bits = 64
+	case lower == "":
+		col.Type = TypeBinary
+	case col.Type == TypeString && strings.Contains(lower, "int"):
+		col.Type, col.Bits = TypeInt, 64
+	case col.Type == TypeString && (strings.Contains(lower, "real") || strings.Contains(lower, "floa") || strings.Contains(lower, "doub")):
+		col.Type = TypeFloat
+	}
+}
+
+func (d SQLite) Insert(db queryer, t Table, cols []string, args []interface{}) (interface{}, error) {
+	return lastInsertID(db, t, insertSQL(d, t, cols, args))
+}
+
+// foreignKeys - в PRAGMA foreign_key_list ссылка на первичный ключ может быть без имени колонки,
+// её дозаполняет LoadTables, когда все таблицы уже прочитаны
+func (d SQLite) foreignKeys(db queryer, table string) (map[string]ForeignKey, error) {
+	rows, err := db.Query("PRAGMA foreign_key_list(" + d.Quote(table) + ")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols := []fkColumn{}
+	for rows.Next() {
+		var (
+			id, seq                   int
+			c                         fkColumn
+			to                        sql.NullString
+			onUpdate, onDelete, match string
+		)
+		if err := rows.Scan(&id, &seq, &c.RefTable, &c.Column, &to, &onUpdate, &onDelete, &match); err != nil {
+			return nil, err
+		}
+		c.Constraint, c.RefColumn = strconv.Itoa(id), to.String
+		cols = append(cols, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return singleColumnKeys(cols), nil
+}
+
+// IsForeignKeyError - драйвер не импортируем, чтобы не тянуть cgo, хватает текста ошибки
+func (SQLite) IsForeignKeyError(err error) bool {
+	return strings.Contains(err.Error(), "FOREIGN KEY constraint failed")
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// prepareSQLite - та же схема, что в PrepareTestApis, только в синтаксисе sqlite
+func prepareSQLite(t *testing.T) *sql.DB {
+	return openSQLite(t, []string{
+		`CREATE TABLE items (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  title varchar(255) NOT NULL,
+  description text NOT NULL,
+  updated varchar(255) DEFAULT NULL
+);`,
+		`INSERT INTO items (id, title, description, updated) VALUES
+(1,	'database/sql',	'Рассказать про базы данных',	'rvasily'),
+(2,	'memcache',	'Рассказать про мемкеш с примером использования',	NULL);`,
+		`CREATE TABLE users (
+  user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  login varchar(255) NOT NULL,
+  password varchar(255) NOT NULL,
+  email varchar(255) NOT NULL,
+  info text NOT NULL,
+  updated varchar(255) DEFAULT NULL
+);`,
+		`INSERT INTO users (user_id, login, password, email, info, updated) VALUES
+(1,	'rvasily',	'love',	'rvasily@example.com',	'none',	NULL);`,
+	})
+}
+
+// openSQLite - база в памяти с включёнными внешними ключами, qs - её схема и данные
+func openSQLite(t *testing.T, qs []string) *sql.DB {
+	db, err := sql.Open("sqlite3", "file::memory:?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// у каждого соединения своя :memory: база, поэтому соединение одно
+	db.SetMaxOpenConns(1)
+	for _, q := range qs {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestApisSQLite(t *testing.T) {
+	db := prepareSQLite(t)
+	defer db.Close()
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	runCases(t, ts, db, apiCases())
+}
+
+func TestDetectDialect(t *testing.T) {
+	db := prepareSQLite(t)
+	defer db.Close()
+	if d := detectDialect(db); d.Name() != "sqlite" {
+		t.Errorf("expected sqlite, got %s", d.Name())
+	}
+}
+
+func TestDialectForDriver(t *testing.T) {
+	cases := map[string]string{
+		"github.com/jackc/pgx/v5/stdlib.Driver":      "postgres",
+		"github.com/jackc/pgx/v4/stdlib.Driver":      "postgres",
+		"github.com/lib/pq.Driver":                   "postgres",
+		"github.com/mattn/go-sqlite3.SQLiteDriver":   "sqlite",
+		"modernc.org/sqlite.Driver":                  "sqlite",
+		"github.com/go-sql-driver/mysql.MySQLDriver": "mysql",
+	}
+	for name, want := range cases {
+		if d := dialectForDriver(name); d.Name() != want {
+			t.Errorf("[%s] expected %s, got %s", name, want, d.Name())
+		}
+	}
+}
+
+func TestDialectSQL(t *testing.T) {
+	filters := []Where{
+		{Name: "age", Op: "gt", Value: 18},
+		{Name: "id", Op: "in", Value: []interface{}{1, 2}},
+	}
+	cases := []struct {
+		D     Dialect
+		Query string
+	}{
+		{MySQL{}, "SELECT `id`, `we``ird` FROM `users` WHERE `age` > ? AND `id` IN (?, ?) ORDER BY `id` DESC LIMIT 18446744073709551615 OFFSET ?"},
+		{PostgreSQL{}, `SELECT "id", "we` + "`" + `ird" FROM "users" WHERE "age" > $1 AND "id" IN ($2, $3) ORDER BY "id" DESC OFFSET $4`},
+		{SQLite{}, `SELECT "id", "we` + "`" + `ird" FROM "users" WHERE "age" > ? AND "id" IN (?, ?) ORDER BY "id" DESC LIMIT -1 OFFSET ?`},
+	}
+	for _, item := range cases {
+		b := newBuilder(item.D)
+		b.WriteString("SELECT " + b.quoteList([]string{"id", "we`ird"}) + " FROM " + b.quote("users") + " WHERE ")
+		b.where(filters)
+		b.WriteString(" ORDER BY ")
+		b.order([]Order{{Name: "id", Desc: true}})
+		b.limit(0, 10)
+		if b.String() != item.Query {
+			t.Errorf("[%s] expected\n%s\ngot\n%s", item.D.Name(), item.Query, b.String())
+		}
+		if want := []interface{}{18, 1, 2, 10}; !reflect.DeepEqual(b.args, want) {
+			t.Errorf("[%s] expected args %v, got %v", item.D.Name(), want, b.args)
+		}
+	}
+}
+
+func TestParseSQLiteType(t *testing.T) {
+	cases := []struct {
+		Raw  string
+		Want Column
+	}{
+		{"INTEGER", Column{Type: TypeInt, Bits: 64, RawType: "INTEGER"}},
+		{"int(11)", Column{Type: TypeInt, Bits: 64, RawType: "int(11)"}},
+		{"BIGINT UNSIGNED", Column{Type: TypeInt, Bits: 64, Unsigned: true, RawType: "BIGINT UNSIGNED"}},
+		{"varchar(20)", Column{Type: TypeString, Size: 20, RawType: "varchar(20)"}},
+		{"REAL", Column{Type: TypeFloat, RawType: "REAL"}},
+		{"double precision", Column{Type: TypeFloat, RawType: "double precision"}},
+		{"BOOLEAN", Column{Type: TypeBool, RawType: "BOOLEAN"}},
+		{"", Column{Type: TypeBinary}},
+	}
+	for _, item := range cases {
+		var col Column
+		parseSQLiteType(&col, item.Raw)
+		if !reflect.DeepEqual(col, item.Want) {
+			t.Errorf("[%s] expected %+v, got %+v", item.Raw, item.Want, col)
+		}
+	}
+}
+
+func TestSQLiteSchema(t *testing.T) {
+	db := prepareSQLite(t)
+	defer db.Close()
+	tables, err := SQLite{}.LoadTables(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tables["sqlite_sequence"]; ok {
+		t.Error("service tables must be skipped")
+	}
+	users := tables["users"]
+	if !reflect.DeepEqual(users.PriKeys, []string{"user_id"}) || !users.Columns["user_id"].AutoIncrement || users.Columns["user_id"].Nullable {
+		t.Errorf("bad primary key: %+v", users)
+	}
+	if col := users.Columns["updated"]; !col.Nullable || col.Type != TypeString || col.Size != 255 {
+		t.Errorf("bad column updated: %+v", col)
+	}
+}
+
+// TestPostgreSQLSchema - без живого PostgreSQL: запросы к information_schema и pg_enum
+// отвечает cannedConnector заготовленными строками
+func TestPostgreSQLSchema(t *testing.T) {
+	colNames := []string{"column_name", "data_type", "udt_schema", "udt_name", "is_nullable",
+		"character_maximum_length", "numeric_precision", "numeric_scale", "column_default", "is_identity"}
+	conn := &cannedConnector{results: []cannedResult{
+		{Match: "information_schema.tables", Cols: []string{"table_name"}, Rows: [][]driver.Value{{"items"}}},
+		{Match: "information_schema.columns", Args: []driver.Value{"items"}, Cols: colNames, Rows: [][]driver.Value{
+			{"id", "integer", "pg_catalog", "int4", "NO", nil, int64(32), int64(0), "nextval('items_id_seq'::regclass)", "NO"},
+			{"title", "character varying", "pg_catalog", "varchar", "NO", int64(255), nil, nil, nil, "NO"},
+			{"price", "numeric", "pg_catalog", "numeric", "YES", nil, int64(10), int64(2), nil, "NO"},
+			{"mood", "USER-DEFINED", "shop", "mood", "NO", nil, nil, nil, nil, "NO"},
+			{"tag", "USER-DEFINED", "public", "citext", "YES", nil, nil, nil, nil, "NO"},
+		}},
+		// enum mood есть только в схеме shop, такой же тип в public не должен подмешаться
+		{Match: "pg_enum", Args: []driver.Value{"shop", "mood"}, Cols: []string{"enumlabel"}, Rows: [][]driver.Value{{"sad"}, {"happy"}}},
+		{Match: "pg_enum", Args: []driver.Value{"public", "mood"}, Cols: []string{"enumlabel"}, Rows: [][]driver.Value{{"wrong"}}},
+		{Match: "pg_enum", Cols: []string{"enumlabel"}},
+		{Match: "'PRIMARY KEY'", Args: []driver.Value{"items"}, Cols: []string{"column_name"}, Rows: [][]driver.Value{{"id"}}},
+		{Match: "'FOREIGN KEY'", Cols: []string{"constraint_name", "column_name", "table_name", "column_name"}},
+	}}
+	db := sql.OpenDB(conn)
+	defer db.Close()
+
+	tables, err := PostgreSQL{}.LoadTables(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := tables["items"]
+	want := map[string]Column{
+		"id":    {Name: "id", RawType: "int4", Type: TypeInt, Bits: 32, AutoIncrement: true},
+		"title": {Name: "title", RawType: "varchar", Type: TypeString, Size: 255},
+		"price": {Name: "price", RawType: "numeric", Type: TypeDecimal, Nullable: true, Precision: 10, Scale: 2},
+		"mood":  {Name: "mood", RawType: "mood", Type: TypeEnum, Values: []string{"sad", "happy"}},
+		"tag":   {Name: "tag", RawType: "citext", Type: TypeString, Nullable: true},
+	}
+	for name, col := range want {
+		if got := items.Columns[name]; !reflect.DeepEqual(got, col) {
+			t.Errorf("[%s] expected %+v, got %+v", name, col, got)
+		}
+	}
+	if !reflect.DeepEqual(items.PriKeys, []string{"id"}) {
+		t.Errorf("bad primary key: %v", items.PriKeys)
+	}
+}
+
+// cannedConnector - database/sql драйвер для тестов диалектов: на запрос отдаёт первый
+// результат, у которого Match есть в тексте запроса и совпали Args (nil - любые)
+type cannedConnector struct {
+	results []cannedResult
+}
+
+type cannedResult struct {
+	Match string
+	Args  []driver.Value
+	Cols  []string
+	Rows  [][]driver.Value
+}
+
+func (c *cannedConnector) Connect(context.Context) (driver.Conn, error) { return cannedConn{c}, nil }
+func (c *cannedConnector) Driver() driver.Driver                        { return nil }
+
+type cannedConn struct{ c *cannedConnector }
+
+func (cn cannedConn) Prepare(query string) (driver.Stmt, error) { return cannedStmt{cn.c, query}, nil }
+func (cannedConn) Close() error                                 { return nil }
+func (cannedConn) Begin() (driver.Tx, error)                    { return nil, fmt.Errorf("not supported") }
+
+type cannedStmt struct {
+	c     *cannedConnector
+	query string
+}
+
+func (cannedStmt) Close() error  { return nil }
+func (cannedStmt) NumInput() int { return -1 }
+func (cannedStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (s cannedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	for _, r := range s.c.results {
+		if strings.Contains(s.query, r.Match) && (r.Args == nil || reflect.DeepEqual(r.Args, args)) {
+			return &cannedRows{cols: r.Cols, rows: r.Rows}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected query %s %v", s.query, args)
+}
+
+type cannedRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *cannedRows) Columns() []string { return r.cols }
+func (r *cannedRows) Close() error      { return nil }
+
+func (r *cannedRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// выгрузка и загрузка таблиц целиком:
+//
+//	GET /$table?format=csv - csv с заголовком из имён колонок, null - пустая ячейка
+//	GET /$table?format=ndjson - по json-объекту на строку
+//	POST /$table/_import?format=csv|ndjson - обратно, см. Import
+//
+// Выгрузка понимает filter, sort, fields, limit и offset и пишет строки по мере чтения из базы.
+// Если база сломалась на середине, статус уже не поменять: в ndjson последней строкой
+// приходит {"error": "..."}, в csv ошибка только пишется в лог
+
+var exportTypes = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"ndjson": "application/x-ndjson",
+}
+
+func (h *Handler) export(w http.ResponseWriter, acl *access, t Table, q Query, format string) {
+	var (
+		started bool
+		csvw    *csv.Writer
+		enc     = json.NewEncoder(w)
+	)
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", exportTypes[format])
+		w.WriteHeader(http.StatusOK)
+		if format == "csv" {
+			csvw = csv.NewWriter(w)
+			csvw.Write(q.Fields)
+		}
+	}
+
+	rows := make([]map[string]interface{}, 1)
+	record := make([]string, len(q.Fields))
+	err := h.queryEach(q, func(row map[string]interface{}) error {
+		if !started {
+			start()
+		}
+		rows[0] = row
+		acl.mask(t, rows)
+		if format == "ndjson" {
+			return enc.Encode(row)
+		}
+		for i, name := range q.Fields {
+			record[i] = csvValue(row[name])
+		}
+		return csvw.Write(record)
+	})
+
+	switch {
+	case err != nil && !started:
+		h.fail(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil && format == "ndjson":
+		enc.Encode(map[string]interface{}{"error": err.Error()})
+	case err != nil:
+		h.logf("db_explorer: export %s: %v", t.Name, err)
+	case !started:
+		start()
+	}
+	if csvw != nil {
+		csvw.Flush()
+	}
+}
+
+// csvValue - значение после decodeValue в ячейку csv
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case json.RawMessage:
+		return string(v)
+	case json.Number:
+		return v.String()
+	case []string:
+		return strings.Join(v, ",")
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
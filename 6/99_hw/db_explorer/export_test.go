@@ -0,0 +1,307 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	db := prepareSQLite(t)
+	defer db.Close()
+	h, err := NewHandler(db, SQLite{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	cases := []struct {
+		Query       string
+		Status      int
+		ContentType string
+		Body        string
+	}{
+		{
+			Query:       "format=csv",
+			Status:      http.StatusOK,
+			ContentType: "text/csv; charset=utf-8",
+			Body: "description,id,title,updated\n" +
+				"Рассказать про базы данных,1,database/sql,rvasily\n" +
+				"Рассказать про мемкеш с примером использования,2,memcache,\n",
+		},
+		{
+			Query:       "format=ndjson&fields=id,updated&sort=-id",
+			Status:      http.StatusOK,
+			ContentType: "application/x-ndjson",
+			Body:        "{\"id\":2,\"updated\":null}\n{\"id\":1,\"updated\":\"rvasily\"}\n",
+		},
+		{
+			Query:       "format=csv&fields=id,title&filter[id][gt]=5",
+			Status:      http.StatusOK,
+			ContentType: "text/csv; charset=utf-8",
+			Body:        "id,title\n",
+		},
+		{
+			Query:       "format=ndjson&filter[id][gt]=5",
+			Status:      http.StatusOK,
+			ContentType: "application/x-ndjson",
+			Body:        "",
+		},
+		{
+			Query:  "format=xml",
+			Status: http.StatusBadRequest,
+			Body:   "{\"error\":\"unknown format xml\"}\n",
+		},
+	}
+	for _, item := range cases {
+		resp, err := client.Get(ts.URL + "/items?" + item.Query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != item.Status {
+			t.Errorf("[%s] expected status %d, got %d", item.Query, item.Status, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); item.ContentType != "" && ct != item.ContentType {
+			t.Errorf("[%s] expected content type %s, got %s", item.Query, item.ContentType, ct)
+		}
+		if string(body) != item.Body {
+			t.Errorf("[%s] expected\n%q\ngot\n%q", item.Query, item.Body, body)
+		}
+	}
+}
+
+func TestCSVValue(t *testing.T) {
+	cases := []struct {
+		In  interface{}
+		Out string
+	}{
+		{nil, ""},
+		{"x", "x"},
+		{[]byte{1, 2}, "AQI="},
+		{true, "true"},
+		{int64(-5), "-5"},
+		{uint64(18446744073709551615), "18446744073709551615"},
+		{1e21, "1000000000000000000000"},
+		{[]string{"a", "b"}, "a,b"},
+		{map[string]interface{}{"a": 1}, `{"a":1}`},
+	}
+	for _, item := range cases {
+		if got := csvValue(item.In); got != item.Out {
+			t.Errorf("[%v] expected %q, got %q", item.In, item.Out, got)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	db := prepareRelations(t)
+	defer db.Close()
+	h, err := NewHandler(db, SQLite{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	// больше importBatch строк, чтобы было несколько пачек
+	var big strings.Builder
+	big.WriteString("title,author_id\n")
+	for i := 0; i < importBatch+10; i++ {
+		big.WriteString("\"post, \"\"quoted\"\"\",1\n")
+	}
+
+	cases := []struct {
+		Path        string
+		ContentType string
+		Body        string
+		Status      int
+		Result      string
+	}{
+		{
+			Path:   "/posts/_import?format=csv",
+			Body:   "title,author_id,editor_id\nfirst,1,\nsecond,2,1\n",
+			Status: http.StatusOK,
+			Result: `{"response":{"inserted":2}}`,
+		},
+		{
+			Path:        "/posts/_import",
+			ContentType: "text/csv",
+			Body:        big.String(),
+			Status:      http.StatusOK,
+			Result:      `{"response":{"inserted":510}}`,
+		},
+		{
+			Path:        "/authors/_import",
+			ContentType: "application/x-ndjson",
+			Body:        "{\"name\": \"a\"}\n\n{\"name\": \"b\", \"id\": 100}\n",
+			Status:      http.StatusOK,
+			Result:      `{"response":{"inserted":2}}`,
+		},
+		// ошибки по строкам, ничего не вставлено
+		{
+			Path:   "/posts/_import?format=csv",
+			Body:   "title,author_id\nok,1\nbad,x\nshort\nok,2\n",
+			Status: http.StatusBadRequest,
+			Result: `{"error":"import failed","errors":[{"line":3,"error":"field author_id have invalid type"},{"line":4,"error":"wrong number of fields"}]}`,
+		},
+		{
+			Path:   "/authors/_import?format=ndjson",
+			Body:   "{\"name\": \"c\"}\n{\"name\": 1}\nnot json\n",
+			Status: http.StatusBadRequest,
+			Result: `{"error":"import failed","errors":[{"line":2,"error":"field name have invalid type"},{"line":3,"error":"bad json: invalid character 'o' in literal null (expecting 'u')"}]}`,
+		},
+		// битая строка csv - ошибка этой строки, а не паника
+		{
+			Path:   "/posts/_import?format=csv",
+			Body:   "title,author_id\nok,1\nx\"y,1\nok,2\n",
+			Status: http.StatusBadRequest,
+			Result: `{"error":"import failed","errors":[{"line":3,"error":"bare \" in non-quoted-field"}]}`,
+		},
+		// колонки, которой нет в таблице, - ошибка строки, а не тихо выброшенное значение
+		{
+			Path:   "/posts/_import?format=csv",
+			Body:   "title,author_id,autor\nok,1,2\n",
+			Status: http.StatusBadRequest,
+			Result: `{"error":"import failed","errors":[{"line":2,"error":"unknown field autor"}]}`,
+		},
+		{
+			Path:   "/authors/_import?format=ndjson",
+			Body:   "{\"name\": \"d\"}\n{\"name\": \"e\", \"nick\": \"x\"}\n",
+			Status: http.StatusBadRequest,
+			Result: `{"error":"import failed","errors":[{"line":2,"error":"unknown field nick"}]}`,
+		},
+		// ошибка базы - на пачку строк
+		{
+			Path:   "/posts/_import?format=csv",
+			Body:   "title,author_id\nok,1\norphan,99\n",
+			Status: http.StatusConflict,
+			Result: `{"error":"lines 2-3: ` + errMissingRef + `"}`,
+		},
+
+		{
+			Path:   "/posts/_import",
+			Body:   "title\n",
+			Status: http.StatusBadRequest,
+			Result: `{"error":"unknown format , use csv or ndjson"}`,
+		},
+		{
+			Path:   "/nope/_import?format=csv",
+			Body:   "title\n",
+			Status: http.StatusNotFound,
+			Result: `{"error":"unknown table"}`,
+		},
+	}
+	for i, item := range cases {
+		resp, err := client.Post(ts.URL+item.Path, item.ContentType, strings.NewReader(item.Body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != item.Status {
+			t.Errorf("[%d] expected status %d, got %d: %s", i, item.Status, resp.StatusCode, body)
+		}
+		if got := strings.TrimSpace(string(body)); got != item.Result {
+			t.Errorf("[%d] expected\n%s\ngot\n%s", i, item.Result, got)
+		}
+	}
+
+	var posts, authors int
+	db.QueryRow("SELECT COUNT(*) FROM posts").Scan(&posts)
+	db.QueryRow("SELECT COUNT(*) FROM authors").Scan(&authors)
+	if posts != 2+2+importBatch+10 || authors != 2+2 {
+		t.Errorf("expected %d posts and 4 authors, got %d and %d", 4+importBatch+10, posts, authors)
+	}
+	var title string
+	db.QueryRow("SELECT title FROM posts ORDER BY id DESC LIMIT 1").Scan(&title)
+	if title != `post, "quoted"` {
+		t.Errorf("bad csv quoting: %q", title)
+	}
+}
+
+// ошибка базы, кроме внешнего ключа, - 500, как и у PUT, а не 400
+func TestImportDBError(t *testing.T) {
+	db := openSQLite(t, []string{
+		`CREATE TABLE tags (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name varchar(255) NOT NULL UNIQUE
+);`,
+	})
+	defer db.Close()
+	h, err := NewHandler(db, SQLite{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	resp, err := client.Post(ts.URL+"/tags/_import?format=ndjson", "", strings.NewReader("{\"name\": \"go\"}\n{\"name\": \"go\"}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	want := `{"error":"lines 1-2: UNIQUE constraint failed: tags.name"}`
+	if resp.StatusCode != http.StatusInternalServerError || strings.TrimSpace(string(body)) != want {
+		t.Errorf("expected 500 %s, got %d %s", want, resp.StatusCode, body)
+	}
+}
+
+// json-колонка переживает выгрузку в csv и загрузку обратно
+func TestImportJSONRoundTrip(t *testing.T) {
+	db := openSQLite(t, []string{
+		`CREATE TABLE docs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  data json DEFAULT NULL
+);`,
+		`INSERT INTO docs (id, data) VALUES (1, '{"a":1,"b":"x, y"}'), (2, '[1,"two"]'), (3, '"str"'), (4, NULL);`,
+	})
+	defer db.Close()
+	h, err := NewHandler(db, SQLite{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	get := func(query string) string {
+		resp, err := client.Get(ts.URL + "/docs?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	// id автоинкрементный и при вставке не берётся из файла, сравниваем только данные
+	before, exported := get("fields=data"), get("format=csv")
+	if _, err := db.Exec("DELETE FROM docs"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Post(ts.URL+"/docs/_import?format=csv", "", strings.NewReader(exported))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("import failed: %s", body)
+	}
+	if after := get("fields=data"); after != before {
+		t.Errorf("json changed after csv round trip\nbefore: %s\nafter:  %s", before, after)
+	}
+
+	resp, err = client.Post(ts.URL+"/docs/_import?format=csv", "", strings.NewReader("data\n{broken\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if expected := `{"error":"import failed","errors":[{"line":2,"error":"field data have invalid type"}]}`; strings.TrimSpace(string(body)) != expected {
+		t.Errorf("expected %s, got %s", expected, body)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// фильтры, сортировка и выбор полей для GET /$table:
+//
+//	?filter[age][gt]=30&filter[name][like]=ann%&filter[id][in]=1,2,3&filter[updated][null]=true
+//	?sort=-id,name
+//	?fields=id,name
+//
+// filter[col]=v - то же самое, что filter[col][eq]=v. Все имена проверяются по Table.Columns,
+// значения уходят в запрос только плейсхолдерами
+
+// operators - операторы фильтра и их sql
+var operators = map[string]string{
+	"eq":   "=",
+	"ne":   "<>",
+	"gt":   ">",
+	"gte":  ">=",
+	"lt":   "<",
+	"lte":  "<=",
+	"like": "LIKE",
+	"in":   "IN",
+	"null": "IS NULL",
+}
+
+// Where - одно условие фильтра. Для in в Value лежит []interface{}, для null - bool
+type Where struct {
+	Name  string
+	Op    string
+	Value interface{}
+}
+
+// Order - колонка сортировки, в sort=-name минус значит по убыванию
+type Order struct {
+	Name string
+	Desc bool
+}
+
+// ParamError - неверный параметр запроса, отдаётся клиенту как 400
+type ParamError struct {
+	Msg string
+}
+
+func (e *ParamError) Error() string {
+	return e.Msg
+}
+
+func paramErrorf(format string, args ...interface{}) error {
+	return &ParamError{fmt.Sprintf(format, args...)}
+}
+
+// parseListParams разбирает filter, sort и fields в q
+func parseListParams(params url.Values, t Table, q *Query) error {
+	if err := parseFilters(params, t, q); err != nil {
+		return err
+	}
+
+	for _, name := range splitList(params.Get("sort")) {
+		o := Order{Name: name}
+		if strings.HasPrefix(name, "-") {
+			o.Name, o.Desc = name[1:], true
+		}
+		if _, ok := t.Columns[o.Name]; !ok {
+			return paramErrorf("unknown sort column %s", o.Name)
+		}
+		q.Sort = append(q.Sort, o)
+	}
+
+	for _, name := range splitList(params.Get("fields")) {
+		if _, ok := t.Columns[name]; !ok {
+			return paramErrorf("unknown field %s", name)
+		}
+		q.Fields = append(q.Fields, name)
+	}
+	return nil
+}
+
+func parseFilters(params url.Values, t Table, q *Query) error {
+	keys := []string{}
+	for key := range params {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	// порядок условий в запросе не должен зависеть от обхода map
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name, op, ok := parseFilterKey(key)
+		if !ok {
+			return paramErrorf("bad filter %s", key)
+		}
+		col, ok := t.Columns[name]
+		if !ok {
+			return paramErrorf("unknown filter column %s", name)
+		}
+		if _, ok := operators[op]; !ok {
+			return paramErrorf("unknown filter operator %s", op)
+		}
+
+		for _, raw := range params[key] {
+			value, err := filterValue(col, op, raw)
+			if err != nil {
+				return err
+			}
+			q.Filters = append(q.Filters, Where{Name: name, Op: op, Value: value})
+		}
+	}
+	return nil
+}
+
+// parseFilterKey - filter[col] или filter[col][op]
+func parseFilterKey(key string) (name, op string, ok bool) {
+	rest := strings.TrimPrefix(key, "filter[")
+	end := strings.Index(rest, "]")
+	if end <= 0 {
+		return "", "", false
+	}
+	name, rest = rest[:end], rest[end+1:]
+	if rest == "" {
+		return name, "eq", true
+	}
+	if !strings.HasPrefix(rest, "[") || !strings.HasSuffix(rest, "]") || len(rest) < 3 {
+		return "", "", false
+	}
+	return name, rest[1 : len(rest)-1], true
+}
+
+func filterValue(col Column, op, raw string) (interface{}, error) {
+	switch op {
+	case "null":
+		switch raw {
+		case "true", "1", "":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+		return nil, paramErrorf("filter %s[null] must be true or false", col.Name)
+	case "like":
+		// int LIKE text в postgres - ошибка типов, так что like только для строк, одинаково во всех базах
+		if col.Type != TypeString {
+			return nil, paramErrorf("filter %s[like] is allowed only for string columns", col.Name)
+		}
+		return raw, nil
+	case "in":
+		values := []interface{}{}
+		for _, item := range splitList(raw) {
+			v, err := coerce(item, col, false)
+			if err != nil {
+				return nil, &ParamError{err.Error()}
+			}
+			values = append(values, v)
+		}
+		if len(values) == 0 {
+			return nil, paramErrorf("filter %s[in] is empty", col.Name)
+		}
+		return values, nil
+	}
+	v, err := coerce(raw, col, false)
+	if err != nil {
+		return nil, &ParamError{err.Error()}
+	}
+	if v == nil {
+		return nil, paramErrorf("filter %s: use [null] to compare with null", col.Name)
+	}
+	return v, nil
+}
+
+func splitList(s string) []string {
+	res := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// where дописывает условия через AND, без слова WHERE
+func (b *sqlBuilder) where(filters []Where) {
+	for i, f := range filters {
+		if i > 0 {
+			b.WriteString(" AND ")
+		}
+		col := b.quote(f.Name)
+		switch f.Op {
+		case "in":
+			values := f.Value.([]interface{})
+			places := make([]string, len(values))
+			for j, v := range values {
+				places[j] = b.arg(v)
+			}
+			b.WriteString(col + " IN (" + strings.Join(places, ", ") + ")")
+		case "null":
+			if f.Value.(bool) {
+				b.WriteString(col + " IS NULL")
+			} else {
+				b.WriteString(col + " IS NOT NULL")
+			}
+		default:
+			b.WriteString(col + " " + operators[f.Op] + " " + b.arg(f.Value))
+		}
+	}
+}
+
+func (b *sqlBuilder) order(sort []Order) {
+	for i, o := range sort {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(b.quote(o.Name))
+		if o.Desc {
+			b.WriteString(" DESC")
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+var filterTable = Table{
+	Name:    "users",
+	PriKeys: []string{"user_id"},
+	Columns: map[string]Column{
+		"user_id": {Name: "user_id", Type: TypeInt, Bits: 32},
+		"login":   {Name: "login", Type: TypeString, Size: 255},
+		"age":     {Name: "age", Type: TypeInt, Bits: 32, Nullable: true},
+		"updated": {Name: "updated", Type: TypeString, Size: 255, Nullable: true},
+	},
+}
+
+func TestParseListParams(t *testing.T) {
+	cases := []struct {
+		Query  string
+		Where  string
+		Args   []interface{}
+		Order  string
+		Fields []string
+	}{
+		{
+			Query: "filter[age][gt]=30&filter[login][like]=ann%25",
+			Where: "`age` > ? AND `login` LIKE ?",
+			Args:  []interface{}{30, "ann%"},
+		},
+		{
+			Query: "filter[user_id][in]=1,2,3&filter[updated][null]=false&filter[login]=rvasily",
+			Where: "`login` = ? AND `updated` IS NOT NULL AND `user_id` IN (?, ?, ?)",
+			Args:  []interface{}{"rvasily", 1, 2, 3},
+		},
+		{
+			Query: "filter[age][gte]=18&filter[age][lt]=30&filter[login][ne]=x&filter[age][lte]=29",
+			Where: "`age` >= ? AND `age` < ? AND `age` <= ? AND `login` <> ?",
+			Args:  []interface{}{18, 30, 29, "x"},
+		},
+		{
+			Query: "filter[updated][null]=true&filter[age][eq]=1",
+			Where: "`age` = ? AND `updated` IS NULL",
+			Args:  []interface{}{1},
+		},
+		{
+			Query:  "sort=-user_id,login&fields=user_id,login",
+			Order:  "`user_id` DESC, `login`",
+			Fields: []string{"user_id", "login"},
+		},
+	}
+
+	for _, item := range cases {
+		params, _ := url.ParseQuery(item.Query)
+		q := Query{}
+		if err := parseListParams(params, filterTable, &q); err != nil {
+			t.Errorf("[%s] unexpected error %v", item.Query, err)
+			continue
+		}
+		b := newBuilder(MySQL{})
+		b.where(q.Filters)
+		where, args := b.String(), b.args
+		if where != item.Where || !reflect.DeepEqual(args, item.Args) {
+			t.Errorf("[%s] expected %s %v, got %s %v", item.Query, item.Where, item.Args, where, args)
+		}
+		b = newBuilder(MySQL{})
+		b.order(q.Sort)
+		if order := b.String(); order != item.Order {
+			t.Errorf("[%s] expected order %s, got %s", item.Query, item.Order, order)
+		}
+		if !reflect.DeepEqual(q.Fields, item.Fields) {
+			t.Errorf("[%s] expected fields %v, got %v", item.Query, item.Fields, q.Fields)
+		}
+	}
+}
+
+func TestListParamsErrors(t *testing.T) {
+	h := &Handler{tables: map[string]Table{"users": filterTable}}
+	ts := httptest.NewServer(http.HandlerFunc(h.Router))
+	defer ts.Close()
+
+	cases := []struct {
+		Query string
+		Error string
+	}{
+		{"filter[password]=love", "unknown filter column password"},
+		{"filter[age][regexp]=1", "unknown filter operator regexp"},
+		{"filter[age][gt]=old", "field age have invalid type"},
+		{"filter[age][in]=1,x", "field age have invalid type"},
+		{"filter[age][in]=,", "filter age[in] is empty"},
+		{"filter[age][null]=maybe", "filter age[null] must be true or false"},
+		{"filter[age]=", "filter age: use [null] to compare with null"},
+		{"filter[age][like]=3%25", "filter age[like] is allowed only for string columns"},
+		{"filter[age", "bad filter filter[age"},
+		{"filter[age]x", "bad filter filter[age]x"},
+		{"sort=-password", "unknown sort column password"},
+		{"fields=user_id,password", "unknown field password"},
+	}
+	for _, item := range cases {
+		resp, err := http.Get(ts.URL + "/users?" + item.Query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := map[string]interface{}{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest || body["error"] != item.Error {
+			t.Errorf("[%s] expected 400 %q, got %d %v", item.Query, item.Error, resp.StatusCode, body)
+		}
+	}
+}
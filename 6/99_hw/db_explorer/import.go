@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// POST /$table/_import - загрузка csv (первая строка - имена колонок) или ndjson.
+// Формат - из ?format=, иначе по Content-Type.
+//
+// Всё идёт одной транзакцией, строки вставляются пачками по importBatch.
+// Если хоть одна строка не приводится к типам колонок или в ней есть колонка,
+// которой нет в таблице, не вставляется ничего, а в ответе 400 и ошибки
+// по номерам строк файла, не больше maxImportErrors:
+//
+//	{"error": "import failed", "errors": [{"line": 3, "error": "field age have invalid type"}]}
+//
+// Ошибки базы - как у записи одной строки: нарушение внешнего ключа 409, остальное 500
+
+const (
+	importBatch     = 500
+	maxImportErrors = 100
+	// maxInsertArgs - плейсхолдеров в одном INSERT, больше старые sqlite не принимают
+	maxInsertArgs = 999
+	// maxImportLine - самая длинная строка ndjson
+	maxImportLine = 1 << 20
+)
+
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+var errTooManyErrors = errors.New("too many errors")
+
+// importer копит строки и вставляет их пачками
+type importer struct {
+	h   *Handler
+	tx  *sql.Tx
+	t   Table
+	acl *access
+
+	cols       []string
+	pending    [][]interface{}
+	firstLine  int
+	lastLine   int
+	inserted   int
+	lineErrors []importError
+}
+
+// add обрабатывает строку файла. Ошибка из add - импорт надо прервать
+func (im *importer) add(line int, values map[string]interface{}, parseErr error) error {
+	err := parseErr
+	if err == nil {
+		err = unknownColumns(im.t, values)
+	}
+	if err == nil {
+		err = im.acl.checkWrite(im.t, opInsert, values)
+	}
+	var cols []string
+	var args []interface{}
+	if err == nil {
+		cols, args, _, err = insertValues(im.t, values)
+	}
+	if err != nil {
+		im.lineErrors = append(im.lineErrors, importError{Line: line, Error: err.Error()})
+		if len(im.lineErrors) >= maxImportErrors {
+			return errTooManyErrors
+		}
+		return nil
+	}
+	// после первой ошибки строки только проверяются, всё равно будет откат
+	if len(im.lineErrors) > 0 {
+		return nil
+	}
+
+	if len(cols) == 0 {
+		// вставлять нечего, кроме значений по умолчанию - по одной строке
+		if _, err := im.h.d.Insert(im.tx, im.t, nil, nil); err != nil {
+			return im.batchError(line, line, im.h.dbError(err, errMissingRef))
+		}
+		im.inserted++
+		return nil
+	}
+	if len(im.pending) == 0 {
+		im.cols, im.firstLine = cols, line
+	}
+	im.pending = append(im.pending, args)
+	im.lastLine = line
+	if len(im.pending) >= importBatch || (len(im.pending)+1)*len(cols) > maxInsertArgs {
+		return im.flush()
+	}
+	return nil
+}
+
+func (im *importer) flush() error {
+	if len(im.pending) == 0 {
+		return nil
+	}
+	b := insertManySQL(im.h.d, im.t, im.cols, im.pending)
+	if _, err := im.tx.Exec(b.String(), b.args...); err != nil {
+		return im.batchError(im.firstLine, im.lastLine, im.h.dbError(err, errMissingRef))
+	}
+	im.inserted += len(im.pending)
+	im.pending = im.pending[:0]
+	return nil
+}
+
+// unknownColumns - опечатка в заголовке csv или ключе ndjson не должна молча терять данные
+func unknownColumns(t Table, values map[string]interface{}) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if _, ok := t.Columns[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return paramErrorf("unknown field %s", strings.Join(names, ", "))
+}
+
+// batchError - ошибка базы на пачке строк: какая именно строка виновата, не узнать
+func (im *importer) batchError(from, to int, err error) error {
+	msg := fmt.Sprintf("lines %d-%d: %v", from, to, err)
+	if from == to {
+		msg = fmt.Sprintf("line %d: %v", from, err)
+	}
+	if se, ok := err.(*StatusError); ok {
+		return &StatusError{se.Status, msg}
+	}
+	return errors.New(msg)
+}
+
+func importFormat(r *http.Request) string {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f
+	}
+	ct := r.Header.Get("Content-Type")
+	switch {
+	case strings.Contains(ct, "csv"):
+		return "csv"
+	case strings.Contains(ct, "ndjson"), strings.Contains(ct, "jsonl"):
+		return "ndjson"
+	}
+	return ""
+}
+
+func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r)
+	t, ok := h.tableOr404(w, r, parts[0])
+	if !ok {
+		return
+	}
+	acl := accessOf(r)
+	if err := acl.can(t, opInsert); err != nil {
+		h.failErr(w, http.StatusForbidden, err)
+		return
+	}
+	var read func(io.Reader, func(int, map[string]interface{}, error) error) error
+	switch format := importFormat(r); format {
+	case "csv":
+		read = func(r io.Reader, fn func(int, map[string]interface{}, error) error) error {
+			return readCSV(r, t, fn)
+		}
+	case "ndjson":
+		read = readNDJSON
+	default:
+		h.fail(w, http.StatusBadRequest, fmt.Sprintf("unknown format %s, use csv or ndjson", format))
+		return
+	}
+	defer r.Body.Close()
+
+	tx, err := h.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		h.fail(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	im := &importer{h: h, tx: tx, t: t, acl: acl}
+	err = read(r.Body, im.add)
+	if err == nil || err == errTooManyErrors {
+		if len(im.lineErrors) > 0 {
+			tx.Rollback()
+			h.writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error":  "import failed",
+				"errors": im.lineErrors,
+			})
+			return
+		}
+		err = im.flush()
+	}
+	if err != nil {
+		tx.Rollback()
+		h.failErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		h.fail(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.ok(w, map[string]interface{}{"inserted": im.inserted})
+}
+
+// readCSV - первая строка - имена колонок, пустая ячейка - как пустая строка в PUT,
+// то есть null для nullable колонок не строкового типа. Ячейки json-колонок - сам json,
+// как их пишет выгрузка, а не строка с json внутри
+func readCSV(r io.Reader, t Table, fn func(line int, values map[string]interface{}, err error) error) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return &ParamError{fmt.Sprintf("bad csv header: %v", err)}
+	}
+	cr.FieldsPerRecord = len(header)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var line int
+		var values map[string]interface{}
+		if err == nil {
+			// FieldPos можно звать только после удачного Read
+			line, _ = cr.FieldPos(0)
+			values = make(map[string]interface{}, len(header))
+			for i, name := range header {
+				values[name] = record[i]
+				if col, ok := t.Columns[name]; ok && col.Type == TypeJSON && record[i] != "" {
+					values[name] = json.RawMessage(record[i])
+				}
+			}
+		} else if pe, ok := err.(*csv.ParseError); ok {
+			line, err = pe.StartLine, pe.Err
+		} else {
+			return err
+		}
+		if err := fn(line, values, err); err != nil {
+			return err
+		}
+	}
+}
+
+// readNDJSON - по json-объекту на строку, пустые строки пропускаются
+func readNDJSON(r io.Reader, fn func(line int, values map[string]interface{}, err error) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxImportLine)
+	line := 0
+	for sc.Scan() {
+		line++
+		data := strings.TrimSpace(sc.Text())
+		if data == "" {
+			continue
+		}
+		var values map[string]interface{}
+		err := json.Unmarshal([]byte(data), &values)
+		if err != nil {
+			err = fmt.Errorf("bad json: %v", err)
+		}
+		if err := fn(line, values, err); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return &ParamError{fmt.Sprintf("bad ndjson: %v", err)}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// первичный ключ записи в url. Одна колонка - как раньше, /$table/$id.
+// Составной ключ - значения через ; в порядке колонок ключа:
+//
+//	/user_follows/1;2
+//	/sessions/abc%3Bdef - ; внутри значения экранируется
+//
+// Значения приводятся к типам колонок, так что /items/abc для целого id - просто 404
+
+// keySegment - сегмент ключа как он пришёл, до раскодирования %XX:
+// иначе экранированную ; не отличить от разделителя
+func keySegment(r *http.Request) string {
+	parts := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// parseKey разбирает сегмент ключа. ok == false - записи с таким ключом быть не может
+func parseKey(t Table, raw string) (key []interface{}, ok bool, err error) {
+	parts := []interface{}{}
+	for _, part := range strings.Split(raw, ";") {
+		s, err := url.PathUnescape(part)
+		if err != nil {
+			return nil, false, paramErrorf("bad key %s", raw)
+		}
+		parts = append(parts, s)
+	}
+	return keyValues(t, parts)
+}
+
+// keyValues приводит значения ключа к типам его колонок, значения - из url или из json
+func keyValues(t Table, parts []interface{}) (key []interface{}, ok bool, err error) {
+	if len(t.PriKeys) == 0 {
+		return nil, false, paramErrorf("table %s has no primary key", t.Name)
+	}
+	if len(parts) != len(t.PriKeys) {
+		return nil, false, paramErrorf("key of %s must have %d parts: %s", t.Name, len(t.PriKeys), strings.Join(t.PriKeys, ";"))
+	}
+	for i, part := range parts {
+		v, err := coerce(part, t.Columns[t.PriKeys[i]], false)
+		if err != nil || v == nil {
+			return nil, false, nil
+		}
+		key = append(key, v)
+	}
+	return key, true, nil
+}
+
+// keyOr404 - ключ из url, либо ответ 400/404 и ok == false
+func (h *Handler) keyOr404(w http.ResponseWriter, r *http.Request, t Table) ([]interface{}, bool) {
+	key, ok, err := parseKey(t, keySegment(r))
+	if err != nil {
+		h.fail(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if !ok {
+		h.fail(w, http.StatusNotFound, "record not found")
+		return nil, false
+	}
+	return key, true
+}
+
+// keyFilters - условие на запись с ключом key
+func keyFilters(t Table, key []interface{}) []Where {
+	res := make([]Where, len(key))
+	for i, v := range key {
+		res[i] = Where{Name: t.PriKeys[i], Op: "eq", Value: v}
+	}
+	return res
+}
+
+func (t Table) isKey(name string) bool {
+	for _, k := range t.PriKeys {
+		if k == name {
+			return true
+		}
+	}
+	return false
+}
+
+// autoKey - колонка ключа, которую генерирует база, или пустая строка
+func (t Table) autoKey() string {
+	for _, k := range t.PriKeys {
+		if t.Columns[k].AutoIncrement {
+			return k
+		}
+	}
+	return ""
+}
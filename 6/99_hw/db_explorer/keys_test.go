@@ -0,0 +1,231 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCompositeKeys(t *testing.T) {
+	db := openSQLite(t, []string{
+		`CREATE TABLE user_follows (
+  follower_id int(11) NOT NULL,
+  followee_id int(11) NOT NULL,
+  note varchar(255) DEFAULT NULL,
+  PRIMARY KEY (followee_id, follower_id)
+);`,
+		`CREATE TABLE sessions (
+  id varchar(64) NOT NULL PRIMARY KEY,
+  user_id int(11) NOT NULL
+);`,
+		`INSERT INTO user_follows (follower_id, followee_id, note) VALUES (1, 2, 'first'), (3, 2, NULL);`,
+		`INSERT INTO sessions (id, user_id) VALUES ('abc', 1);`,
+	})
+	defer db.Close()
+
+	tables, err := SQLite{}.LoadTables(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// порядок колонок ключа - как в PRIMARY KEY, а не как в таблице
+	if keys := tables["user_follows"].PriKeys; !reflect.DeepEqual(keys, []string{"followee_id", "follower_id"}) {
+		t.Errorf("bad user_follows key %v", keys)
+	}
+	if auto := tables["sessions"].autoKey(); auto != "" {
+		t.Errorf("varchar key is not generated, got %s", auto)
+	}
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	cases := []Case{
+		Case{
+			Path: "/user_follows/2;1",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"follower_id": 1,
+						"followee_id": 2,
+						"note":        "first",
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/user_follows/1;2",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "record not found",
+			},
+		},
+		Case{
+			Path:   "/user_follows/x;2",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "record not found",
+			},
+		},
+		Case{
+			Path:   "/user_follows/2",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "key of user_follows must have 2 parts: followee_id;follower_id",
+			},
+		},
+		Case{
+			Path:   "/user_follows/",
+			Method: http.MethodPut,
+			Body: CR{
+				"follower_id": 5,
+				"followee_id": 2,
+			},
+			Result: CR{
+				"response": CR{
+					"follower_id": 5,
+					"followee_id": 2,
+				},
+			},
+		},
+		Case{
+			Path:   "/user_follows/",
+			Method: http.MethodPut,
+			Body: CR{
+				"follower_id": 6,
+			},
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "field followee_id is required",
+			},
+		},
+		Case{
+			Path:   "/user_follows/2;5",
+			Method: http.MethodPost,
+			Body: CR{
+				"note": "updated",
+			},
+			Result: CR{
+				"response": CR{
+					"updated": 1,
+				},
+			},
+		},
+		Case{
+			Path:   "/user_follows/2;5",
+			Method: http.MethodPost,
+			Body: CR{
+				"follower_id": 7,
+			},
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "field follower_id have invalid type",
+			},
+		},
+		Case{
+			Path:  "/user_follows",
+			Query: "filter[followee_id]=2&sort=follower_id&fields=follower_id,note",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"follower_id": 1, "note": "first"},
+						CR{"follower_id": 3, "note": nil},
+						CR{"follower_id": 5, "note": "updated"},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/user_follows/2;3",
+			Method: http.MethodDelete,
+			Result: CR{
+				"response": CR{
+					"deleted": 1,
+				},
+			},
+		},
+		Case{
+			Path:   "/sessions/",
+			Method: http.MethodPut,
+			Body: CR{
+				"id":      "def;ghi",
+				"user_id": 2,
+			},
+			Result: CR{
+				"response": CR{
+					"id": "def;ghi",
+				},
+			},
+		},
+		Case{
+			Path: "/sessions/def%3Bghi",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"id":      "def;ghi",
+						"user_id": 2,
+					},
+				},
+			},
+		},
+		Case{ // / внутри ключа не режет путь на лишние сегменты
+			Path:   "/sessions/",
+			Method: http.MethodPut,
+			Body: CR{
+				"id":      "a/b",
+				"user_id": 3,
+			},
+			Result: CR{
+				"response": CR{
+					"id": "a/b",
+				},
+			},
+		},
+		Case{
+			Path: "/sessions/a%2Fb",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"id":      "a/b",
+						"user_id": 3,
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/sessions/a%2Fb",
+			Method: http.MethodPost,
+			Body: CR{
+				"user_id": 4,
+			},
+			Result: CR{
+				"response": CR{
+					"updated": 1,
+				},
+			},
+		},
+		Case{
+			Path:   "/sessions/a%2Fb",
+			Method: http.MethodDelete,
+			Result: CR{
+				"response": CR{
+					"deleted": 1,
+				},
+			},
+		},
+		Case{
+			Path:   "/sessions/abc",
+			Method: http.MethodDelete,
+			Result: CR{
+				"response": CR{
+					"deleted": 1,
+				},
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
@@ -104,7 +104,12 @@ func TestApis(t *testing.T) {
 
 	ts := httptest.NewServer(handler)
 
-	cases := []Case{
+	runCases(t, ts, db, apiCases())
+}
+
+// apiCases - общие для всех баз кейсы, схему под них готовит PrepareTestApis
+func apiCases() []Case {
+	return []Case{
 		Case{
 			Path: "/", // список таблиц
 			Result: CR{
@@ -495,9 +500,48 @@ func TestApis(t *testing.T) {
 				},
 			},
 		},
+		// фильтр, сортировка и выбор полей
+		Case{
+			Path:  "/users",
+			Query: "filter[login][like]=%25'&sort=-user_id&fields=user_id,login",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"user_id": 2,
+							"login":   "qwerty'",
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/users",
+			Query: "filter[updated][null]=false&filter[user_id][in]=1,2",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{
+							"user_id":  1,
+							"login":    "rvasily",
+							"password": "love",
+							"email":    "rvasily@example.com",
+							"info":     "try update",
+							"updated":  "now",
+						},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/users",
+			Query:  "filter[nope][gt]=1",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "unknown filter column nope",
+			},
+		},
 	}
-
-	runCases(t, ts, db, cases)
 }
 
 func runCases(t *testing.T, ts *httptest.Server, db *sql.DB, cases []Case) {
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http"
+)
+
+// связи между таблицами по внешним ключам:
+//
+//	GET /$table/$id?expand=author_id,editor_id - вместо значения ключа встраивается строка, на которую он ссылается
+//	GET /$table/$id/$child - строки $child, которые ссылаются на эту запись.
+//	Если ссылок из $child несколько, нужную колонку выбирает ?via=column
+//
+// Запись, которая нарушила бы внешний ключ, отвечает 409
+
+const (
+	errMissingRef = "foreign key violation: referenced record does not exist"
+	errReferenced = "foreign key violation: record is referenced by other rows"
+)
+
+// parseExpand проверяет, что все колонки из expand - внешние ключи
+func parseExpand(raw string, t Table) ([]ForeignKey, error) {
+	res := []ForeignKey{}
+	for _, name := range splitList(raw) {
+		if _, ok := t.Columns[name]; !ok {
+			return nil, paramErrorf("unknown expand column %s", name)
+		}
+		fk, ok := t.ForeignKeys[name]
+		if !ok {
+			return nil, paramErrorf("column %s is not a foreign key", name)
+		}
+		res = append(res, fk)
+	}
+	return res, nil
+}
+
+// expandRow заменяет значения ключей на строки, на которые они ссылаются.
+// Ключ без значения или с битой ссылкой становится null
+// Встроенная строка показывается по правам на чтение её таблицы
+func (h *Handler) expandRow(acl *access, row map[string]interface{}, keys []ForeignKey) error {
+	for _, fk := range keys {
+		val := row[fk.Column]
+		if val == nil {
+			continue
+		}
+		refTable, ok := h.schema()[fk.RefTable]
+		if !ok || !acl.visible(fk.RefTable) {
+			return paramErrorf("column %s is not a foreign key", fk.Column)
+		}
+		if err := acl.can(refTable, opRead); err != nil {
+			return err
+		}
+		ref, err := h.Query(Query{
+			Table:   fk.RefTable,
+			Fields:  colNames(acl.view(refTable)),
+			Filters: []Where{{Name: fk.RefColumn, Op: "eq", Value: val}},
+			Limit:   1,
+		})
+		if err != nil {
+			return err
+		}
+		acl.mask(refTable, ref)
+		row[fk.Column] = nil
+		if len(ref) > 0 {
+			row[fk.Column] = ref[0]
+		}
+	}
+	return nil
+}
+
+// childKey ищет колонку child, которая ссылается на parent
+func childKey(parent string, child Table, via string) (ForeignKey, error) {
+	if via != "" {
+		fk, ok := child.ForeignKeys[via]
+		if !ok || fk.RefTable != parent {
+			return fk, paramErrorf("column %s does not reference %s", via, parent)
+		}
+		return fk, nil
+	}
+	var found []ForeignKey
+	for _, name := range colNames(child) {
+		if fk, ok := child.ForeignKeys[name]; ok && fk.RefTable == parent {
+			found = append(found, fk)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return ForeignKey{}, paramErrorf("table %s does not reference %s", child.Name, parent)
+	case 1:
+		return found[0], nil
+	}
+	return ForeignKey{}, paramErrorf("table %s references %s more than once, choose one with via", child.Name, parent)
+}
+
+// GetChildren - GET /$table/$id/$child, понимает те же параметры, что и GetRows
+func (h *Handler) GetChildren(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r)
+	tableName, childName := parts[0], parts[2]
+	t, ok := h.tableOr404(w, r, tableName)
+	if !ok {
+		return
+	}
+	child, ok := h.tableOr404(w, r, childName)
+	if !ok {
+		return
+	}
+	key, ok := h.keyOr404(w, r, t)
+	if !ok {
+		return
+	}
+	acl := accessOf(r)
+	for _, table := range []Table{t, child} {
+		if err := acl.can(table, opRead); err != nil {
+			h.failErr(w, http.StatusForbidden, err)
+			return
+		}
+	}
+	view := acl.view(child)
+	fk, err := childKey(tableName, view, r.URL.Query().Get("via"))
+	if err != nil {
+		h.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// список детей - это фильтр по ключу, а по скрытой колонке фильтровать нельзя
+	if acl.masked(child, fk.Column) {
+		h.fail(w, http.StatusBadRequest, "via column "+fk.Column+" is masked")
+		return
+	}
+
+	// ссылаться могут не только на первичный ключ, поэтому значение берём из самой записи
+	parent, err := h.Query(Query{Table: tableName, Key: key, Fields: []string{fk.RefColumn}})
+	if err != nil {
+		h.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(parent) == 0 {
+		h.fail(w, http.StatusNotFound, "record not found")
+		return
+	}
+
+	q := Query{
+		Table:   childName,
+		Limit:   intQuery(r, "limit"),
+		Offset:  intQuery(r, "offset"),
+		Filters: []Where{{Name: fk.Column, Op: "eq", Value: parent[0][fk.RefColumn]}},
+	}
+	if err := parseListParams(r.URL.Query(), view, &q); err != nil {
+		h.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := acl.checkMasked(child, q); err != nil {
+		h.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(q.Fields) == 0 {
+		q.Fields = colNames(view)
+	}
+	result, err := h.Query(q)
+	if err != nil {
+		h.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	acl.mask(child, result)
+	h.ok(w, map[string]interface{}{"records": result})
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func prepareRelations(t *testing.T) *sql.DB {
+	return openSQLite(t, []string{
+		`CREATE TABLE authors (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name varchar(255) NOT NULL
+);`,
+		`CREATE TABLE posts (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  author_id INTEGER NOT NULL REFERENCES authors(id),
+  editor_id INTEGER DEFAULT NULL REFERENCES authors,
+  title varchar(255) NOT NULL
+);`,
+		`CREATE TABLE comments (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  post_id INTEGER NOT NULL REFERENCES posts(id),
+  body text NOT NULL
+);`,
+		`INSERT INTO authors (id, name) VALUES (1, 'rvasily'), (2, 'editor');`,
+		`INSERT INTO posts (id, author_id, editor_id, title) VALUES (1, 1, 2, 'database/sql'), (2, 1, NULL, 'memcache');`,
+		`INSERT INTO comments (id, post_id, body) VALUES (1, 1, 'first'), (2, 1, 'second'), (3, 2, 'third');`,
+	})
+}
+
+func TestForeignKeysSQLite(t *testing.T) {
+	db := prepareRelations(t)
+	defer db.Close()
+	tables, err := SQLite{}.LoadTables(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]ForeignKey{
+		"author_id": {Column: "author_id", RefTable: "authors", RefColumn: "id"},
+		// REFERENCES authors без колонки - ссылка на первичный ключ
+		"editor_id": {Column: "editor_id", RefTable: "authors", RefColumn: "id"},
+	}
+	if !reflect.DeepEqual(tables["posts"].ForeignKeys, expected) {
+		t.Errorf("expected %+v, got %+v", expected, tables["posts"].ForeignKeys)
+	}
+	if len(tables["authors"].ForeignKeys) != 0 {
+		t.Errorf("authors has no foreign keys, got %+v", tables["authors"].ForeignKeys)
+	}
+}
+
+func TestRelations(t *testing.T) {
+	db := prepareRelations(t)
+	defer db.Close()
+
+	handler, err := NewDbExplorer(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	author := CR{"id": 1, "name": "rvasily"}
+	cases := []Case{
+		Case{
+			Path:  "/posts/1",
+			Query: "expand=author_id,editor_id",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"id":        1,
+						"author_id": author,
+						"editor_id": CR{"id": 2, "name": "editor"},
+						"title":     "database/sql",
+					},
+				},
+			},
+		},
+		Case{
+			Path:  "/posts/2",
+			Query: "expand=editor_id",
+			Result: CR{
+				"response": CR{
+					"record": CR{
+						"id":        2,
+						"author_id": 1,
+						"editor_id": nil,
+						"title":     "memcache",
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/posts/1",
+			Query:  "expand=title",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "column title is not a foreign key",
+			},
+		},
+		Case{
+			Path:   "/posts/1",
+			Query:  "expand=nope",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "unknown expand column nope",
+			},
+		},
+		Case{
+			Path:  "/posts/1/comments",
+			Query: "fields=id,body&sort=-id",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 2, "body": "second"},
+						CR{"id": 1, "body": "first"},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/authors/1/posts",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "table posts references authors more than once, choose one with via",
+			},
+		},
+		Case{
+			Path:  "/authors/2/posts",
+			Query: "via=editor_id&fields=id",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 1},
+					},
+				},
+			},
+		},
+		Case{
+			Path:   "/authors/1/posts",
+			Query:  "via=title",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "column title does not reference authors",
+			},
+		},
+		Case{
+			Path:   "/authors/9/posts",
+			Query:  "via=author_id",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "record not found",
+			},
+		},
+		Case{
+			Path:   "/comments/1/posts",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "table posts does not reference comments",
+			},
+		},
+		Case{
+			Path:   "/posts/1/unknown_table",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown table",
+			},
+		},
+		Case{
+			Path:   "/comments/",
+			Method: http.MethodPut,
+			Body: CR{
+				"post_id": 99,
+				"body":    "orphan",
+			},
+			Status: http.StatusConflict,
+			Result: CR{
+				"error": errMissingRef,
+			},
+		},
+		Case{
+			Path:   "/comments/1",
+			Method: http.MethodPost,
+			Body: CR{
+				"post_id": 99,
+			},
+			Status: http.StatusConflict,
+			Result: CR{
+				"error": errMissingRef,
+			},
+		},
+		Case{
+			Path:   "/posts/2",
+			Method: http.MethodDelete,
+			Status: http.StatusConflict,
+			Result: CR{
+				"error": errReferenced,
+			},
+		},
+		Case{
+			Path:   "/comments/3",
+			Method: http.MethodDelete,
+			Result: CR{
+				"response": CR{
+					"deleted": 1,
+				},
+			},
+		},
+		Case{
+			Path:   "/posts/2",
+			Method: http.MethodDelete,
+			Result: CR{
+				"response": CR{
+					"deleted": 1,
+				},
+			},
+		},
+	}
+
+	runCases(t, ts, db, cases)
+}
+
+// скрытый внешний ключ нельзя раскрыть ни через expand, ни через список детей
+func TestRelationsMasked(t *testing.T) {
+	db := prepareRelations(t)
+	defer db.Close()
+	h, err := NewHandler(db, SQLite{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Policy = &Policy{Roles: map[string]map[string]TablePolicy{"*": {
+		"*":     {},
+		"posts": {Mask: []string{"author_id"}},
+	}}}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	runCases(t, ts, db, []Case{
+		Case{
+			Path:   "/posts/1",
+			Query:  "expand=author_id",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "expand column author_id is masked",
+			},
+		},
+		Case{
+			Path:   "/authors/1/posts",
+			Query:  "via=author_id",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "via column author_id is masked",
+			},
+		},
+		Case{
+			Path:  "/authors/2/posts",
+			Query: "via=editor_id&fields=id,author_id",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"id": 1, "author_id": "***"},
+					},
+				},
+			},
+		},
+	})
+}
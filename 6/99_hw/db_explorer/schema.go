@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// схема базы читается в Init и дальше перечитывается:
+//
+//	POST /_schema/reload - сразу, в ответе какие таблицы появились, пропали и поменялись
+//	Handler.Watch - раз в interval
+//	GET /_schema - текущая схема: колонки, типы, ключи
+//
+// Новая схема подменяет старую целиком, запросы, которые уже идут, дорабатывают со старой
+
+// SchemaDiff - чем новая схема отличается от старой
+type SchemaDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+func diffSchema(old, cur map[string]Table) SchemaDiff {
+	diff := SchemaDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for name, t := range cur {
+		prev, ok := old[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, name)
+		case !reflect.DeepEqual(prev, t):
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range old {
+		if _, ok := cur[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+func (h *Handler) schema() map[string]Table {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.tables
+}
+
+// Reload перечитывает схему. Если база отдала ошибку, остаётся старая схема
+func (h *Handler) Reload() (SchemaDiff, error) {
+	tables, err := h.d.LoadTables(h.db)
+	if err != nil {
+		return SchemaDiff{}, err
+	}
+	// таблицы, которой больше нет, просто пропускаем, а вот колонка версии должна быть годной
+	for name, version := range h.Versions {
+		t, ok := tables[name]
+		if !ok {
+			continue
+		}
+		if col, ok := t.Columns[version]; !ok || col.Type != TypeInt || t.isKey(version) {
+			return SchemaDiff{}, fmt.Errorf("table %s: version column %s must be an int column outside the primary key", name, version)
+		}
+		t.Version = version
+		tables[name] = t
+	}
+
+	h.mu.Lock()
+	diff := diffSchema(h.tables, tables)
+	h.tables = tables
+	h.mu.Unlock()
+	return diff, nil
+}
+
+// Watch раз в interval перечитывает схему. Работает до отмены ctx
+func (h *Handler) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := h.Reload(); err != nil {
+			h.logf("db_explorer: reload schema: %v", err)
+		}
+	}
+}
+
+func (h *Handler) logf(format string, args ...interface{}) {
+	if h.ErrorLog != nil {
+		h.ErrorLog(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+func (h *Handler) ReloadSchema(w http.ResponseWriter, r *http.Request) {
+	if err := accessOf(r).canReload(); err != nil {
+		h.failErr(w, http.StatusForbidden, err)
+		return
+	}
+	diff, err := h.Reload()
+	if err != nil {
+		h.fail(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.ok(w, map[string]interface{}{
+		"added":   diff.Added,
+		"removed": diff.Removed,
+		"changed": diff.Changed,
+	})
+}
+
+// columnInfo и tableInfo - схема в GET /_schema
+type columnInfo struct {
+	Name          string     `json:"name"`
+	Type          ColumnType `json:"type"`
+	RawType       string     `json:"raw_type"`
+	Nullable      bool       `json:"nullable"`
+	AutoIncrement bool       `json:"auto_increment,omitempty"`
+	Unsigned      bool       `json:"unsigned,omitempty"`
+	Size          int        `json:"size,omitempty"`
+	Precision     int        `json:"precision,omitempty"`
+	Scale         int        `json:"scale,omitempty"`
+	Values        []string   `json:"values,omitempty"`
+}
+
+type foreignKeyInfo struct {
+	Column    string `json:"column"`
+	RefTable  string `json:"ref_table"`
+	RefColumn string `json:"ref_column"`
+}
+
+type tableInfo struct {
+	Columns     []columnInfo     `json:"columns"`
+	PrimaryKey  []string         `json:"primary_key"`
+	ForeignKeys []foreignKeyInfo `json:"foreign_keys"`
+	Version     string           `json:"version,omitempty"`
+}
+
+func describeTable(t Table) tableInfo {
+	info := tableInfo{
+		Columns:     []columnInfo{},
+		PrimaryKey:  t.PriKeys,
+		ForeignKeys: []foreignKeyInfo{},
+		Version:     t.Version,
+	}
+	if info.PrimaryKey == nil {
+		info.PrimaryKey = []string{}
+	}
+	for _, name := range colNames(t) {
+		col := t.Columns[name]
+		info.Columns = append(info.Columns, columnInfo{
+			Name:          col.Name,
+			Type:          col.Type,
+			RawType:       col.RawType,
+			Nullable:      col.Nullable,
+			AutoIncrement: col.AutoIncrement,
+			Unsigned:      col.Unsigned,
+			Size:          col.Size,
+			Precision:     col.Precision,
+			Scale:         col.Scale,
+			Values:        col.Values,
+		})
+		if fk, ok := t.ForeignKeys[name]; ok {
+			info.ForeignKeys = append(info.ForeignKeys, foreignKeyInfo(fk))
+		}
+	}
+	return info
+}
+
+func (h *Handler) GetSchema(w http.ResponseWriter, r *http.Request) {
+	acl := accessOf(r)
+	tables := map[string]tableInfo{}
+	for name, t := range h.schema() {
+		if acl.visible(name) {
+			tables[name] = describeTable(acl.schemaView(t))
+		}
+	}
+	h.ok(w, map[string]interface{}{"tables": tables})
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetSchema(t *testing.T) {
+	db := prepareBatch(t)
+	defer db.Close()
+	ts := httptest.NewServer(newBatchHandler(t, db))
+	defer ts.Close()
+
+	resp, err := client.Get(ts.URL + "/_schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Response struct {
+			Tables map[string]json.RawMessage
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"columns": []interface{}{
+			map[string]interface{}{"name": "body", "type": "string", "raw_type": "TEXT", "nullable": false, "size": float64(65535)},
+			map[string]interface{}{"name": "id", "type": "int", "raw_type": "INTEGER", "nullable": false, "auto_increment": true},
+			map[string]interface{}{"name": "note_id", "type": "int", "raw_type": "INTEGER", "nullable": false},
+		},
+		"primary_key": []interface{}{"id"},
+		"foreign_keys": []interface{}{
+			map[string]interface{}{"column": "note_id", "ref_table": "notes", "ref_column": "id"},
+		},
+	}
+	var got interface{}
+	json.Unmarshal(result.Response.Tables["comments"], &got)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("bad comments schema\nGot : %#v\nWant: %#v", got, expected)
+	}
+	var notes struct{ Version string }
+	json.Unmarshal(result.Response.Tables["notes"], &notes)
+	if notes.Version != "version" {
+		t.Errorf("notes must have version column, got %q", notes.Version)
+	}
+}
+
+func TestSchemaReload(t *testing.T) {
+	db := prepareBatch(t)
+	defer db.Close()
+	h, err := NewHandler(db, SQLite{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	for _, q := range []string{
+		`ALTER TABLE notes ADD COLUMN tag varchar(20) DEFAULT NULL`,
+		`DROP TABLE comments`,
+		`CREATE TABLE tags (name varchar(20) NOT NULL PRIMARY KEY)`,
+		`INSERT INTO tags (name) VALUES ('go')`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runCases(t, ts, db, []Case{
+		// до перечитывания схема старая
+		Case{
+			Path:   "/tags",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown table",
+			},
+		},
+		Case{
+			Path:   "/_schema/reload",
+			Method: http.MethodPost,
+			Result: CR{
+				"response": CR{
+					"added":   []string{"tags"},
+					"removed": []string{"comments"},
+					"changed": []string{"notes"},
+				},
+			},
+		},
+		Case{
+			Path: "/tags",
+			Result: CR{
+				"response": CR{
+					"records": []CR{
+						CR{"name": "go"},
+					},
+				},
+			},
+		},
+		Case{
+			Path: "/notes/1",
+			Result: CR{
+				"response": CR{
+					"record": CR{"id": 1, "title": "first", "version": 1, "tag": nil},
+				},
+			},
+		},
+		Case{
+			Path:   "/_schema/reload",
+			Method: http.MethodPost,
+			Result: CR{
+				"response": CR{
+					"added":   []string{},
+					"removed": []string{},
+					"changed": []string{},
+				},
+			},
+		},
+	})
+}
+
+// TestReloadConcurrent имеет смысл с -race: запросы идут, пока схема подменяется
+func TestReloadConcurrent(t *testing.T) {
+	db := prepareBatch(t)
+	defer db.Close()
+	h, err := NewHandler(db, SQLite{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Watch(ctx, time.Millisecond)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				resp, err := client.Get(ts.URL + "/notes/1")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("expected 200, got %d", resp.StatusCode)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWatchError(t *testing.T) {
+	db := prepareBatch(t)
+	h, err := NewHandler(db, SQLite{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan string, 1)
+	h.ErrorLog = func(format string, args ...interface{}) {
+		select {
+		case errs <- format:
+		default:
+		}
+	}
+	db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go h.Watch(ctx, time.Millisecond)
+	select {
+	case <-errs:
+	case <-ctx.Done():
+		t.Fatal("expected reload error")
+	}
+	// старая схема осталась
+	if _, ok := h.schema()["notes"]; !ok {
+		t.Error("schema must survive failed reload")
+	}
+}
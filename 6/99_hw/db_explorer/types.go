@@ -0,0 +1,561 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ColumnType - во что превращается колонка в json и что в неё можно записать
+type ColumnType int
+
+const (
+	TypeString ColumnType = iota
+	TypeInt
+	TypeFloat
+	// TypeDecimal отдаётся json-числом без потери точности, принимается числом или строкой
+	TypeDecimal
+	// TypeBool - tinyint(1), bool и bit(1)
+	TypeBool
+	// TypeDate - "2006-01-02"
+	TypeDate
+	// TypeDateTime - datetime и timestamp, отдаются в RFC 3339, хранятся в UTC
+	TypeDateTime
+	// TypeTime - time, "15:04:05", может быть отрицательным и больше суток
+	TypeTime
+	TypeYear
+	// TypeJSON - любое json-значение как есть
+	TypeJSON
+	// TypeBinary - blob, binary, varbinary - строка в base64
+	TypeBinary
+	TypeEnum
+	// TypeSet отдаётся массивом строк, принимается массивом или строкой через запятую
+	TypeSet
+)
+
+var typeNames = map[ColumnType]string{
+	TypeString:   "string",
+	TypeInt:      "int",
+	TypeFloat:    "float",
+	TypeDecimal:  "decimal",
+	TypeBool:     "bool",
+	TypeDate:     "date",
+	TypeDateTime: "datetime",
+	TypeTime:     "time",
+	TypeYear:     "year",
+	TypeJSON:     "json",
+	TypeBinary:   "binary",
+	TypeEnum:     "enum",
+	TypeSet:      "set",
+}
+
+func (t ColumnType) String() string {
+	return typeNames[t]
+}
+
+func (t ColumnType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+const (
+	dateLayout     = "2006-01-02"
+	dateTimeLayout = "2006-01-02 15:04:05.999999"
+)
+
+var (
+	intRe     = regexp.MustCompile(`\((\d+)\)`)
+	decimalRe = regexp.MustCompile(`\((\d+),\s*(\d+)\)`)
+	timeRe    = regexp.MustCompile(`^-?\d{1,3}:\d{2}:\d{2}(\.\d{1,6})?$`)
+)
+
+// intBits - сколько бит в целых типах mysql
+var intBits = map[string]int{
+	"tinyint":   8,
+	"smallint":  16,
+	"mediumint": 24,
+	"int":       32,
+	"integer":   32,
+	"bigint":    64,
+}
+
+// textBytes - предел в байтах для text и blob без явной длины
+var textBytes = map[string]int{
+	"tinytext":   255,
+	"text":       65535,
+	"mediumtext": 16777215,
+	"tinyblob":   255,
+	"blob":       65535,
+	"mediumblob": 16777215,
+}
+
+// parseMySQLType заполняет тип колонки по Type из SHOW FULL COLUMNS:
+// int(10) unsigned, tinyint(1), decimal(10,2), varchar(255), enum('a','b') и т.п.
+func parseMySQLType(col *Column, raw string) {
+	col.RawType = raw
+	lower := strings.ToLower(raw)
+	base := lower
+	if i := strings.IndexAny(base, "( "); i >= 0 {
+		base = base[:i]
+	}
+	col.Unsigned = strings.Contains(lower, "unsigned")
+
+	switch {
+	case base == "tinyint" && strings.HasPrefix(lower, "tinyint(1)"), base == "bool", base == "boolean", lower == "bit(1)":
+		col.Type = TypeBool
+	case intBits[base] > 0:
+		col.Type = TypeInt
+		col.Bits = intBits[base]
+	case base == "bit":
+		col.Type, col.Unsigned, col.Bits = TypeInt, true, 64
+		if m := intRe.FindStringSubmatch(lower); m != nil {
+			col.Bits, _ = strconv.Atoi(m[1])
+		}
+	case base == "float", base == "double", base == "real":
+		col.Type = TypeFloat
+	case base == "decimal", base == "numeric", base == "dec", base == "fixed":
+		col.Type = TypeDecimal
+		// decimal без параметров - это decimal(10,0)
+		col.Precision, col.Scale = 10, 0
+		if m := decimalRe.FindStringSubmatch(lower); m != nil {
+			col.Precision, _ = strconv.Atoi(m[1])
+			col.Scale, _ = strconv.Atoi(m[2])
+		} else if m := intRe.FindStringSubmatch(lower); m != nil {
+			col.Precision, _ = strconv.Atoi(m[1])
+		}
+	case base == "date":
+		col.Type = TypeDate
+	case base == "datetime", base == "timestamp":
+		col.Type = TypeDateTime
+	case base == "time":
+		col.Type = TypeTime
+	case base == "year":
+		col.Type = TypeYear
+	case base == "json":
+		col.Type = TypeJSON
+	case base == "binary", base == "varbinary":
+		col.Type, col.LenBytes = TypeBinary, true
+		col.Size = parenSize(lower)
+	case strings.HasSuffix(base, "blob"):
+		col.Type, col.LenBytes = TypeBinary, true
+		col.Size = textBytes[base]
+	case base == "enum", base == "set":
+		col.Type = TypeEnum
+		if base == "set" {
+			col.Type = TypeSet
+		}
+		col.Values = parseEnumValues(raw[len(base):])
+	case base == "char", base == "varchar":
+		col.Type = TypeString
+		col.Size = parenSize(lower)
+	case strings.HasSuffix(base, "text"):
+		col.Type, col.LenBytes = TypeString, true
+		col.Size = textBytes[base]
+	default:
+		col.Type = TypeString
+	}
+}
+
+func parenSize(lower string) int {
+	if m := intRe.FindStringSubmatch(lower); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return n
+	}
+	return 0
+}
+
+// parseEnumValues - ('a','b”c') -> a, b'c
+func parseEnumValues(s string) []string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "(")
+	s = strings.TrimSuffix(s, ")")
+	values := []string{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\'' {
+			continue
+		}
+		b := &strings.Builder{}
+		for i++; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					b.WriteByte('\'')
+					i++
+					continue
+				}
+				break
+			}
+			b.WriteByte(s[i])
+		}
+		values = append(values, b.String())
+	}
+	return values
+}
+
+func invalidType(col Column) error {
+	return fmt.Errorf("field %s have invalid type", col.Name)
+}
+
+// zeroValue - что пишется в NOT NULL колонку, если поле не пришло
+func zeroValue(col Column) interface{} {
+	switch col.Type {
+	case TypeInt, TypeFloat, TypeDecimal, TypeBool, TypeYear:
+		return 0
+	case TypeEnum:
+		// так же делает сам mysql - первое значение из списка
+		if len(col.Values) > 0 {
+			return col.Values[0]
+		}
+	case TypeBinary:
+		return []byte{}
+	case TypeJSON:
+		return "null"
+	}
+	return ""
+}
+
+// coerce проверяет значение из json или query и приводит его к тому, что уйдёт аргументом в запрос
+func coerce(val interface{}, col Column, missing bool) (interface{}, error) {
+	if val == nil {
+		if missing {
+			if col.Nullable {
+				return nil, nil
+			}
+			return zeroValue(col), nil
+		}
+		if !col.Nullable {
+			return nil, invalidType(col)
+		}
+		return nil, nil
+	}
+	// из query всё приходит строками, пустая строка в nullable не строковой колонке - это null
+	if s, ok := val.(string); ok && s == "" && col.Nullable && col.Type != TypeString && col.Type != TypeEnum && col.Type != TypeSet {
+		return nil, nil
+	}
+
+	switch col.Type {
+	case TypeInt, TypeYear:
+		return coerceInt(val, col)
+	case TypeFloat:
+		f, ok := numberValue(val)
+		if !ok {
+			return nil, invalidType(col)
+		}
+		if col.Unsigned && f < 0 {
+			return nil, fmt.Errorf("field %s out of range", col.Name)
+		}
+		return f, nil
+	case TypeDecimal:
+		return coerceDecimal(val, col)
+	case TypeBool:
+		switch v := val.(type) {
+		case bool:
+			if v {
+				return 1, nil
+			}
+			return 0, nil
+		case float64:
+			if v == 0 || v == 1 {
+				return int(v), nil
+			}
+		case string:
+			switch strings.ToLower(v) {
+			case "1", "true":
+				return 1, nil
+			case "0", "false":
+				return 0, nil
+			}
+		}
+		return nil, invalidType(col)
+	case TypeDate:
+		s, ok := val.(string)
+		if !ok {
+			return nil, invalidType(col)
+		}
+		if _, err := time.Parse(dateLayout, s); err != nil {
+			return nil, invalidType(col)
+		}
+		return s, nil
+	case TypeDateTime:
+		s, ok := val.(string)
+		if !ok {
+			return nil, invalidType(col)
+		}
+		t, err := parseDateTime(s)
+		if err != nil {
+			return nil, invalidType(col)
+		}
+		return t.UTC().Format(dateTimeLayout), nil
+	case TypeTime:
+		s, ok := val.(string)
+		if !ok || !timeRe.MatchString(s) {
+			return nil, invalidType(col)
+		}
+		return s, nil
+	case TypeJSON:
+		data, err := json.Marshal(val)
+		if err != nil {
+			return nil, invalidType(col)
+		}
+		return string(data), nil
+	case TypeBinary:
+		s, ok := val.(string)
+		if !ok {
+			return nil, invalidType(col)
+		}
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, invalidType(col)
+		}
+		if col.Size > 0 && len(data) > col.Size {
+			return nil, fmt.Errorf("field %s is too long", col.Name)
+		}
+		return data, nil
+	case TypeEnum:
+		s, ok := val.(string)
+		if !ok {
+			return nil, invalidType(col)
+		}
+		if !contains(col.Values, s) {
+			return nil, fmt.Errorf("field %s must be one of: %s", col.Name, strings.Join(col.Values, ", "))
+		}
+		return s, nil
+	case TypeSet:
+		return coerceSet(val, col)
+	}
+
+	s, ok := val.(string)
+	if !ok {
+		return nil, invalidType(col)
+	}
+	if col.Size > 0 {
+		n := utf8.RuneCountInString(s)
+		if col.LenBytes {
+			n = len(s)
+		}
+		if n > col.Size {
+			return nil, fmt.Errorf("field %s is too long", col.Name)
+		}
+	}
+	return s, nil
+}
+
+// numberValue - число из json (float64) или из query (строка)
+func numberValue(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func coerceInt(val interface{}, col Column) (interface{}, error) {
+	var n *big.Int
+	switch v := val.(type) {
+	case float64:
+		if v != math.Trunc(v) {
+			return nil, invalidType(col)
+		}
+		n, _ = big.NewFloat(v).Int(nil)
+	case int:
+		n = big.NewInt(int64(v))
+	case string:
+		var ok bool
+		if n, ok = new(big.Int).SetString(v, 10); !ok {
+			return nil, invalidType(col)
+		}
+	default:
+		return nil, invalidType(col)
+	}
+
+	if col.Type == TypeYear {
+		if y := n.Int64(); n.IsInt64() && (y == 0 || (y >= 1901 && y <= 2155)) {
+			return int(y), nil
+		}
+		return nil, fmt.Errorf("field %s out of range", col.Name)
+	}
+
+	bits := col.Bits
+	if bits == 0 {
+		bits = 64
+	}
+	min, max := new(big.Int), new(big.Int)
+	if col.Unsigned {
+		max.Lsh(big.NewInt(1), uint(bits)).Sub(max, big.NewInt(1))
+	} else {
+		max.Lsh(big.NewInt(1), uint(bits-1)).Sub(max, big.NewInt(1))
+		min.Lsh(big.NewInt(1), uint(bits-1)).Neg(min)
+	}
+	if n.Cmp(min) < 0 || n.Cmp(max) > 0 {
+		return nil, fmt.Errorf("field %s out of range", col.Name)
+	}
+	if n.IsInt64() {
+		return int(n.Int64()), nil
+	}
+	return n.Uint64(), nil
+}
+
+var decimalValueRe = regexp.MustCompile(`^([+-]?)(\d*)(?:\.(\d*))?$`)
+
+// coerceDecimal - число уходит в базу строкой, чтобы не терять точность на float64
+func coerceDecimal(val interface{}, col Column) (interface{}, error) {
+	var s string
+	switch v := val.(type) {
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	default:
+		return nil, invalidType(col)
+	}
+	m := decimalValueRe.FindStringSubmatch(s)
+	if m == nil || m[2]+m[3] == "" {
+		return nil, invalidType(col)
+	}
+	if col.Unsigned && m[1] == "-" {
+		return nil, fmt.Errorf("field %s out of range", col.Name)
+	}
+	intDigits := strings.TrimLeft(m[2], "0")
+	frac := strings.TrimRight(m[3], "0")
+	// Precision 0 - numeric без ограничений, так бывает в postgres и sqlite
+	if col.Precision > 0 && (len(intDigits) > col.Precision-col.Scale || len(frac) > col.Scale) {
+		return nil, fmt.Errorf("field %s out of range", col.Name)
+	}
+	return s, nil
+}
+
+func coerceSet(val interface{}, col Column) (interface{}, error) {
+	var items []string
+	switch v := val.(type) {
+	case string:
+		if v != "" {
+			items = strings.Split(v, ",")
+		}
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, invalidType(col)
+			}
+			items = append(items, s)
+		}
+	default:
+		return nil, invalidType(col)
+	}
+	for _, item := range items {
+		if !contains(col.Values, item) {
+			return nil, fmt.Errorf("field %s must be a subset of: %s", col.Name, strings.Join(col.Values, ", "))
+		}
+	}
+	return strings.Join(items, ","), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDateTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(dateTimeLayout, s)
+}
+
+// decodeValue - значение из rows.Scan в то, что уйдёт в json. Драйвер отдаёт []byte в текстовом
+// протоколе и int64/float64/time.Time в бинарном (запросы с аргументами), тут разбираются оба
+func decodeValue(col Column, val interface{}) (interface{}, error) {
+	if val == nil {
+		return nil, nil
+	}
+	// bit(n) приходит байтами big-endian, его разбираем как есть
+	b, isBytes := val.([]byte)
+	if isBytes && col.Type != TypeBinary && !strings.HasPrefix(col.RawType, "bit") {
+		val = string(b)
+	}
+
+	switch col.Type {
+	case TypeInt, TypeYear:
+		switch v := val.(type) {
+		case string:
+			if col.Unsigned {
+				return strconv.ParseUint(v, 10, 64)
+			}
+			return strconv.ParseInt(v, 10, 64)
+		case []byte:
+			var n uint64
+			for _, c := range v {
+				n = n<<8 | uint64(c)
+			}
+			return n, nil
+		}
+	case TypeFloat:
+		if s, ok := val.(string); ok {
+			return strconv.ParseFloat(s, 64)
+		}
+	case TypeDecimal:
+		switch v := val.(type) {
+		case string:
+			return json.Number(v), nil
+		case float64:
+			return json.Number(strconv.FormatFloat(v, 'f', -1, 64)), nil
+		case int64:
+			return json.Number(strconv.FormatInt(v, 10)), nil
+		}
+	case TypeBool:
+		switch v := val.(type) {
+		case string:
+			return v != "0" && v != "", nil
+		case []byte:
+			return len(v) > 0 && v[len(v)-1] != 0, nil
+		case int64:
+			return v != 0, nil
+		case bool:
+			return v, nil
+		}
+	case TypeDate:
+		if t, ok := val.(time.Time); ok {
+			return t.Format(dateLayout), nil
+		}
+	case TypeDateTime:
+		switch v := val.(type) {
+		case time.Time:
+			return v.UTC().Format(time.RFC3339Nano), nil
+		case string:
+			// нулевая дата mysql не время, отдаём как есть
+			t, err := time.Parse(dateTimeLayout, v)
+			if err != nil {
+				return v, nil
+			}
+			return t.Format(time.RFC3339Nano), nil
+		}
+	case TypeJSON:
+		if s, ok := val.(string); ok && json.Valid([]byte(s)) {
+			return json.RawMessage(s), nil
+		}
+	case TypeSet:
+		if s, ok := val.(string); ok {
+			if s == "" {
+				return []string{}, nil
+			}
+			return strings.Split(s, ","), nil
+		}
+	}
+	return val, nil
+}
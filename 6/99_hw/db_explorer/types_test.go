@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mysqlColumn(name, raw string, nullable bool) Column {
+	col := Column{Name: name, Nullable: nullable}
+	parseMySQLType(&col, raw)
+	return col
+}
+
+func TestParseMySQLType(t *testing.T) {
+	cases := []struct {
+		Raw      string
+		Expected Column
+	}{
+		{"int(11)", Column{Type: TypeInt, Bits: 32}},
+		{"int(10) unsigned", Column{Type: TypeInt, Bits: 32, Unsigned: true}},
+		{"bigint(20) unsigned zerofill", Column{Type: TypeInt, Bits: 64, Unsigned: true}},
+		{"tinyint(4)", Column{Type: TypeInt, Bits: 8}},
+		{"tinyint(1)", Column{Type: TypeBool}},
+		{"bit(1)", Column{Type: TypeBool}},
+		{"bit(12)", Column{Type: TypeInt, Bits: 12, Unsigned: true}},
+		{"double", Column{Type: TypeFloat}},
+		{"float unsigned", Column{Type: TypeFloat, Unsigned: true}},
+		{"decimal(10,2)", Column{Type: TypeDecimal, Precision: 10, Scale: 2}},
+		{"decimal(5)", Column{Type: TypeDecimal, Precision: 5}},
+		{"decimal", Column{Type: TypeDecimal, Precision: 10}},
+		{"varchar(255)", Column{Type: TypeString, Size: 255}},
+		{"char(2)", Column{Type: TypeString, Size: 2}},
+		{"text", Column{Type: TypeString, Size: 65535, LenBytes: true}},
+		{"longtext", Column{Type: TypeString, LenBytes: true}},
+		{"varbinary(16)", Column{Type: TypeBinary, Size: 16, LenBytes: true}},
+		{"blob", Column{Type: TypeBinary, Size: 65535, LenBytes: true}},
+		{"date", Column{Type: TypeDate}},
+		{"datetime(3)", Column{Type: TypeDateTime}},
+		{"timestamp", Column{Type: TypeDateTime}},
+		{"time", Column{Type: TypeTime}},
+		{"year(4)", Column{Type: TypeYear}},
+		{"json", Column{Type: TypeJSON}},
+		{"enum('new','it''s done')", Column{Type: TypeEnum, Values: []string{"new", "it's done"}}},
+		{"set('a','b','c')", Column{Type: TypeSet, Values: []string{"a", "b", "c"}}},
+	}
+	for _, item := range cases {
+		col := Column{}
+		parseMySQLType(&col, item.Raw)
+		item.Expected.RawType = item.Raw
+		if !reflect.DeepEqual(col, item.Expected) {
+			t.Errorf("[%s] expected %+v, got %+v", item.Raw, item.Expected, col)
+		}
+	}
+}
+
+func TestCoerce(t *testing.T) {
+	cases := []struct {
+		Raw      string
+		Nullable bool
+		Value    interface{}
+		Missing  bool
+		Expected interface{}
+		Error    string
+	}{
+		{Raw: "int(11)", Value: float64(42), Expected: 42},
+		{Raw: "int(11)", Value: "42", Expected: 42},
+		{Raw: "int(11)", Value: 1.5, Error: "field f have invalid type"},
+		{Raw: "int(11)", Value: float64(1 << 31), Error: "field f out of range"},
+		{Raw: "tinyint(3) unsigned", Value: float64(255), Expected: 255},
+		{Raw: "tinyint(3) unsigned", Value: float64(-1), Error: "field f out of range"},
+		{Raw: "bigint(20) unsigned", Value: "18446744073709551615", Expected: uint64(18446744073709551615)},
+		{Raw: "bigint(20)", Value: "9223372036854775808", Error: "field f out of range"},
+		{Raw: "int(11)", Value: true, Error: "field f have invalid type"},
+		{Raw: "int(11)", Missing: true, Expected: 0},
+		{Raw: "int(11)", Nullable: true, Missing: true, Expected: nil},
+		{Raw: "int(11)", Nullable: true, Value: "", Expected: nil},
+		{Raw: "int(11)", Value: nil, Error: "field f have invalid type"},
+		{Raw: "double", Value: 1.5, Expected: 1.5},
+		{Raw: "double", Value: "x", Error: "field f have invalid type"},
+		{Raw: "double unsigned", Value: -1.5, Error: "field f out of range"},
+		{Raw: "decimal(5,2)", Value: "123.45", Expected: "123.45"},
+		{Raw: "decimal(5,2)", Value: 0.1, Expected: "0.1"},
+		{Raw: "decimal(5,2)", Value: "1234.5", Error: "field f out of range"},
+		{Raw: "decimal(5,2)", Value: "1.234", Error: "field f out of range"},
+		{Raw: "decimal(5,2)", Value: "1.230", Expected: "1.230"},
+		{Raw: "decimal(5,2) unsigned", Value: "-1", Error: "field f out of range"},
+		{Raw: "decimal(5,2)", Value: "1e3", Error: "field f have invalid type"},
+		{Raw: "tinyint(1)", Value: true, Expected: 1},
+		{Raw: "tinyint(1)", Value: "false", Expected: 0},
+		{Raw: "tinyint(1)", Value: float64(2), Error: "field f have invalid type"},
+		{Raw: "date", Value: "2024-02-29", Expected: "2024-02-29"},
+		{Raw: "date", Value: "2023-02-29", Error: "field f have invalid type"},
+		{Raw: "datetime", Value: "2024-01-02T15:04:05+03:00", Expected: "2024-01-02 12:04:05"},
+		{Raw: "datetime", Value: "2024-01-02 15:04:05.25", Expected: "2024-01-02 15:04:05.25"},
+		{Raw: "datetime", Value: "yesterday", Error: "field f have invalid type"},
+		{Raw: "time", Value: "-838:59:59", Expected: "-838:59:59"},
+		{Raw: "time", Value: "12:60", Error: "field f have invalid type"},
+		{Raw: "year", Value: float64(2024), Expected: 2024},
+		{Raw: "year", Value: float64(1800), Error: "field f out of range"},
+		{Raw: "json", Value: map[string]interface{}{"a": []interface{}{1.0}}, Expected: `{"a":[1]}`},
+		{Raw: "json", Missing: true, Expected: "null"},
+		{Raw: "varbinary(4)", Value: "AQID", Expected: []byte{1, 2, 3}},
+		{Raw: "varbinary(2)", Value: "AQID", Error: "field f is too long"},
+		{Raw: "blob", Value: "not base64!", Error: "field f have invalid type"},
+		{Raw: "enum('new','done')", Value: "done", Expected: "done"},
+		{Raw: "enum('new','done')", Value: "lost", Error: "field f must be one of: new, done"},
+		{Raw: "enum('new','done')", Missing: true, Expected: "new"},
+		{Raw: "set('a','b','c')", Value: "a,c", Expected: "a,c"},
+		{Raw: "set('a','b','c')", Value: []interface{}{"b", "c"}, Expected: "b,c"},
+		{Raw: "set('a','b','c')", Value: []interface{}{"d"}, Error: "field f must be a subset of: a, b, c"},
+		{Raw: "set('a','b','c')", Value: []interface{}{1.0}, Error: "field f have invalid type"},
+		{Raw: "varchar(3)", Value: "абв", Expected: "абв"},
+		{Raw: "varchar(3)", Value: "abcd", Error: "field f is too long"},
+		{Raw: "tinytext", Value: string(make([]byte, 256)), Error: "field f is too long"},
+		{Raw: "varchar(3)", Value: 1.0, Error: "field f have invalid type"},
+	}
+	for i, item := range cases {
+		col := mysqlColumn("f", item.Raw, item.Nullable)
+		got, err := coerce(item.Value, col, item.Missing)
+		if item.Error != "" {
+			if err == nil || err.Error() != item.Error {
+				t.Errorf("[%d %s %v] expected error %q, got %v, %v", i, item.Raw, item.Value, item.Error, got, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, item.Expected) {
+			t.Errorf("[%d %s %v] expected %#v, got %#v, %v", i, item.Raw, item.Value, item.Expected, got, err)
+		}
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	cases := []struct {
+		Raw      string
+		Value    interface{}
+		Expected string
+	}{
+		{"int(11)", []byte("-42"), `-42`},
+		{"int(11)", int64(42), `42`},
+		{"bigint(20) unsigned", []byte("18446744073709551615"), `18446744073709551615`},
+		{"bit(12)", []byte{0x01, 0x02}, `258`},
+		{"double", []byte("1.5"), `1.5`},
+		{"decimal(20,2)", []byte("12345678901234567.89"), `12345678901234567.89`},
+		{"tinyint(1)", []byte("1"), `true`},
+		{"tinyint(1)", int64(0), `false`},
+		{"bit(1)", []byte{0}, `false`},
+		{"bit(1)", []byte{1}, `true`},
+		{"date", []byte("2024-01-02"), `"2024-01-02"`},
+		{"date", ts, `"2024-01-02"`},
+		{"datetime", []byte("2024-01-02 15:04:05"), `"2024-01-02T15:04:05Z"`},
+		{"datetime", ts, `"2024-01-02T15:04:05Z"`},
+		{"datetime", []byte("0000-00-00 00:00:00"), `"0000-00-00 00:00:00"`},
+		{"json", []byte(`{"a": [1]}`), `{"a":[1]}`},
+		{"varbinary(4)", []byte{1, 2, 3}, `"AQID"`},
+		{"set('a','b')", []byte("a,b"), `["a","b"]`},
+		{"set('a','b')", []byte(""), `[]`},
+		{"enum('a','b')", []byte("b"), `"b"`},
+		{"varchar(10)", []byte("text"), `"text"`},
+		{"varchar(10)", nil, `null`},
+	}
+	for _, item := range cases {
+		got, err := decodeValue(mysqlColumn("f", item.Raw, true), item.Value)
+		if err != nil {
+			t.Errorf("[%s] unexpected error %v", item.Raw, err)
+			continue
+		}
+		data, _ := json.Marshal(got)
+		if string(data) != item.Expected {
+			t.Errorf("[%s %v] expected %s, got %s", item.Raw, item.Value, item.Expected, data)
+		}
+	}
+}
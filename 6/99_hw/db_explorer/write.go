@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// запись строк. Одни и те же insertRow/updateRow/deleteRow работают и на h.db
+// для PUT/POST/DELETE, и внутри транзакции для POST /_batch.
+//
+// Оптимистичная блокировка включается для таблицы через Handler.Versions: каждый update
+// увеличивает колонку версии на 1, а GET /$table/$id отдаёт её в ETag. Запрос с If-Match: "3"
+// (или "if_match": 3 в batch) меняет запись, только если версия всё ещё 3, иначе 412
+
+// StatusError - ошибка записи со своим http-статусом: 404, 409, 412
+type StatusError struct {
+	Status int
+	Msg    string
+}
+
+func (e *StatusError) Error() string {
+	return e.Msg
+}
+
+var errVersionMismatch = &StatusError{http.StatusPreconditionFailed, "version mismatch"}
+
+// errorStatus - статус для ошибки записи, fallback - для ошибок самой базы
+func errorStatus(err error, fallback int) int {
+	switch e := err.(type) {
+	case *ParamError:
+		return http.StatusBadRequest
+	case *StatusError:
+		return e.Status
+	}
+	return fallback
+}
+
+func (h *Handler) failErr(w http.ResponseWriter, fallback int, err error) {
+	h.fail(w, errorStatus(err, fallback), err.Error())
+}
+
+// dbError переводит нарушение внешнего ключа в 409 с текстом conflict
+func (h *Handler) dbError(err error, conflict string) error {
+	if h.d.IsForeignKeyError(err) {
+		return &StatusError{http.StatusConflict, conflict}
+	}
+	return err
+}
+
+// ifMatch - версия из заголовка If-Match, nil - заголовка нет или он *
+func ifMatch(r *http.Request) interface{} {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	v = strings.Trim(strings.TrimPrefix(v, "W/"), `"`)
+	if v == "" || v == "*" {
+		return nil
+	}
+	return v
+}
+
+// versionValue проверяет версию из If-Match и приводит её к типу колонки
+func versionValue(t Table, match interface{}) (interface{}, error) {
+	if match == nil {
+		return nil, nil
+	}
+	if t.Version == "" {
+		return nil, paramErrorf("table %s has no version column", t.Name)
+	}
+	v, err := coerce(match, t.Columns[t.Version], false)
+	if err != nil || v == nil {
+		return nil, paramErrorf("bad version %v", match)
+	}
+	return v, nil
+}
+
+// insertRow вставляет запись и возвращает её ключ: сгенерированный базой или тот, что прислали
+func (h *Handler) insertRow(db queryer, t Table, values map[string]interface{}) (map[string]interface{}, error) {
+	cols, args, resp, err := insertValues(t, values)
+	if err != nil {
+		return nil, err
+	}
+	id, err := h.d.Insert(db, t, cols, args)
+	if err != nil {
+		return nil, h.dbError(err, errMissingRef)
+	}
+	if auto := t.autoKey(); auto != "" {
+		resp[auto] = id
+	}
+	return resp, nil
+}
+
+// insertValues приводит values к типам колонок. Колонки в ответе - всегда все колонки t,
+// кроме генерируемых базой, в одном и том же порядке, key - присланные значения ключа
+func insertValues(t Table, values map[string]interface{}) (cols []string, args []interface{}, key map[string]interface{}, err error) {
+	key = map[string]interface{}{}
+	for _, name := range colNames(t) {
+		col := t.Columns[name]
+		if col.AutoIncrement {
+			continue
+		}
+		raw, exists := values[name]
+		if !exists && t.isKey(name) {
+			return nil, nil, nil, paramErrorf("field %s is required", name)
+		}
+		if !exists && name == t.Version {
+			raw, exists = 1, true
+		}
+		cv, err := coerce(raw, col, !exists)
+		if err != nil {
+			return nil, nil, nil, &ParamError{err.Error()}
+		}
+		cols = append(cols, name)
+		args = append(args, cv)
+		if t.isKey(name) {
+			key[name] = cv
+		}
+	}
+	return cols, args, key, nil
+}
+
+// updateRow меняет колонки из values у записи с ключом key, match - версия из If-Match
+func (h *Handler) updateRow(db queryer, t Table, key []interface{}, values map[string]interface{}, match interface{}) (int64, error) {
+	version, err := versionValue(t, match)
+	if err != nil {
+		return 0, err
+	}
+	// ключ и версию руками менять нельзя
+	for _, pk := range t.PriKeys {
+		if _, ok := values[pk]; ok {
+			return 0, paramErrorf("field %s have invalid type", pk)
+		}
+	}
+	if _, ok := values[t.Version]; ok && t.Version != "" {
+		return 0, paramErrorf("field %s have invalid type", t.Version)
+	}
+
+	b := newBuilder(h.d)
+	b.WriteString("UPDATE " + b.quote(t.Name) + " SET ")
+	set := []string{}
+	for _, colName := range colNames(t) {
+		raw, ok := values[colName]
+		if !ok {
+			continue
+		}
+		cv, err := coerce(raw, t.Columns[colName], false)
+		if err != nil {
+			return 0, &ParamError{err.Error()}
+		}
+		set = append(set, b.quote(colName)+" = "+b.arg(cv))
+	}
+	if t.Version != "" {
+		set = append(set, b.quote(t.Version)+" = "+b.quote(t.Version)+" + 1")
+	}
+	b.WriteString(strings.Join(set, ", "))
+	return h.execWhere(db, b, t, key, version, errMissingRef)
+}
+
+// deleteRow удаляет запись с ключом key, match - версия из If-Match
+func (h *Handler) deleteRow(db queryer, t Table, key []interface{}, match interface{}) (int64, error) {
+	version, err := versionValue(t, match)
+	if err != nil {
+		return 0, err
+	}
+	b := newBuilder(h.d)
+	b.WriteString("DELETE FROM " + b.quote(t.Name))
+	return h.execWhere(db, b, t, key, version, errReferenced)
+}
+
+// execWhere дописывает условие на ключ и версию и выполняет запрос
+func (h *Handler) execWhere(db queryer, b *sqlBuilder, t Table, key []interface{}, version interface{}, conflict string) (int64, error) {
+	filters := keyFilters(t, key)
+	if version != nil {
+		filters = append(filters, Where{Name: t.Version, Op: "eq", Value: version})
+	}
+	b.WriteString(" WHERE ")
+	b.where(filters)
+	res, err := db.Exec(b.String(), b.args...)
+	if err != nil {
+		return 0, h.dbError(err, conflict)
+	}
+	c, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	// по If-Match записи без нужной версии и отсутствующие записи не различаем, как и в RFC 7232
+	if c == 0 && version != nil {
+		return 0, errVersionMismatch
+	}
+	return c, nil
+}
+
+// etag - версия записи для заголовка ETag
+func etag(t Table, row map[string]interface{}) string {
+	return fmt.Sprintf("%q", fmt.Sprint(row[t.Version]))
+}
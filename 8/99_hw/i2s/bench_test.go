@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+type benchUser struct {
+	ID     int               `json:"id"`
+	Login  string            `json:"login"`
+	Active bool              `json:"active"`
+	Score  float64           `json:"score"`
+	Tags   []string          `json:"tags"`
+	Meta   map[string]string `json:"meta,omitempty"`
+	Lead   *Simple           `json:"lead"`
+}
+
+type benchPage struct {
+	Users []benchUser `json:"users"`
+	Total int         `json:"total"`
+}
+
+func benchData() *benchPage {
+	page := &benchPage{Total: 100}
+	for i := 0; i < 100; i++ {
+		page.Users = append(page.Users, benchUser{
+			ID:     i,
+			Login:  "user" + strconv.Itoa(i),
+			Active: i%2 == 0,
+			Score:  float64(i) / 3,
+			Tags:   []string{"go", "web"},
+			Meta:   map[string]string{"city": "msk"},
+			Lead:   &Simple{ID: 42, Username: "rvasily", Active: true},
+		})
+	}
+	return page
+}
+
+func BenchmarkI2S(b *testing.B) {
+	data, _ := s2i(benchData())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out := &benchPage{}
+		if err := i2s(data, out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONUnmarshal(b *testing.B) {
+	raw, _ := json.Marshal(benchData())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out := &benchPage{}
+		if err := json.Unmarshal(raw, out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkS2I(b *testing.B) {
+	in := benchData()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s2i(in); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// полный круг: структура -> interface{} -> структура, против того же через json
+func BenchmarkRoundTripI2S(b *testing.B) {
+	in := benchData()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, err := s2i(in)
+		if err != nil {
+			b.Fatal(err)
+		}
+		out := &benchPage{}
+		if err := i2s(data, out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRoundTripJSON(b *testing.B) {
+	in := benchData()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			b.Fatal(err)
+		}
+		out := &benchPage{}
+		if err := json.Unmarshal(raw, out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
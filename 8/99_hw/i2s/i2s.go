@@ -1,7 +1,508 @@
 package main
 
-/*
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// i2s - interface to struct: заполняет out из того, что получается после json.Unmarshal в interface{}:
+// map[string]interface{}, []interface{}, float64, string, bool и nil.
+// s2i делает обратное, так что i2s(s2i(v)) даёт копию v.
+// Имена полей, теги и встроенные структуры - по тем же правилам, что в encoding/json
+
+// ErrNotPointer - out должен быть ненулевым указателем, иначе результат некуда записать
+var ErrNotPointer = errors.New("i2s: out must be a non-nil pointer")
+
+// TypeError - пришло значение не того типа: Users[3].Name: expected string, got float64
+type TypeError struct {
+	// Path - путь до значения, пустой для самого out
+	Path     string
+	Expected reflect.Type
+	// Got - тип пришедшего значения, nil если пришёл null
+	Got reflect.Type
+}
+
+func (e *TypeError) Error() string {
+	got := "null"
+	if e.Got != nil {
+		got = e.Got.String()
+	}
+	return withPath(e.Path, fmt.Sprintf("expected %s, got %s", e.Expected, got))
+}
+
+// ValueError - тип подходит, а значение нет: дробное число в int, переполнение
+type ValueError struct {
+	Path  string
+	Value interface{}
+	Type  reflect.Type
+}
+
+func (e *ValueError) Error() string {
+	return withPath(e.Path, fmt.Sprintf("value %v does not fit %s", e.Value, e.Type))
+}
+
+// UnsupportedTypeError - тип, который нельзя получить из json: каналы, функции, map с нестроковым ключом
+type UnsupportedTypeError struct {
+	Path string
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return withPath(e.Path, fmt.Sprintf("unsupported type %s", e.Type))
+}
+
+// UnknownFieldError - в данных есть ключ, которому нет поля, при Decoder.DisallowUnknownFields
+type UnknownFieldError struct {
+	Path  string
+	Field string
+}
+
+func (e *UnknownFieldError) Error() string {
+	return withPath(e.Path, fmt.Sprintf("unknown field %q", e.Field))
+}
+
+// HookError - ошибку вернул сам тип из UnmarshalI2S/MarshalI2S или UnmarshalText/MarshalText
+type HookError struct {
+	Path string
+	Type reflect.Type
+	Err  error
+}
+
+func (e *HookError) Error() string {
+	return withPath(e.Path, fmt.Sprintf("%s: %v", e.Type, e.Err))
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// I2SUnmarshaler - тип разбирает себя сам: enum из строки, время в своём формате и т.п.
+// Вызывается для всего, кроме null
+type I2SUnmarshaler interface {
+	UnmarshalI2S(data interface{}) error
+}
+
+// I2SMarshaler - обратное для s2i, результат должен состоять из того же, что выдаёт s2i
+type I2SMarshaler interface {
+	MarshalI2S() (interface{}, error)
+}
+
+// типы без своих хуков, но с encoding.TextUnmarshaler (time.Time, net.IP, ...) разбираются из строки
+var (
+	i2sUnmarshalerType  = reflect.TypeOf((*I2SUnmarshaler)(nil)).Elem()
+	i2sMarshalerType    = reflect.TypeOf((*I2SMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func withPath(path, msg string) string {
+	if path == "" {
+		return msg
+	}
+	return path + ": " + msg
+}
+
+// путь собирается только для ошибки, по дороге наверх: каждый уровень дописывает свой сегмент спереди.
+// Пока ошибок нет, строки путей не строятся вовсе
+type pathError interface {
+	error
+	prependPath(seg string)
+}
+
+func joinPath(seg, path string) string {
+	if path == "" || path[0] == '[' {
+		return seg + path
+	}
+	return seg + "." + path
+}
+
+func (e *TypeError) prependPath(seg string)            { e.Path = joinPath(seg, e.Path) }
+func (e *ValueError) prependPath(seg string)           { e.Path = joinPath(seg, e.Path) }
+func (e *UnsupportedTypeError) prependPath(seg string) { e.Path = joinPath(seg, e.Path) }
+func (e *UnknownFieldError) prependPath(seg string)    { e.Path = joinPath(seg, e.Path) }
+func (e *HookError) prependPath(seg string)            { e.Path = joinPath(seg, e.Path) }
+
+func withSeg(err error, seg string) error {
+	if pe, ok := err.(pathError); ok {
+		pe.prependPath(seg)
+	}
+	return err
+}
+
+func indexSeg(i int) string {
+	return "[" + strconv.Itoa(i) + "]"
+}
+
+func keySeg(key string) string {
+	return "[" + strconv.Quote(key) + "]"
+}
+
+// Decoder - i2s с настройками, нулевое значение ведёт себя как i2s
+type Decoder struct {
+	// DisallowUnknownFields - ключ, которому нет поля в структуре, это ошибка, а не пропуск
+	DisallowUnknownFields bool
+}
+
 func i2s(data interface{}, out interface{}) error {
-	// todo
+	return (&Decoder{}).Decode(data, out)
+}
+
+func (d *Decoder) Decode(data interface{}, out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return ErrNotPointer
+	}
+	return d.decode(planFor(v.Type().Elem()), data, v.Elem())
+}
+
+// decode пишет data в v по плану p, v всегда settable
+func (d *Decoder) decode(p *plan, data interface{}, v reflect.Value) error {
+	// null обнуляет то, что может быть nil, остальное оставляет как есть - так же делает encoding/json
+	if data == nil {
+		switch p.kind {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			v.Set(reflect.Zero(p.typ))
+		}
+		return nil
+	}
+
+	if p.unmarshal != hookNone && p.kind != reflect.Ptr && v.CanAddr() {
+		return callUnmarshal(p.unmarshal, data, v.Addr())
+	}
+	if p.unsupported {
+		return &UnsupportedTypeError{Type: p.typ}
+	}
+
+	switch p.kind {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(p.elem.typ))
+		}
+		return d.decode(p.elem, data, v.Elem())
+
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(data))
+		return nil
+
+	case reflect.Bool:
+		b, ok := data.(bool)
+		if !ok {
+			return typeError(p, data)
+		}
+		v.SetBool(b)
+		return nil
+
+	case reflect.String:
+		s, ok := data.(string)
+		if !ok {
+			return typeError(p, data)
+		}
+		v.SetString(s)
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, ok := number(data)
+		if !ok {
+			return typeError(p, data)
+		}
+		// json распаковывает все числа во float64, в int кладём только целые
+		n := int64(f)
+		if float64(n) != f || v.OverflowInt(n) {
+			return &ValueError{Value: data, Type: p.typ}
+		}
+		v.SetInt(n)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f, ok := number(data)
+		if !ok {
+			return typeError(p, data)
+		}
+		if f < 0 || f >= math.MaxUint64 {
+			return &ValueError{Value: data, Type: p.typ}
+		}
+		n := uint64(f)
+		if float64(n) != f || v.OverflowUint(n) {
+			return &ValueError{Value: data, Type: p.typ}
+		}
+		v.SetUint(n)
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		f, ok := number(data)
+		if !ok {
+			return typeError(p, data)
+		}
+		if v.OverflowFloat(f) {
+			return &ValueError{Value: data, Type: p.typ}
+		}
+		v.SetFloat(f)
+		return nil
+
+	case reflect.Struct:
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return typeError(p, data)
+		}
+		return d.decodeStruct(p, m, v)
+
+	case reflect.Slice:
+		list, ok := data.([]interface{})
+		if !ok {
+			return typeError(p, data)
+		}
+		res := reflect.MakeSlice(p.typ, len(list), len(list))
+		for i, item := range list {
+			if err := d.decode(p.elem, item, res.Index(i)); err != nil {
+				return withSeg(err, indexSeg(i))
+			}
+		}
+		v.Set(res)
+		return nil
+
+	case reflect.Array:
+		list, ok := data.([]interface{})
+		if !ok {
+			return typeError(p, data)
+		}
+		// как в encoding/json: лишние элементы отбрасываются, недостающие обнуляются
+		for i := 0; i < v.Len(); i++ {
+			if i >= len(list) {
+				v.Index(i).Set(reflect.Zero(p.elem.typ))
+				continue
+			}
+			if err := d.decode(p.elem, list[i], v.Index(i)); err != nil {
+				return withSeg(err, indexSeg(i))
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return typeError(p, data)
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(p.typ, len(m)))
+		}
+		keyType := p.typ.Key()
+		elem := reflect.New(p.elem.typ).Elem()
+		for key, item := range m {
+			elem.Set(reflect.Zero(p.elem.typ))
+			if err := d.decode(p.elem, item, elem); err != nil {
+				return withSeg(err, keySeg(key))
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(keyType), elem)
+		}
+		return nil
+	}
+
+	return &UnsupportedTypeError{Type: p.typ}
+}
+
+func (d *Decoder) decodeStruct(p *plan, m map[string]interface{}, v reflect.Value) error {
+	matched := 0
+	for i := range p.fields {
+		f := &p.fields[i]
+		item, ok := m[f.name]
+		if !ok {
+			continue
+		}
+		matched++
+		if err := d.decodeField(f, item, v); err != nil {
+			return err
+		}
+	}
+	if matched == len(m) {
+		return nil
+	}
+
+	// остались ключи без точного совпадения: как и encoding/json, сравниваем их без учёта регистра.
+	// Ключи сортируются, чтобы результат и ошибки не зависели от порядка обхода map
+	extra := make([]string, 0, len(m)-matched)
+	for key := range m {
+		if _, ok := p.byName[key]; !ok {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+
+	for _, key := range extra {
+		idx, ok := p.byFold[strings.ToLower(key)]
+		if !ok {
+			if d.DisallowUnknownFields {
+				return &UnknownFieldError{Field: key}
+			}
+			continue
+		}
+		f := &p.fields[idx]
+		if _, exact := m[f.name]; exact {
+			continue
+		}
+		if err := d.decodeField(f, m[key], v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) decodeField(f *planField, item interface{}, v reflect.Value) error {
+	fv, err := f.byIndex(v)
+	if err == nil {
+		err = d.decode(f.plan, item, fv)
+	}
+	if err != nil {
+		return withSeg(err, f.name)
+	}
+	return nil
+}
+
+func typeError(p *plan, data interface{}) error {
+	return &TypeError{Expected: p.typ, Got: reflect.TypeOf(data)}
+}
+
+// number - числа кроме float64 в data бывают, если её собрали руками, а не через json
+func number(data interface{}) (float64, bool) {
+	switch n := data.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	v := reflect.ValueOf(data)
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	}
+	return 0, false
+}
+
+// s2i - struct to interface: то же самое, что json.Marshal + json.Unmarshal в interface{},
+// только без json. Все числа становятся float64, nil-указатели, слайсы и map - nil
+func s2i(in interface{}) (interface{}, error) {
+	if in == nil {
+		return nil, nil
+	}
+	v := reflect.ValueOf(in)
+	return encode(planFor(v.Type()), v)
+}
+
+func encode(p *plan, v reflect.Value) (interface{}, error) {
+	switch {
+	case p.marshal != hookNone && !(p.kind == reflect.Ptr && v.IsNil()):
+		return callMarshal(p.marshal, v)
+	// методы с pointer receiver доступны, только если значение адресуемое
+	case p.marshalPtr != hookNone && v.CanAddr():
+		return callMarshal(p.marshalPtr, v.Addr())
+	case p.unsupported:
+		return nil, &UnsupportedTypeError{Type: p.typ}
+	}
+
+	switch p.kind {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return encode(p.elem, v.Elem())
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		elem := v.Elem()
+		return encode(planFor(elem.Type()), elem)
+
+	case reflect.Bool:
+		return v.Bool(), nil
+
+	case reflect.String:
+		return v.String(), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), nil
+
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+
+	case reflect.Struct:
+		res := make(map[string]interface{}, len(p.fields))
+		for i := range p.fields {
+			f := &p.fields[i]
+			fv, ok := f.byIndexNoAlloc(v)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			item, err := encode(f.plan, fv)
+			if err != nil {
+				return nil, withSeg(err, f.name)
+			}
+			res[f.name] = item
+		}
+		return res, nil
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		fallthrough
+	case reflect.Array:
+		res := make([]interface{}, v.Len())
+		for i := range res {
+			item, err := encode(p.elem, v.Index(i))
+			if err != nil {
+				return nil, withSeg(err, indexSeg(i))
+			}
+			res[i] = item
+		}
+		return res, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		res := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			item, err := encode(p.elem, iter.Value())
+			if err != nil {
+				return nil, withSeg(err, keySeg(key))
+			}
+			res[key] = item
+		}
+		return res, nil
+	}
+
+	return nil, &UnsupportedTypeError{Type: p.typ}
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
 }
-*/
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// plan - всё, что i2s и s2i узнают о типе через reflect: поля с тегами, хуки, типы элементов.
+// Строится один раз на reflect.Type и дальше берётся из кеша, так что на каждом вызове
+// остаётся только обход данных
+
+type hookKind uint8
+
+const (
+	hookNone hookKind = iota
+	hookI2S
+	hookText
+)
+
+type plan struct {
+	typ  reflect.Type
+	kind reflect.Kind
+
+	// unmarshal - хук у *T, вызывается для адресуемых значений
+	unmarshal hookKind
+	// marshal - хук у T, marshalPtr - у *T, если у T его нет
+	marshal    hookKind
+	marshalPtr hookKind
+
+	// unsupported - тип нельзя получить из json: каналы, функции, map с нестроковым ключом
+	unsupported bool
+
+	// elem - для указателей, слайсов, массивов и map
+	elem *plan
+
+	fields []planField
+	byName map[string]int
+	// byFold - имена в нижнем регистре, для ключей без точного совпадения
+	byFold map[string]int
+}
+
+type planField struct {
+	field
+	plan *plan
+}
+
+// plans - reflect.Type -> *plan
+var plans sync.Map
+
+func planFor(t reflect.Type) *plan {
+	if p, ok := plans.Load(t); ok {
+		return p.(*plan)
+	}
+	// рекурсивные типы ссылаются на свой план ещё до того, как он достроен,
+	// поэтому в общий кеш планы попадают только целиком
+	building := map[reflect.Type]*plan{}
+	buildPlan(t, building)
+	for bt, bp := range building {
+		plans.LoadOrStore(bt, bp)
+	}
+	p, _ := plans.Load(t)
+	return p.(*plan)
+}
+
+func buildPlan(t reflect.Type, building map[reflect.Type]*plan) *plan {
+	if p, ok := building[t]; ok {
+		return p
+	}
+	if p, ok := plans.Load(t); ok {
+		return p.(*plan)
+	}
+
+	p := &plan{typ: t, kind: t.Kind()}
+	building[t] = p
+
+	ptr := reflect.PtrTo(t)
+	p.unmarshal = hookOf(ptr, i2sUnmarshalerType, textUnmarshalerType)
+	p.marshal = hookOf(t, i2sMarshalerType, textMarshalerType)
+	if p.marshal == hookNone {
+		p.marshalPtr = hookOf(ptr, i2sMarshalerType, textMarshalerType)
+	}
+
+	switch p.kind {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		p.elem = buildPlan(t.Elem(), building)
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			p.unsupported = true
+			break
+		}
+		p.elem = buildPlan(t.Elem(), building)
+	case reflect.Interface:
+		p.unsupported = t.NumMethod() != 0
+	case reflect.Struct:
+		fields := typeFields(t)
+		p.fields = make([]planField, len(fields))
+		p.byName = make(map[string]int, len(fields))
+		p.byFold = make(map[string]int, len(fields))
+		for i, f := range fields {
+			p.fields[i] = planField{f, buildPlan(t.FieldByIndex(f.index).Type, building)}
+			p.byName[f.name] = i
+			folded := strings.ToLower(f.name)
+			if _, ok := p.byFold[folded]; !ok {
+				p.byFold[folded] = i
+			}
+		}
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		p.unsupported = true
+	}
+	return p
+}
+
+func hookOf(t, i2sType, textType reflect.Type) hookKind {
+	switch {
+	case t.Implements(i2sType):
+		return hookI2S
+	case t.Implements(textType):
+		return hookText
+	}
+	return hookNone
+}
+
+// byIndex - поле по пути через встроенные структуры, nil-указатели по дороге выделяются
+func (f *planField) byIndex(v reflect.Value) (reflect.Value, error) {
+	if len(f.index) == 1 {
+		return v.Field(f.index[0]), nil
+	}
+	for i, x := range f.index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				// во встроенный указатель на неэкспортируемую структуру записать нельзя
+				if !v.CanSet() {
+					return reflect.Value{}, &UnsupportedTypeError{Type: v.Type()}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+// byIndexNoAlloc - как byIndex, но nil-указатель по дороге значит, что поля нет
+func (f *planField) byIndexNoAlloc(v reflect.Value) (reflect.Value, bool) {
+	if len(f.index) == 1 {
+		return v.Field(f.index[0]), true
+	}
+	for i, x := range f.index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// callUnmarshal и callMarshal - вызов хука, который нашёлся при построении плана
+func callUnmarshal(h hookKind, data interface{}, ptr reflect.Value) error {
+	if h == hookI2S {
+		if err := ptr.Interface().(I2SUnmarshaler).UnmarshalI2S(data); err != nil {
+			return &HookError{Type: ptr.Type().Elem(), Err: err}
+		}
+		return nil
+	}
+	s, ok := data.(string)
+	if !ok {
+		return &TypeError{Expected: ptr.Type().Elem(), Got: reflect.TypeOf(data)}
+	}
+	if err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+		return &HookError{Type: ptr.Type().Elem(), Err: err}
+	}
+	return nil
+}
+
+func callMarshal(h hookKind, v reflect.Value) (interface{}, error) {
+	if h == hookI2S {
+		res, err := v.Interface().(I2SMarshaler).MarshalI2S()
+		if err != nil {
+			return nil, &HookError{Type: v.Type(), Err: err}
+		}
+		return res, nil
+	}
+	text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return nil, &HookError{Type: v.Type(), Err: err}
+	}
+	return string(text), nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type Node struct {
+	Name     string
+	Children []Node
+	Next     *Node `json:",omitempty"`
+}
+
+func TestPlanCache(t *testing.T) {
+	typ := reflect.TypeOf(Node{})
+	p := planFor(typ)
+	if planFor(typ) != p {
+		t.Fatalf("plan for %s is rebuilt on every call", typ)
+	}
+	// рекурсивный тип ссылается на свой же план
+	if p.fields[1].plan.elem != p || p.fields[2].plan.elem != p {
+		t.Fatalf("recursive plan for %s is not shared", typ)
+	}
+}
+
+func TestRecursiveRoundTrip(t *testing.T) {
+	in := &Node{
+		Name: "root",
+		Children: []Node{
+			{Name: "a", Children: []Node{{Name: "a1"}}},
+			{Name: "b"},
+		},
+		Next: &Node{Name: "next"},
+	}
+	data, err := s2i(in)
+	if err != nil {
+		t.Fatalf("s2i: %v", err)
+	}
+	out := &Node{}
+	if err := i2s(data, out); err != nil {
+		t.Fatalf("i2s: %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("results not match\nGot:\n%#v\nExpected:\n%#v", out, in)
+	}
+}
+
+func TestPlanConcurrent(t *testing.T) {
+	type Item struct {
+		ID   int
+		Tags []string
+	}
+	type Box struct {
+		Items []Item
+		Owner *Simple
+	}
+	in := &Box{
+		Items: []Item{{ID: 1, Tags: []string{"a"}}, {ID: 2}},
+		Owner: &Simple{ID: 3, Username: "owner"},
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := s2i(in)
+			if err != nil {
+				t.Errorf("s2i: %v", err)
+				return
+			}
+			out := &Box{}
+			if err := i2s(data, out); err != nil {
+				t.Errorf("i2s: %v", err)
+				return
+			}
+			if !reflect.DeepEqual(in, out) {
+				t.Errorf("results not match: %#v", out)
+			}
+		}()
+	}
+	wg.Wait()
+}
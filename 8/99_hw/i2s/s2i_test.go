@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type Team struct {
+	Name    string
+	Lead    *Simple
+	Users   []Simple
+	Scores  map[string]float64
+	Levels  [2]uint8
+	Comment interface{}
+	hidden  int
+}
+
+func TestErrorPath(t *testing.T) {
+	cases := []struct {
+		Result   interface{}
+		JsonData string
+		Error    string
+	}{
+		{
+			&Team{},
+			`{"Users":[{"ID":1},{"ID":2},{"ID":3},{"ID":4,"Username":7}]}`,
+			"Users[3].Username: expected string, got float64",
+		},
+		{
+			&Team{},
+			`{"Lead":{"Active":null,"ID":1.5}}`,
+			"Lead.ID: value 1.5 does not fit int",
+		},
+		{
+			&Team{},
+			`{"Levels":[1,256]}`,
+			"Levels[1]: value 256 does not fit uint8",
+		},
+		{
+			&Team{},
+			`{"Scores":{"go":"high"}}`,
+			`Scores["go"]: expected float64, got string`,
+		},
+		{
+			&Team{},
+			`{"Name":null,"Users":{}}`,
+			"Users: expected []main.Simple, got map[string]interface {}",
+		},
+		{
+			&Simple{},
+			`[]`,
+			"expected main.Simple, got []interface {}",
+		},
+	}
+
+	for idx, item := range cases {
+		var tmpData interface{}
+		json.Unmarshal([]byte(item.JsonData), &tmpData)
+		err := i2s(tmpData, item.Result)
+		if err == nil {
+			t.Errorf("[%d] expected error here", idx)
+			continue
+		}
+		if err.Error() != item.Error {
+			t.Errorf("[%d] bad error\nGot: %s\nExpected: %s", idx, err, item.Error)
+		}
+	}
+}
+
+func TestErrorTypes(t *testing.T) {
+	if err := i2s(map[string]interface{}{}, Simple{}); err != ErrNotPointer {
+		t.Errorf("expected ErrNotPointer, got %v", err)
+	}
+	if err := i2s(map[string]interface{}{}, (*Simple)(nil)); err != ErrNotPointer {
+		t.Errorf("expected ErrNotPointer, got %v", err)
+	}
+
+	err := i2s(map[string]interface{}{"ID": "42"}, &Simple{})
+	typeErr := &TypeError{}
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("expected TypeError, got %#v", err)
+	}
+	if typeErr.Path != "ID" || typeErr.Expected != reflect.TypeOf(0) || typeErr.Got != reflect.TypeOf("") {
+		t.Errorf("bad TypeError %#v", typeErr)
+	}
+
+	ch := make(chan int)
+	_, err = s2i(map[string]interface{}{"Ch": ch})
+	unsupported := &UnsupportedTypeError{}
+	if !errors.As(err, &unsupported) || unsupported.Path != `["Ch"]` {
+		t.Errorf("expected UnsupportedTypeError, got %#v", err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	smpl := Simple{ID: 42, Username: "rvasily", Active: true}
+	expected := &Team{
+		Name:    "go",
+		Lead:    &smpl,
+		Users:   []Simple{smpl, {ID: 1}},
+		Scores:  map[string]float64{"go": 9.5},
+		Levels:  [2]uint8{1, 255},
+		Comment: "ok",
+	}
+
+	data, err := s2i(expected)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// s2i должен давать ровно то же, что json.Marshal + json.Unmarshal
+	jsonRaw, _ := json.Marshal(expected)
+	var fromJSON interface{}
+	json.Unmarshal(jsonRaw, &fromJSON)
+	if !reflect.DeepEqual(data, fromJSON) {
+		t.Errorf("s2i not match json\nGot:\n%#v\nExpected:\n%#v", data, fromJSON)
+	}
+
+	result := new(Team)
+	if err := i2s(data, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("results not match\nGot:\n%#v\nExpected:\n%#v", result, expected)
+	}
+}
+
+func TestNullAndReuse(t *testing.T) {
+	result := &Team{
+		Name:  "keep",
+		Lead:  &Simple{ID: 1},
+		Users: []Simple{{ID: 1}, {ID: 2}, {ID: 3}},
+	}
+	data := map[string]interface{}{
+		"Name":  nil,
+		"Lead":  nil,
+		"Users": []interface{}{map[string]interface{}{"ID": 7}},
+	}
+	if err := i2s(data, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &Team{Name: "keep", Users: []Simple{{ID: 7}}}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("results not match\nGot:\n%#v\nExpected:\n%#v", result, expected)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Role int
+
+const (
+	RoleUser Role = iota
+	RoleAdmin
+)
+
+var roleNames = []string{"user", "admin"}
+
+// Role приходит строкой, а хранится числом
+func (r *Role) UnmarshalI2S(data interface{}) error {
+	s, ok := data.(string)
+	if !ok {
+		return fmt.Errorf("role must be string")
+	}
+	for i, name := range roleNames {
+		if name == s {
+			*r = Role(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown role %q", s)
+}
+
+func (r Role) MarshalI2S() (interface{}, error) {
+	return roleNames[r], nil
+}
+
+// и json, и i2s должны видеть Role одинаково
+func (r Role) MarshalJSON() ([]byte, error) {
+	return json.Marshal(roleNames[r])
+}
+
+type Audit struct {
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `json:"created_by,omitempty"`
+}
+
+type Base struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type Account struct {
+	Base
+	*Audit
+	Name     string `json:"login"`
+	Role     Role   `json:"role"`
+	Password string `json:"-"`
+	Email    string `json:",omitempty"`
+	Tags     []string
+}
+
+func TestTags(t *testing.T) {
+	created := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	expected := &Account{
+		Base:  Base{ID: 7, Name: "base"},
+		Audit: &Audit{CreatedAt: created},
+		Name:  "rvasily",
+		Role:  RoleAdmin,
+		Tags:  []string{"go"},
+	}
+
+	jsonRaw, _ := json.Marshal(expected)
+	var fromJSON interface{}
+	json.Unmarshal(jsonRaw, &fromJSON)
+
+	data, err := s2i(expected)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(data, fromJSON) {
+		t.Errorf("s2i not match json\nGot:\n%#v\nExpected:\n%#v", data, fromJSON)
+	}
+
+	result := &Account{Password: "secret"}
+	if err := i2s(fromJSON, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected.Password = "secret"
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("results not match\nGot:\n%#v\nExpected:\n%#v", result, expected)
+	}
+}
+
+func TestTagsCaseInsensitive(t *testing.T) {
+	result := &Account{}
+	err := i2s(map[string]interface{}{"ID": 1.0, "Login": "ivan", "tags": []interface{}{"a"}}, result)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &Account{Base: Base{ID: 1}, Name: "ivan", Tags: []string{"a"}}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("results not match\nGot:\n%#v\nExpected:\n%#v", result, expected)
+	}
+}
+
+type Conflict struct {
+	Base
+	Audit
+	Other struct {
+		ID int `json:"id"`
+	}
+}
+
+type Left struct{ Value int }
+type Right struct{ Value int }
+
+type Ambiguous struct {
+	Left
+	Right
+}
+
+func TestEmbeddedConflicts(t *testing.T) {
+	names := func(v interface{}) []string {
+		var res []string
+		for _, f := range typeFields(reflect.TypeOf(v)) {
+			res = append(res, f.name)
+		}
+		return res
+	}
+
+	if got := names(Conflict{}); !reflect.DeepEqual(got, []string{"id", "name", "created_at", "created_by", "Other"}) {
+		t.Errorf("bad Conflict fields %v", got)
+	}
+	// одинаковые имена на одном уровне без тегов - поле не достаётся никому, как в encoding/json
+	if got := names(Ambiguous{}); got != nil {
+		t.Errorf("bad Ambiguous fields %v", got)
+	}
+}
+
+func TestDecoderStrict(t *testing.T) {
+	data := map[string]interface{}{
+		"id":     1.0,
+		"login":  "ivan",
+		"zz":     true,
+		"extra":  "x",
+		"Audit":  nil,
+		"tags":   []interface{}{},
+		"secret": "",
+	}
+	if err := i2s(data, &Account{}); err != nil {
+		t.Errorf("i2s should skip unknown fields, got %v", err)
+	}
+
+	err := (&Decoder{DisallowUnknownFields: true}).Decode(data, &Account{})
+	unknown := &UnknownFieldError{}
+	if !errors.As(err, &unknown) || unknown.Field != "Audit" {
+		t.Fatalf("expected UnknownFieldError for Audit, got %v", err)
+	}
+
+	err = (&Decoder{DisallowUnknownFields: true}).Decode(
+		[]interface{}{map[string]interface{}{"ID": 1.0, "Username": "ivan", "Active": true, "Admin": true}},
+		&[]Simple{},
+	)
+	if err == nil || err.Error() != `[0]: unknown field "Admin"` {
+		t.Errorf("bad error %v", err)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	cases := []struct {
+		Data  map[string]interface{}
+		Error string
+	}{
+		{
+			map[string]interface{}{"role": "root"},
+			`role: main.Role: unknown role "root"`,
+		},
+		{
+			map[string]interface{}{"created_at": "yesterday"},
+			"created_at: time.Time: ",
+		},
+		{
+			map[string]interface{}{"created_at": 100.0},
+			"created_at: expected time.Time, got float64",
+		},
+	}
+	for idx, item := range cases {
+		err := i2s(item.Data, &Account{})
+		if err == nil || !strings.HasPrefix(err.Error(), item.Error) {
+			t.Errorf("[%d] bad error\nGot: %v\nExpected: %s", idx, err, item.Error)
+		}
+	}
+
+	err := i2s(map[string]interface{}{"role": "root"}, &Account{})
+	hookErr := &HookError{}
+	if !errors.As(err, &hookErr) || hookErr.Type != reflect.TypeOf(RoleUser) {
+		t.Errorf("expected HookError, got %#v", err)
+	}
+}